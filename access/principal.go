@@ -0,0 +1,57 @@
+// Package access identifies the caller of an RPC. The service sits behind an
+// API gateway that authenticates users and forwards who they are in request
+// metadata; the gateway must strip these keys from client requests.
+package access
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys set by the gateway.
+const (
+	SubjectKey = "x-user-id"
+	RolesKey   = "x-user-roles" // comma separated
+)
+
+// Principal is the caller of an RPC. The zero Principal is an anonymous
+// caller without roles.
+type Principal struct {
+	Subject string
+	Roles   []string
+}
+
+// FromContext returns the caller of the RPC served with ctx.
+func FromContext(ctx context.Context) Principal {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return Principal{}
+	}
+
+	var p Principal
+	if values := md.Get(SubjectKey); len(values) > 0 {
+		p.Subject = strings.TrimSpace(values[0])
+	}
+	for _, value := range md.Get(RolesKey) {
+		for _, role := range strings.Split(value, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				p.Roles = append(p.Roles, role)
+			}
+		}
+	}
+	return p
+}
+
+// HasAny reports whether p has at least one of roles.
+func (p Principal) HasAny(roles ...string) bool {
+	for _, have := range p.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+// Command migrate-variations rewrites the variation column of products
+// written before the canonical encoding and sets their product_type. Rows it
+// cannot parse are reported and left untouched. It is safe to run more than
+// once and while the service is running.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/helpers"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pkg"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/producttypes"
+)
+
+type row struct {
+	id          int64
+	productType string
+	category    string
+	variation   []byte
+}
+
+type report struct {
+	scanned, canonical, rewritten, changedConcurrently, unparsable int
+}
+
+func main() {
+	batchSize := flag.Int("batch-size", 500, "products read per query")
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing")
+	flag.Parse()
+
+	var cfg pkg.Config
+
+	file, err := os.Open("config.yaml")
+	if err != nil {
+		slog.Error("failed to open config.yaml", "error", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+	if err := cfg.LoadFile(file); err != nil {
+		slog.Error("failed to load config.yaml", "error", err)
+		os.Exit(1)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		slog.Error("failed to load .env file", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	dbConfig := database.DbConfig{
+		Host:     cfg.Database.Hostname,
+		Port:     cfg.Database.Port,
+		User:     helpers.GetEnvOrDefault("COCROACH_USERNAME", ""),
+		Password: helpers.GetEnvOrDefault("COCROACH_DB_PASSWORD", ""),
+		DbName:   cfg.Database.Database,
+		SSLMode:  cfg.Database.SSLMode,
+		MaxConn:  4,
+	}
+	pool, err := dbConfig.NewPgxPool(ctx, 30)
+	if err != nil {
+		slog.Error("failed to create pgx pool", "error", err)
+		os.Exit(1)
+	}
+	defer pool.Close()
+
+	result, err := migrate(context.Background(), pool, *batchSize, *dryRun)
+	slog.Info("variation migration finished",
+		"dry_run", *dryRun,
+		"scanned", result.scanned,
+		"canonical", result.canonical,
+		"rewritten", result.rewritten,
+		"changed_concurrently", result.changedConcurrently,
+		"unparsable", result.unparsable,
+	)
+	if err != nil {
+		slog.Error("variation migration failed", "error", err)
+		os.Exit(1)
+	}
+	if result.unparsable > 0 {
+		os.Exit(2)
+	}
+}
+
+// migrate walks products in id order and rewrites every legacy variation.
+func migrate(ctx context.Context, pool *pgxpool.Pool, batchSize int, dryRun bool) (report, error) {
+	var (
+		result report
+		lastID int64
+	)
+	for {
+		rows, err := readBatch(ctx, pool, lastID, batchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(rows) == 0 {
+			return result, nil
+		}
+		lastID = rows[len(rows)-1].id
+
+		for _, r := range rows {
+			result.scanned++
+			if _, err := producttypes.Decode(r.productType, r.variation); err == nil {
+				result.canonical++
+				continue
+			}
+
+			variation, err := producttypes.DecodeLegacy(r.productType, r.category, r.variation)
+			if err != nil {
+				result.unparsable++
+				slog.Warn("unparsable variation", "id", r.id, "product_type", r.productType, "category", r.category, "variation", string(r.variation), "error", err)
+				continue
+			}
+			data, err := variation.Encode()
+			if err != nil {
+				result.unparsable++
+				slog.Warn("failed to encode variation", "id", r.id, "error", err)
+				continue
+			}
+			if bytes.Equal(data, r.variation) && variation.Type == r.productType {
+				result.canonical++
+				continue
+			}
+			if dryRun {
+				result.rewritten++
+				slog.Info("would rewrite variation", "id", r.id, "product_type", variation.Type, "from", string(r.variation), "to", string(data))
+				continue
+			}
+
+			// The variation comparison skips rows an RPC rewrote since they were read.
+			tag, err := pool.Exec(ctx, `
+			UPDATE products SET variation = $2, product_type = NULLIF($3, '')
+			WHERE id = $1 AND variation = $4::JSONB`, r.id, data, variation.Type, string(r.variation))
+			if err != nil {
+				return result, err
+			}
+			if tag.RowsAffected() == 0 {
+				result.changedConcurrently++
+				continue
+			}
+			result.rewritten++
+		}
+	}
+}
+
+func readBatch(ctx context.Context, pool *pgxpool.Pool, afterID int64, batchSize int) ([]row, error) {
+	rows, err := pool.Query(ctx, `
+	SELECT id, COALESCE(product_type, ''), COALESCE(category, ''), variation
+	FROM products
+	WHERE id > $1
+	ORDER BY id
+	LIMIT $2`, afterID, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.productType, &r.category, &r.variation); err != nil {
+			return nil, err
+		}
+		batch = append(batch, r)
+	}
+	return batch, rows.Err()
+}
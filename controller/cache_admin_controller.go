@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultWarmTopN = 100
+
+type cacheAdminController struct {
+	pool      database.Pool
+	cache     database.CacheMethods
+	codec     *database.CacheCodec
+	stats     *database.CacheStats
+	products  pb.ProductServiceServer
+	publisher events.Publisher
+	// adminRoles may use any of the RPCs.
+	adminRoles []string
+	pb.UnimplementedCacheAdminServiceServer
+}
+
+// NewCacheAdminController returns an instance that implements pb.CacheAdminServiceServer.
+// Products are warmed by reading them through products, which fills the cache.
+// Only callers with one of adminRoles may use it.
+func NewCacheAdminController(pool database.Pool, cache database.CacheMethods, stats *database.CacheStats, products pb.ProductServiceServer, publisher events.Publisher, adminRoles []string) pb.CacheAdminServiceServer {
+	return &cacheAdminController{
+		pool:       pool,
+		cache:      cache,
+		codec:      database.NewCacheCodec(cache, database.CompressionNone),
+		stats:      stats,
+		products:   products,
+		publisher:  publisher,
+		adminRoles: adminRoles,
+	}
+}
+
+func (c *cacheAdminController) GetCacheStats(ctx context.Context, req *pb.GetCacheStatsRequest) (*pb.GetCacheStatsResponse, error) {
+	if _, err := authorize(ctx, "reading cache statistics", c.adminRoles); err != nil {
+		return nil, err
+	}
+	snapshot := c.stats.Snapshot()
+
+	prefixes := make([]string, 0, len(snapshot))
+	for prefix := range snapshot {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	response := &pb.GetCacheStatsResponse{}
+	for _, prefix := range prefixes {
+		ps := snapshot[prefix]
+		response.Stats = append(response.Stats, &pb.CacheStats{
+			Prefix:       prefix,
+			Hits:         ps.Hits,
+			Misses:       ps.Misses,
+			Errors:       ps.Errors,
+			Sets:         ps.Sets,
+			Deletes:      ps.Deletes,
+			HitRatio:     ps.HitRatio(),
+			AvgLatencyMs: float64(ps.AvgLatency().Microseconds()) / 1000,
+			MaxLatencyMs: float64(ps.MaxLatency.Microseconds()) / 1000,
+		})
+	}
+	return response, nil
+}
+
+func (c *cacheAdminController) InspectCacheKey(ctx context.Context, req *pb.InspectCacheKeyRequest) (*pb.InspectCacheKeyResponse, error) {
+	if _, err := authorize(ctx, "inspecting the cache", c.adminRoles); err != nil {
+		return nil, err
+	}
+	if req.GetKey() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "key is required")
+	}
+
+	info, found, err := c.codec.Inspect(ctx, req.GetKey())
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to read cache: %v", err)
+	}
+	if !found {
+		return &pb.InspectCacheKeyResponse{Found: false}, nil
+	}
+
+	return &pb.InspectCacheKeyResponse{
+		Found:         true,
+		SizeBytes:     int64(info.Size),
+		Envelope:      info.Envelope,
+		SchemaVersion: uint32(info.SchemaVersion),
+		Codec:         info.Codec,
+		Compression:   info.Compression,
+		Chunks:        int32(info.Chunks),
+	}, nil
+}
+
+func (c *cacheAdminController) EvictProduct(ctx context.Context, req *pb.EvictProductRequest) (*pb.EvictProductResponse, error) {
+	if _, err := authorize(ctx, "evicting products from the cache", c.adminRoles); err != nil {
+		return nil, err
+	}
+	if req.GetProductId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
+	}
+
+	if err := c.cache.Delete(ctx, productCacheKey(req.GetProductId())); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to evict product: %v", err)
+	}
+	c.evicted(ctx, req.GetProductId())
+
+	return &pb.EvictProductResponse{Evicted: true}, nil
+}
+
+func (c *cacheAdminController) EvictProductLists(ctx context.Context, req *pb.EvictProductListsRequest) (*pb.EvictProductListsResponse, error) {
+	if _, err := authorize(ctx, "evicting product lists from the cache", c.adminRoles); err != nil {
+		return nil, err
+	}
+	generation, err := bumpProductListGeneration(ctx, c.cache)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to evict product lists: %v", err)
+	}
+	c.evicted(ctx, 0)
+
+	return &pb.EvictProductListsResponse{Generation: generation}, nil
+}
+
+// evicted drops local copies and tells other replicas to do the same.
+func (c *cacheAdminController) evicted(ctx context.Context, productID int64) {
+	invalidateLocal(c.cache, productID)
+	if err := c.publisher.Publish(ctx, events.Event{Kind: events.CacheEvicted, ProductID: productID}); err != nil {
+		slog.Warn("failed to publish cache eviction", "id", productID, "error", err)
+	}
+}
+
+func (c *cacheAdminController) WarmCache(ctx context.Context, req *pb.WarmCacheRequest) (*pb.WarmCacheResponse, error) {
+	if _, err := authorize(ctx, "warming the cache", c.adminRoles); err != nil {
+		return nil, err
+	}
+	topN := int(req.GetTopN())
+	if topN <= 0 {
+		topN = defaultWarmTopN
+	}
+
+	productIDs, err := c.topProducts(ctx, topN)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to find products to warm: %v", err)
+	}
+
+	response := &pb.WarmCacheResponse{}
+	for _, id := range productIDs {
+		// Evict first so the read goes to the database and refreshes the entry.
+		if err := c.cache.Delete(ctx, productCacheKey(id)); err != nil {
+			slog.Warn("failed to evict product before warming", "id", id, "error", err)
+		}
+		if _, err := c.products.GetProduct(ctx, &pb.GetProductRequest{Id: id}); err != nil {
+			slog.Warn("failed to warm product", "id", id, "error", err)
+			continue
+		}
+		response.ProductIds = append(response.ProductIds, id)
+	}
+	return response, nil
+}
+
+// topProducts returns the n most read products on this replica, topped up
+// with the most recently updated products.
+func (c *cacheAdminController) topProducts(ctx context.Context, n int) ([]int64, error) {
+	seen := make(map[int64]bool, n)
+	var productIDs []int64
+	for _, key := range c.stats.TopKeys(productCachePrefix, n) {
+		if id, ok := productIDFromCacheKey(key); ok && !seen[id] {
+			seen[id] = true
+			productIDs = append(productIDs, id)
+		}
+	}
+	if len(productIDs) >= n {
+		return productIDs, nil
+	}
+
+	rows, err := c.pool.Query(ctx, `SELECT id FROM products ORDER BY updated_at DESC LIMIT $1`, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() && len(productIDs) < n {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			productIDs = append(productIDs, id)
+		}
+	}
+	return productIDs, rows.Err()
+}
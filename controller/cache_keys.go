@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+)
+
+const (
+	productCachePrefix     = "product:"
+	productListCachePrefix = "product-list:"
+	// productLookupCachePrefix keys map SKUs, slugs and barcodes to product ids.
+	productLookupCachePrefix = "product-by:"
+
+	// productListGenerationKey holds the namespace generation embedded in every
+	// product list key. Changing it orphans all cached lists at once.
+	productListGenerationKey = productListCachePrefix + "generation"
+
+	// maxSearchTermKeyLength is the longest escaped filter kept verbatim in
+	// a key; longer ones are hashed to respect memcached's 250 byte key limit.
+	maxSearchTermKeyLength = 128
+)
+
+func productCacheKey(id int64) string {
+	return fmt.Sprintf("%s%d", productCachePrefix, id)
+}
+
+// productIDFromCacheKey parses the id out of a key built by productCacheKey.
+func productIDFromCacheKey(key string) (int64, bool) {
+	if !strings.HasPrefix(key, productCachePrefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(key, productCachePrefix), 10, 64)
+	return id, err == nil
+}
+
+// localizedProductCacheKey returns the key of a product translated into a
+// locale other than the default one. Those keys cannot be enumerated for
+// deletion, so they embed the list generation and expire with the lists.
+func localizedProductCacheKey(generation string, id int64, locale string) string {
+	return fmt.Sprintf("%s@%s:%s", productCacheKey(id), locale, generation)
+}
+
+// productLookupCacheKey returns the key mapping a product identifier of the
+// given kind (sku, slug or barcode) to a product id.
+func productLookupCacheKey(kind, value string) string {
+	value = url.QueryEscape(value)
+	if len(value) > maxSearchTermKeyLength {
+		sum := sha1.Sum([]byte(value))
+		value = "sha1-" + hex.EncodeToString(sum[:])
+	}
+	return fmt.Sprintf("%s%s:%s", productLookupCachePrefix, kind, value)
+}
+
+func productListCacheKey(generation string, pageSize int32, offset int, locale string, lifecycles []string, req *pb.ListProductsRequest) string {
+	// Encode sorts by key, so equal filters share an entry.
+	filter := url.Values{}
+	filter.Set("locale", locale)
+	if lifecycles != nil {
+		filter.Set("lifecycle", strings.Join(lifecycles, ","))
+	}
+	if req.GetSearchTerm() != "" {
+		filter.Set("q", req.GetSearchTerm())
+	}
+	for key, value := range req.GetVariantAttributes() {
+		filter.Set("attr."+key, value)
+	}
+	if req.GetCategoryId() != 0 {
+		filter.Set("category", strconv.FormatInt(req.GetCategoryId(), 10))
+	}
+
+	// memcached keys may not contain spaces or control characters.
+	term := url.QueryEscape(filter.Encode())
+	if len(term) > maxSearchTermKeyLength {
+		sum := sha1.Sum([]byte(term))
+		term = "sha1-" + hex.EncodeToString(sum[:])
+	}
+	return fmt.Sprintf("%s%s:%d:%d:%s", productListCachePrefix, generation, pageSize, offset, term)
+}
+
+// productListGeneration returns the current list namespace generation,
+// starting a new one if the cache has none.
+func productListGeneration(ctx context.Context, cache database.CacheMethods) string {
+	value, err := cache.Get(ctx, productListGenerationKey)
+	if err == nil && value != nil {
+		return string(value)
+	}
+	if err != nil {
+		slog.Warn("cache error", "key", productListGenerationKey, "error", err)
+	}
+
+	generation, err := bumpProductListGeneration(ctx, cache)
+	if err != nil {
+		slog.Warn("failed to set product list generation", "error", err)
+	}
+	return generation
+}
+
+// bumpProductListGeneration starts a new list namespace, evicting every cached product list.
+func bumpProductListGeneration(ctx context.Context, cache database.CacheMethods) (string, error) {
+	generation := strconv.FormatInt(time.Now().UnixNano(), 36)
+	return generation, cache.Set(ctx, productListGenerationKey, []byte(generation), 0)
+}
+
+// CacheInvalidator returns an events.Handler that drops the in-process cache
+// entries affected by a product mutation, including ones made on other replicas.
+func CacheInvalidator(cache database.CacheMethods) events.Handler {
+	return func(event events.Event) {
+		invalidateLocal(cache, event.ProductID)
+	}
+}
+
+// invalidateLocal clears in-process copies of a product and of every product
+// list; a productID of 0 clears those of every product. It is a no-op for
+// caches without an in-process tier.
+func invalidateLocal(cache database.CacheMethods, productID int64) {
+	local, ok := cache.(database.LocalInvalidator)
+	if !ok {
+		return
+	}
+	if productID == 0 {
+		local.InvalidatePrefix(productCachePrefix)
+		local.InvalidatePrefix(productListCachePrefix)
+		return
+	}
+	local.Invalidate(productCacheKey(productID))
+	local.InvalidatePrefix(productCacheKey(productID) + "@")
+	local.InvalidatePrefix(productListCachePrefix)
+}
+
+// productChanged drops cached copies of a product and of every product list,
+// and records the mutation so that other replicas can invalidate their
+// in-process caches too.
+func productChanged(ctx context.Context, cache database.CacheMethods, publisher events.Publisher, kind events.Kind, productID int64) {
+	evictProduct(ctx, cache, productID)
+
+	if err := publisher.Publish(ctx, events.Event{Kind: kind, ProductID: productID}); err != nil {
+		slog.Warn("failed to publish product event", "id", productID, "kind", kind, "error", err)
+	}
+}
+
+// evictProduct drops cached copies of a product and of every product list.
+// Callers that published the event of the change in its transaction use it
+// instead of productChanged.
+func evictProduct(ctx context.Context, cache database.CacheMethods, productID int64) {
+	if err := cache.Delete(ctx, productCacheKey(productID)); err != nil {
+		slog.Warn("failed to delete product from cache", "id", productID, "error", err)
+	}
+	if _, err := bumpProductListGeneration(ctx, cache); err != nil {
+		slog.Warn("failed to evict product lists from cache", "error", err)
+	}
+	invalidateLocal(cache, productID)
+}
+
+// productsChanged is productChanged for a batch of products: it evicts each
+// of them but bumps the list generation and publishes an event of kind only
+// once, with a ProductID of 0.
+func productsChanged(ctx context.Context, cache database.CacheMethods, publisher events.Publisher, kind events.Kind, productIDs []int64) {
+	if len(productIDs) == 0 {
+		return
+	}
+	for _, productID := range productIDs {
+		if err := cache.Delete(ctx, productCacheKey(productID)); err != nil {
+			slog.Warn("failed to delete product from cache", "id", productID, "error", err)
+		}
+	}
+	if _, err := bumpProductListGeneration(ctx, cache); err != nil {
+		slog.Warn("failed to evict product lists from cache", "error", err)
+	}
+	invalidateLocal(cache, 0)
+
+	if err := publisher.Publish(ctx, events.Event{Kind: kind}); err != nil {
+		slog.Warn("failed to publish event", "kind", kind, "error", err)
+	}
+}
+
+// productListsChanged drops every cached product list, here and on other
+// replicas, after a change that affects lists but no single product.
+func productListsChanged(ctx context.Context, cache database.CacheMethods, publisher events.Publisher, kind events.Kind) {
+	if _, err := bumpProductListGeneration(ctx, cache); err != nil {
+		slog.Warn("failed to evict product lists from cache", "error", err)
+	}
+	if local, ok := cache.(database.LocalInvalidator); ok {
+		local.InvalidatePrefix(productListCachePrefix)
+	}
+
+	if err := publisher.Publish(ctx, events.Event{Kind: kind}); err != nil {
+		slog.Warn("failed to publish event", "kind", kind, "error", err)
+	}
+}
@@ -0,0 +1,429 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	maxSlugLength        = 64
+	maxDisplayNameLength = 255
+)
+
+var (
+	slugPattern   = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	slugSeparator = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// categoryColumns selects a category in the order scanCategory expects. path
+// lists the ids from the root down to the category itself, e.g. "/1/5/9/",
+// so the descendants of a category are the rows whose path starts with its
+// path.
+const categoryColumns = `id, COALESCE(parent_id, 0), slug, display_name, path, created_at, updated_at`
+
+type categoryController struct {
+	pool      database.Pool
+	cache     database.CacheMethods
+	publisher events.Publisher
+	// adminRoles may create, rename, move and delete categories.
+	adminRoles []string
+	pb.UnimplementedCategoryServiceServer
+}
+
+// NewCategoryController returns an instance that implements pb.CategoryServiceServer.
+// Only callers with one of adminRoles may change the category tree.
+func NewCategoryController(pool database.Pool, cache database.CacheMethods, publisher events.Publisher, adminRoles []string) pb.CategoryServiceServer {
+	return &categoryController{
+		pool:       pool,
+		cache:      cache,
+		publisher:  publisher,
+		adminRoles: adminRoles,
+	}
+}
+
+// normalizeSlug turns free text such as "Fresh Fruit" into "fresh-fruit".
+func normalizeSlug(s string) string {
+	return strings.Trim(slugSeparator.ReplaceAllString(strings.ToLower(strings.TrimSpace(s)), "-"), "-")
+}
+
+func scanCategory(row pgx.Row) (*pb.Category, error) {
+	var (
+		category             pb.Category
+		path                 string
+		createdAt, updatedAt time.Time
+	)
+	if err := row.Scan(&category.Id, &category.ParentId, &category.Slug, &category.DisplayName, &path, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	ids := strings.Split(strings.Trim(path, "/"), "/")
+	for _, id := range ids[:len(ids)-1] {
+		ancestorID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		category.AncestorIds = append(category.AncestorIds, ancestorID)
+	}
+	category.Depth = int32(len(category.AncestorIds))
+	category.CreatedAt = timestamppb.New(createdAt)
+	category.UpdatedAt = timestamppb.New(updatedAt)
+	return &category, nil
+}
+
+// categoryPath returns the path of a category for use in a transaction.
+func categoryPath(ctx context.Context, tx pgx.Tx, id int64) (string, error) {
+	var path string
+	err := tx.QueryRow(ctx, `SELECT path FROM categories WHERE id = $1`, id).Scan(&path)
+	return path, err
+}
+
+// categoryArgs validates and normalizes the slug and display name of a category.
+func categoryArgs(slug, displayName string) (string, string, error) {
+	displayName = strings.TrimSpace(displayName)
+	if displayName == "" || len(displayName) > maxDisplayNameLength {
+		return "", "", status.Errorf(codes.InvalidArgument, "display name must be 1 to %d characters", maxDisplayNameLength)
+	}
+	if slug == "" {
+		slug = displayName
+	}
+	slug = normalizeSlug(slug)
+	if !slugPattern.MatchString(slug) || len(slug) > maxSlugLength {
+		return "", "", status.Errorf(codes.InvalidArgument, "slug must be 1 to %d lowercase letters, digits and dashes", maxSlugLength)
+	}
+	return slug, displayName, nil
+}
+
+func (c *categoryController) CreateCategory(ctx context.Context, req *pb.CreateCategoryRequest) (*pb.CreateCategoryResponse, error) {
+	if _, err := authorize(ctx, "creating categories", c.adminRoles); err != nil {
+		return nil, err
+	}
+	slug, displayName, err := categoryArgs(req.GetSlug(), req.GetDisplayName())
+	if err != nil {
+		return nil, err
+	}
+
+	var category *pb.Category
+	err = database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		path := "/"
+		if req.GetParentId() != 0 {
+			var err error
+			if path, err = categoryPath(ctx, tx, req.GetParentId()); err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					return status.Errorf(codes.InvalidArgument, "parent category %d not found", req.GetParentId())
+				}
+				return err
+			}
+		}
+
+		var id int64
+		if err := tx.QueryRow(ctx, `SELECT unique_rowid()`).Scan(&id); err != nil {
+			return err
+		}
+		var parentID *int64
+		if req.GetParentId() != 0 {
+			parentID = &req.ParentId
+		}
+		query := `
+		INSERT INTO categories (id, parent_id, slug, display_name, path)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + categoryColumns
+		category, err = scanCategory(tx.QueryRow(ctx, query, id, parentID, slug, displayName, path+strconv.FormatInt(id, 10)+"/"))
+		return err
+	})
+	if err != nil {
+		return nil, categoryError(err)
+	}
+	return &pb.CreateCategoryResponse{Category: category}, nil
+}
+
+func (c *categoryController) GetCategory(ctx context.Context, req *pb.GetCategoryRequest) (*pb.GetCategoryResponse, error) {
+	var (
+		category *pb.Category
+		err      error
+	)
+	switch key := req.GetKey().(type) {
+	case *pb.GetCategoryRequest_Id:
+		category, err = scanCategory(c.pool.QueryRow(ctx, `SELECT `+categoryColumns+` FROM categories WHERE id = $1`, key.Id))
+	case *pb.GetCategoryRequest_Slug:
+		category, err = scanCategory(c.pool.QueryRow(ctx, `SELECT `+categoryColumns+` FROM categories WHERE slug = $1`, normalizeSlug(key.Slug)))
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "id or slug is required")
+	}
+	if err != nil {
+		return nil, categoryError(err)
+	}
+	return &pb.GetCategoryResponse{Category: category}, nil
+}
+
+func (c *categoryController) ListCategories(ctx context.Context, req *pb.ListCategoriesRequest) (*pb.ListCategoriesResponse, error) {
+	var (
+		query = `SELECT ` + categoryColumns + ` FROM categories`
+		args  []interface{}
+	)
+	switch {
+	case req.GetParentId() == 0 && !req.GetDescendants():
+		query += ` WHERE parent_id IS NULL`
+	case req.GetParentId() != 0 && !req.GetDescendants():
+		query += ` WHERE parent_id = $1`
+		args = append(args, req.GetParentId())
+	case req.GetParentId() != 0:
+		query += ` WHERE id != $1 AND path LIKE (SELECT path FROM categories WHERE id = $1) || '%'`
+		args = append(args, req.GetParentId())
+	}
+
+	rows, err := c.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list categories: %v", err)
+	}
+	categories, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*pb.Category, error) {
+		return scanCategory(row)
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list categories: %v", err)
+	}
+	return &pb.ListCategoriesResponse{Categories: sortCategories(categories)}, nil
+}
+
+// sortCategories orders categories depth first with siblings by slug.
+func sortCategories(categories []*pb.Category) []*pb.Category {
+	listed := make(map[int64]bool, len(categories))
+	for _, category := range categories {
+		listed[category.Id] = true
+	}
+	children := make(map[int64][]*pb.Category)
+	for _, category := range categories {
+		parentID := category.ParentId
+		if !listed[parentID] {
+			parentID = 0
+		}
+		children[parentID] = append(children[parentID], category)
+	}
+
+	sorted := make([]*pb.Category, 0, len(categories))
+	var visit func(parentID int64)
+	visit = func(parentID int64) {
+		siblings := children[parentID]
+		sort.Slice(siblings, func(i, j int) bool { return siblings[i].Slug < siblings[j].Slug })
+		for _, category := range siblings {
+			sorted = append(sorted, category)
+			visit(category.Id)
+		}
+	}
+	visit(0)
+	return sorted
+}
+
+func (c *categoryController) UpdateCategory(ctx context.Context, req *pb.UpdateCategoryRequest) (*pb.UpdateCategoryResponse, error) {
+	if _, err := authorize(ctx, "updating categories", c.adminRoles); err != nil {
+		return nil, err
+	}
+	slug, displayName, err := categoryArgs(req.GetSlug(), req.GetDisplayName())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		category *pb.Category
+		renamed  []int64
+	)
+	err = database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		var oldSlug string
+		if err := tx.QueryRow(ctx, `SELECT slug FROM categories WHERE id = $1 FOR UPDATE`, req.GetId()).Scan(&oldSlug); err != nil {
+			return err
+		}
+
+		query := `
+		UPDATE categories SET slug = $2, display_name = $3, updated_at = now()
+		WHERE id = $1
+		RETURNING ` + categoryColumns
+		var err error
+		if category, err = scanCategory(tx.QueryRow(ctx, query, req.GetId(), slug, displayName)); err != nil {
+			return err
+		}
+
+		renamed = nil
+		if slug == oldSlug {
+			return nil
+		}
+		// Products show the current slug of their category, see
+		// categoryNameColumn; products.category keeps the name they were
+		// written with, which legacy variations are decoded by. Promotions
+		// name categories by slug and follow the rename.
+		tag, err := tx.Exec(ctx, `
+		UPDATE promotions SET categories = array_replace(categories, $1, $2), updated_at = now()
+		WHERE $1 = ANY(categories)`, oldSlug, slug)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() > 0 {
+			if err := c.publisher.PublishTx(ctx, tx, events.Event{Kind: events.PromotionsUpdated}); err != nil {
+				return err
+			}
+		}
+		rows, err := tx.Query(ctx, `SELECT id FROM products WHERE category_id = $1`, req.GetId())
+		if err != nil {
+			return err
+		}
+		renamed, err = pgx.CollectRows(rows, pgx.RowTo[int64])
+		return err
+	})
+	if err != nil {
+		return nil, categoryError(err)
+	}
+
+	productsChanged(ctx, c.cache, c.publisher, events.CategoriesUpdated, renamed)
+	return &pb.UpdateCategoryResponse{Category: category}, nil
+}
+
+func (c *categoryController) DeleteCategory(ctx context.Context, req *pb.DeleteCategoryRequest) (*pb.DeleteCategoryResponse, error) {
+	if _, err := authorize(ctx, "deleting categories", c.adminRoles); err != nil {
+		return nil, err
+	}
+	err := database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		var children, products int64
+		err := tx.QueryRow(ctx, `
+		SELECT
+			(SELECT count(*) FROM categories WHERE parent_id = $1),
+			(SELECT count(*) FROM products WHERE category_id = $1)`, req.GetId()).Scan(&children, &products)
+		if err != nil {
+			return err
+		}
+		if children > 0 || products > 0 {
+			return status.Errorf(codes.FailedPrecondition, "category %d still has %d subcategories and %d products", req.GetId(), children, products)
+		}
+
+		tag, err := tx.Exec(ctx, `DELETE FROM categories WHERE id = $1`, req.GetId())
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, categoryError(err)
+	}
+	return &pb.DeleteCategoryResponse{Deleted: true}, nil
+}
+
+func (c *categoryController) MoveCategory(ctx context.Context, req *pb.MoveCategoryRequest) (*pb.MoveCategoryResponse, error) {
+	if _, err := authorize(ctx, "moving categories", c.adminRoles); err != nil {
+		return nil, err
+	}
+	if req.GetId() == req.GetNewParentId() {
+		return nil, status.Errorf(codes.InvalidArgument, "a category cannot be its own parent")
+	}
+
+	var category *pb.Category
+	err := database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		oldPath, err := categoryPath(ctx, tx, req.GetId())
+		if err != nil {
+			return err
+		}
+		parentPath := "/"
+		var parentID *int64
+		if req.GetNewParentId() != 0 {
+			if parentPath, err = categoryPath(ctx, tx, req.GetNewParentId()); err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					return status.Errorf(codes.InvalidArgument, "parent category %d not found", req.GetNewParentId())
+				}
+				return err
+			}
+			if strings.HasPrefix(parentPath, oldPath) {
+				return status.Errorf(codes.InvalidArgument, "cannot move category %d below its own descendant %d", req.GetId(), req.GetNewParentId())
+			}
+			parentID = &req.NewParentId
+		}
+		newPath := parentPath + strconv.FormatInt(req.GetId(), 10) + "/"
+
+		// Rewrite the path prefix of the category and all of its descendants.
+		_, err = tx.Exec(ctx, `
+		UPDATE categories SET path = $2 || substr(path, length($1) + 1)
+		WHERE path LIKE $1 || '%'`, oldPath, newPath)
+		if err != nil {
+			return err
+		}
+		query := `
+		UPDATE categories SET parent_id = $2, updated_at = now()
+		WHERE id = $1
+		RETURNING ` + categoryColumns
+		category, err = scanCategory(tx.QueryRow(ctx, query, req.GetId(), parentID))
+		return err
+	})
+	if err != nil {
+		return nil, categoryError(err)
+	}
+
+	// Category filters of cached lists include descendants, which just changed.
+	productListsChanged(ctx, c.cache, c.publisher, events.CategoriesUpdated)
+	return &pb.MoveCategoryResponse{Category: category}, nil
+}
+
+// categoryError maps errors of category operations to gRPC status errors.
+func categoryError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return status.Errorf(codes.NotFound, "category not found")
+	case database.IsUniqueViolation(err):
+		return status.Errorf(codes.AlreadyExists, "slug is already in use")
+	default:
+		return status.Errorf(codes.Internal, "%v", err)
+	}
+}
+
+// resolveCategory returns the category id and name of a product being
+// written. A category id must exist and names the product's category by its
+// slug; otherwise a category name matching a slug is linked to it and any
+// other name is kept as it is.
+func (c *productController) resolveCategory(ctx context.Context, categoryID int64, category string) (*int64, string, error) {
+	if categoryID != 0 {
+		var slug string
+		if err := c.pool.QueryRow(ctx, `SELECT slug FROM categories WHERE id = $1`, categoryID).Scan(&slug); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, "", status.Errorf(codes.InvalidArgument, "category %d not found", categoryID)
+			}
+			return nil, "", status.Errorf(codes.Internal, "failed to read category: %v", err)
+		}
+		return &categoryID, slug, nil
+	}
+	if category == "" {
+		return nil, category, nil
+	}
+
+	var id int64
+	err := c.pool.QueryRow(ctx, `SELECT id FROM categories WHERE slug = $1`, normalizeSlug(category)).Scan(&id)
+	switch {
+	case err == nil:
+		return &id, normalizeSlug(category), nil
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, category, nil
+	default:
+		return nil, "", status.Errorf(codes.Internal, "failed to read category: %v", err)
+	}
+}
+
+// categoryNameColumn selects the category name of a product: the current
+// slug of its category, or the name it was written with when it has none.
+const categoryNameColumn = `COALESCE((SELECT slug FROM categories WHERE categories.id = products.category_id), category)`
+
+// categoryFilter returns a condition matching products in the category with
+// id argument $n or any of its descendants.
+func categoryFilter(n int) string {
+	return `category_id IN (SELECT id FROM categories WHERE path LIKE (SELECT path FROM categories WHERE id = $` + strconv.Itoa(n) + `) || '%')`
+}
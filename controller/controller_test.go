@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/access"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/locales"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pricing"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/producttypes"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/promotions"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testRoles are the lifecycle roles of the controllers under test.
+var testRoles = LifecycleRoles{Editors: []string{"catalog-editor"}, Approvers: []string{"catalog-manager"}}
+
+// txOptions are the options database.ExecuteTx begins transactions with.
+var txOptions = pgx.TxOptions{IsoLevel: pgx.Serializable}
+
+// newMockPool returns a pool that fails the test unless it saw exactly the
+// queries expected of it.
+func newMockPool(t *testing.T) pgxmock.PgxPoolIface {
+	t.Helper()
+	pool, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("pgxmock.NewPool: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := pool.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return pool
+}
+
+// expectCommit expects the transaction begun by database.ExecuteTx to
+// commit. pgx rolls back once more afterwards, which a real transaction
+// ignores as already closed.
+func expectCommit(pool pgxmock.PgxPoolIface) {
+	pool.ExpectCommit()
+	pool.ExpectRollback().WillReturnError(pgx.ErrTxClosed)
+}
+
+// expectRollback expects the transaction begun by database.ExecuteTx to roll
+// back because its function failed.
+func expectRollback(pool pgxmock.PgxPoolIface) {
+	pool.ExpectRollback()
+	pool.ExpectRollback().WillReturnError(pgx.ErrTxClosed)
+}
+
+// callerWith returns the context of an RPC made by a caller with roles, as
+// forwarded by the API gateway.
+func callerWith(subject string, roles ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		access.SubjectKey, subject,
+		access.RolesKey, strings.Join(roles, ","),
+	))
+}
+
+// newTestProductController returns a product controller on pool with an
+// in-process cache, recording the events it publishes and the blobs it
+// deletes.
+func newTestProductController(pool database.Pool) (*productController, *recordingPublisher, *recordingBlobStore) {
+	cache := database.NewLocalCache(100, time.Minute)
+	publisher := &recordingPublisher{}
+	blobs := &recordingBlobStore{}
+	resolver, err := locales.NewResolver("en", []string{"en"}, nil)
+	if err != nil {
+		panic(err)
+	}
+	return &productController{
+		pool:       pool,
+		cache:      cache,
+		codec:      database.NewCacheCodec(cache, database.CompressionNone),
+		publisher:  publisher,
+		queryStats: database.NewQueryStats(nil, 0),
+		converter:  pricing.NewConverter(nil, nil, nil, pricing.RoundingRule{}),
+		promotions: promotions.NewEngine(nil, nil),
+		types:      producttypes.NewRegistry(pool),
+		blobs:      blobs,
+		locales:    resolver,
+		roles:      testRoles,
+		duplicates: DuplicateCheck{Threshold: defaultDuplicateThreshold},
+	}, publisher, blobs
+}
+
+// wantCode fails the test unless err is a status error with code.
+func wantCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != code {
+		t.Fatalf("error = %v, want code %v", err, code)
+	}
+}
+
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event events.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *recordingPublisher) PublishTx(ctx context.Context, tx pgx.Tx, event events.Event) error {
+	return p.Publish(ctx, event)
+}
+
+func (p *recordingPublisher) kinds() []events.Kind {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	kinds := make([]events.Kind, len(p.events))
+	for i, event := range p.events {
+		kinds[i] = event.Kind
+	}
+	return kinds
+}
+
+type recordingBlobStore struct {
+	mu      sync.Mutex
+	deleted []string
+}
+
+func (s *recordingBlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	return nil
+}
+
+func (s *recordingBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("content of " + key)), nil
+}
+
+func (s *recordingBlobStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleted = append(s.deleted, key)
+	return nil
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/duplicates"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/producttypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultDuplicateThreshold is used when no threshold is configured.
+	defaultDuplicateThreshold = 0.75
+	defaultDuplicateLimit     = 10
+	// maxDuplicateCandidates bounds the products scored per check; they are
+	// the ones whose names are most similar.
+	maxDuplicateCandidates = 50
+)
+
+// DuplicateCheck configures duplicate detection.
+type DuplicateCheck struct {
+	// Threshold is the score from which a product is a likely duplicate.
+	Threshold float64
+	// Strict makes CreateProduct reject every likely duplicate, as if the
+	// request asked for it.
+	Strict bool
+}
+
+// querier runs queries on a pool or in a transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+const duplicateCandidateColumns = `id, name, COALESCE(category_id, 0), COALESCE(category, ''), COALESCE(product_type, ''), variation`
+
+// scanDuplicateCandidate scans a row of duplicateCandidateColumns, followed by
+// any extra columns.
+func scanDuplicateCandidate(row pgx.Row, extra ...interface{}) (duplicates.Product, error) {
+	var (
+		product   duplicates.Product
+		variation []byte
+	)
+	dest := []interface{}{&product.ID, &product.Name, &product.CategoryID, &product.Category, &product.ProductType, &variation}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return duplicates.Product{}, err
+	}
+	// Rows that do not decode are compared without attributes.
+	if decoded, err := producttypes.DecodeAny(product.ProductType, product.Category, variation); err == nil {
+		product.Attributes = duplicates.Attributes(decoded.Attributes)
+	}
+	return product, nil
+}
+
+// findDuplicates returns the products other than product.ID scoring at
+// least minScore against it, best first. Candidates are preselected by
+// trigram similarity of their names and, unless lifecycles is nil, limited
+// to those lifecycle states.
+func (c *productController) findDuplicates(ctx context.Context, db querier, product duplicates.Product, minScore float64, limit int, lifecycles []string) ([]*pb.DuplicateMatch, error) {
+	query := `
+	SELECT ` + duplicateCandidateColumns + `
+	FROM products
+	WHERE id <> $2 AND lifecycle <> 'ARCHIVED' AND (lower(name) = $1 OR lower(name) % $1)`
+	args := []interface{}{strings.ToLower(strings.TrimSpace(product.Name)), product.ID, maxDuplicateCandidates}
+	if lifecycles != nil {
+		args = append(args, lifecycles)
+		query += ` AND lifecycle = ANY($4)`
+	}
+	query += `
+	ORDER BY similarity(lower(name), $1) DESC
+	LIMIT $3`
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to find duplicate candidates: %v", err)
+	}
+	candidates, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (duplicates.Product, error) {
+		return scanDuplicateCandidate(row)
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to scan duplicate candidates: %v", err)
+	}
+
+	ranked := duplicates.Rank(product, candidates, minScore)
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	matches := make([]*pb.DuplicateMatch, len(ranked))
+	for i, match := range ranked {
+		matches[i] = &pb.DuplicateMatch{
+			ProductId: match.Product.ID,
+			Name:      match.Product.Name,
+			Score:     match.Score,
+			Reasons:   match.Reasons,
+		}
+	}
+	return matches, nil
+}
+
+func (c *productController) FindDuplicates(ctx context.Context, req *pb.FindDuplicatesRequest) (*pb.FindDuplicatesResponse, error) {
+	minScore := req.GetMinScore()
+	if minScore < 0 || minScore > 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "min_score must be between 0 and 1")
+	}
+	if minScore == 0 {
+		minScore = c.duplicates.Threshold
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultDuplicateLimit
+	}
+	limit = min(limit, maxDuplicateCandidates)
+	// The public neither checks nor finds products it cannot see.
+	lifecycles, err := c.visibleLifecycles(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var product duplicates.Product
+	if req.GetProductId() != 0 {
+		var lifecycle string
+		product, err = scanDuplicateCandidate(c.pool.QueryRow(ctx, `SELECT `+duplicateCandidateColumns+`, lifecycle FROM products WHERE id = $1`, req.GetProductId()), &lifecycle)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, status.Errorf(codes.NotFound, "product not found")
+			}
+			return nil, status.Errorf(codes.Internal, "failed to read product: %v", err)
+		}
+		if !c.roles.visible(ctx, lifecycleFromName(lifecycle)) {
+			return nil, status.Errorf(codes.NotFound, "product not found")
+		}
+	} else {
+		if strings.TrimSpace(req.GetName()) == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "product id or name is required")
+		}
+		product = duplicates.Product{
+			Name:        req.GetName(),
+			CategoryID:  req.GetCategoryId(),
+			Category:    req.GetCategory(),
+			ProductType: req.GetProductType(),
+			Attributes:  duplicates.Attributes(req.GetAttributes()),
+		}
+	}
+
+	matches, err := c.findDuplicates(ctx, c.pool, product, minScore, limit, lifecycles)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.FindDuplicatesResponse{Matches: matches}, nil
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	duplicateCandidatesQuery = `SELECT ` + duplicateCandidateColumns + `
+	FROM products`
+	insertProductQuery = `INSERT INTO products`
+	recordPriceQuery   = `INSERT INTO product_prices`
+	newTestProductID   = 42
+)
+
+var duplicateCandidateColumnNames = []string{"id", "name", "category_id", "category", "product_type", "variation"}
+
+// withProductID makes CreateProduct give new products newTestProductID.
+func withProductID(t *testing.T) {
+	t.Helper()
+	generate := newProductID
+	newProductID = func() (uint64, error) { return newTestProductID, nil }
+	t.Cleanup(func() { newProductID = generate })
+}
+
+// newDesk returns a request to create an oak desk.
+func newDesk() *pb.CreateProductRequest {
+	return &pb.CreateProductRequest{
+		Name:        "Oak Desk",
+		Slug:        "oak-desk",
+		PriceMoney:  &pb.Money{CurrencyCode: "USD", Units: 120},
+		ProductType: "furniture",
+	}
+}
+
+// expectFurnitureType expects the furniture product type, which has no
+// attributes, to be read.
+func expectFurnitureType(pool pgxmock.PgxPoolIface) {
+	now := time.Now()
+	pool.ExpectQuery(regexp.QuoteMeta(`FROM product_types WHERE name = $1`)).WithArgs("furniture").
+		WillReturnRows(pgxmock.NewRows([]string{"name", "description", "attributes", "created_at", "updated_at"}).
+			AddRow("furniture", "Desks and shelves", []json.RawMessage{}, now, now))
+}
+
+// expectDuplicateCandidates expects the candidates for duplicates of an oak
+// desk to be read, finding candidates, given as pairs of id and name.
+func expectDuplicateCandidates(pool pgxmock.PgxPoolIface, candidates ...interface{}) {
+	rows := pgxmock.NewRows(duplicateCandidateColumnNames)
+	for i := 0; i < len(candidates); i += 2 {
+		rows.AddRow(candidates[i], candidates[i+1], int64(0), "", "furniture", []byte("{}"))
+	}
+	pool.ExpectQuery(regexp.QuoteMeta(duplicateCandidatesQuery)).
+		WithArgs("oak desk", int64(newTestProductID), maxDuplicateCandidates).
+		WillReturnRows(rows)
+}
+
+// expectInsertProduct expects the transaction inserting the new product to
+// write it and its price.
+func expectInsertProduct(pool pgxmock.PgxPoolIface) {
+	now := time.Now()
+	args := make([]interface{}, 15)
+	args[0] = int64(newTestProductID)
+	for i := 1; i < len(args); i++ {
+		args[i] = pgxmock.AnyArg()
+	}
+	pool.ExpectQuery(insertProductQuery).WithArgs(args...).
+		WillReturnRows(pgxmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+	pool.ExpectExec(recordPriceQuery).WithArgs(int64(newTestProductID), int64(0), "USD", "120").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	expectCommit(pool)
+}
+
+func TestCreateProductRejectsDuplicates(t *testing.T) {
+	tests := []struct {
+		name   string
+		strict bool
+		reject bool
+	}{
+		{"strict mode", true, false},
+		{"requested by the importer", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withProductID(t)
+			pool := newMockPool(t)
+			expectFurnitureType(pool)
+			// Duplicates are looked for in the transaction inserting the
+			// product, so that concurrent imports cannot both pass.
+			pool.ExpectBeginTx(txOptions)
+			expectDuplicateCandidates(pool, int64(5), "oak desk ")
+			expectRollback(pool)
+
+			c, publisher, _ := newTestProductController(pool)
+			c.duplicates.Strict = tt.strict
+			req := newDesk()
+			req.RejectDuplicates = tt.reject
+			_, err := c.CreateProduct(callerWith("ed", "catalog-editor"), req)
+			wantCode(t, err, codes.AlreadyExists)
+			if len(publisher.events) != 0 {
+				t.Errorf("published %v for a rejected product", publisher.kinds())
+			}
+		})
+	}
+}
+
+func TestCreateProductWithoutDuplicates(t *testing.T) {
+	withProductID(t)
+	pool := newMockPool(t)
+	expectFurnitureType(pool)
+	pool.ExpectBeginTx(txOptions)
+	expectDuplicateCandidates(pool, int64(5), "Walnut Bookshelf")
+	expectInsertProduct(pool)
+
+	c, publisher, _ := newTestProductController(pool)
+	c.duplicates.Strict = true
+	response, err := c.CreateProduct(callerWith("ed", "catalog-editor"), newDesk())
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+	if response.GetId() != newTestProductID || len(response.GetPossibleDuplicates()) != 0 {
+		t.Errorf("CreateProduct = product %d with duplicates %v, want product %d without", response.GetId(), response.GetPossibleDuplicates(), newTestProductID)
+	}
+	if kinds := publisher.kinds(); len(kinds) != 1 || kinds[0] != events.ProductCreated {
+		t.Errorf("published %v, want %v", kinds, events.ProductCreated)
+	}
+}
+
+func TestCreateProductReportsDuplicates(t *testing.T) {
+	withProductID(t)
+	pool := newMockPool(t)
+	expectFurnitureType(pool)
+	// Outside strict mode duplicates are only reported, and looked for before
+	// the transaction.
+	expectDuplicateCandidates(pool, int64(5), "oak desk ", int64(6), "Walnut Bookshelf")
+	pool.ExpectBeginTx(txOptions)
+	expectInsertProduct(pool)
+
+	c, _, _ := newTestProductController(pool)
+	response, err := c.CreateProduct(callerWith("ed", "catalog-editor"), newDesk())
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+	matches := response.GetPossibleDuplicates()
+	if len(matches) != 1 || matches[0].GetProductId() != 5 || matches[0].GetScore() < defaultDuplicateThreshold {
+		t.Fatalf("possible duplicates = %v, want product 5 scoring at least %v", matches, defaultDuplicateThreshold)
+	}
+}
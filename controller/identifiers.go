@@ -0,0 +1,274 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/gtin"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Unique indexes on the product identifiers, see schema.sql.
+const (
+	productSkuIndex     = "products_sku_key"
+	productSlugIndex    = "products_slug_key"
+	productBarcodeIndex = "products_barcode_key"
+)
+
+// maxSlugAttempts bounds how often a generated slug is regenerated after
+// losing a race for it.
+const maxSlugAttempts = 3
+
+// productSku validates an optional product SKU.
+func productSku(sku string) (string, error) {
+	sku = strings.TrimSpace(sku)
+	if len(sku) > maxSkuLength {
+		return "", status.Errorf(codes.InvalidArgument, "sku must be at most %d characters", maxSkuLength)
+	}
+	return sku, nil
+}
+
+// productBarcode validates an optional barcode and returns its GTIN-14 form.
+func productBarcode(barcode string) (string, error) {
+	if strings.TrimSpace(barcode) == "" {
+		return "", nil
+	}
+	code, err := gtin.Normalize(barcode)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "invalid barcode: %v", err)
+	}
+	return code, nil
+}
+
+// slugFromName turns a product name such as "Crème Brûlée" into
+// "creme-brulee", dropping accents before normalizing it like category slugs.
+func slugFromName(name string) string {
+	folded, _, err := transform.String(transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn))), name)
+	if err != nil {
+		folded = name
+	}
+	slug := normalizeSlug(folded)
+	// Leave room for a collision suffix.
+	if len(slug) > maxSlugLength-8 {
+		slug = strings.TrimRight(slug[:maxSlugLength-8], "-")
+	}
+	if slug == "" {
+		slug = "product"
+	}
+	return slug
+}
+
+// requestedSlug validates a slug given by the client.
+func requestedSlug(slug string) (string, error) {
+	slug = normalizeSlug(slug)
+	if slug == "" || len(slug) > maxSlugLength {
+		return "", status.Errorf(codes.InvalidArgument, "slug must be 1 to %d letters, digits or hyphens", maxSlugLength)
+	}
+	return slug, nil
+}
+
+// availableSlug returns base, or base with the lowest numeric suffix from 2
+// up that no other product uses.
+func (c *productController) availableSlug(ctx context.Context, base string) (string, error) {
+	rows, err := c.pool.Query(ctx, `SELECT slug FROM products WHERE slug = $1 OR slug LIKE $2`, base, base+"-%")
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to read slugs: %v", err)
+	}
+	slugs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to read slugs: %v", err)
+	}
+
+	taken := make(map[string]bool, len(slugs))
+	for _, slug := range slugs {
+		taken[slug] = true
+	}
+	slug := base
+	for n := 2; taken[slug]; n++ {
+		slug = base + "-" + strconv.Itoa(n)
+	}
+	return slug, nil
+}
+
+// productSkuAvailable fails with AlreadyExists if a variant uses sku.
+func productSkuAvailable(ctx context.Context, tx pgx.Tx, sku string) error {
+	if sku == "" {
+		return nil
+	}
+	return skuAvailable(ctx, tx, `SELECT EXISTS (SELECT 1 FROM product_variants WHERE sku = $1)`, sku, "a variant")
+}
+
+// variantSkuAvailable fails with AlreadyExists if a product uses sku.
+func variantSkuAvailable(ctx context.Context, tx pgx.Tx, sku string) error {
+	return skuAvailable(ctx, tx, `SELECT EXISTS (SELECT 1 FROM products WHERE sku = $1)`, sku, "a product")
+}
+
+// skuAvailable runs query, which reports whether sku is in use. Product and
+// variant SKUs live in separate tables, each with its own unique index, yet
+// GetProductBySku looks both up. The transaction writing a SKU therefore
+// checks the other table; being serializable, it cannot pass alongside a
+// concurrent write of the same SKU there.
+func skuAvailable(ctx context.Context, tx pgx.Tx, query, sku, user string) error {
+	var taken bool
+	if err := tx.QueryRow(ctx, query, sku).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return status.Errorf(codes.AlreadyExists, "sku is already in use by %s", user)
+	}
+	return nil
+}
+
+// identifierError maps violations of the product identifier indexes to
+// AlreadyExists, and returns nil for other errors.
+func identifierError(err error) error {
+	if !database.IsUniqueViolation(err) {
+		return nil
+	}
+	switch database.ConstraintName(err) {
+	case productSkuIndex:
+		return status.Errorf(codes.AlreadyExists, "sku is already in use")
+	case productSlugIndex:
+		return status.Errorf(codes.AlreadyExists, "slug is already in use")
+	case productBarcodeIndex:
+		return status.Errorf(codes.AlreadyExists, "barcode is already in use")
+	}
+	return nil
+}
+
+// productLookup finds a product by an identifier other than its id.
+type productLookup struct {
+	kind  string // sku, slug or barcode
+	value string
+	// query selects the id of the product with value as $1.
+	query string
+	// matches reports whether a product fetched through a cached id still has value.
+	matches func(product *pb.Product) bool
+}
+
+// getProductBy resolves lookup to a product id, caching the mapping, and
+// reads the product through GetProduct so that it is served from the
+// product cache. Cached mappings are checked against the product they point
+// to, so identifier changes need no invalidation.
+func (c *productController) getProductBy(ctx context.Context, lookup productLookup, currency, locale string) (*pb.Product, error) {
+	key := productLookupCacheKey(lookup.kind, lookup.value)
+	get := func(id int64) (*pb.Product, error) {
+		resp, err := c.GetProduct(ctx, &pb.GetProductRequest{Id: id, Currency: currency, Locale: locale})
+		return resp.GetProduct(), err
+	}
+
+	if value, err := c.cache.Get(ctx, key); err != nil {
+		slog.Warn("cache error", "key", key, "error", err)
+	} else if value != nil {
+		if id, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			if product, err := get(id); err == nil && lookup.matches(product) {
+				return product, nil
+			}
+		}
+	}
+
+	var id int64
+	if err := c.pool.QueryRow(ctx, lookup.query, lookup.value).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, status.Errorf(codes.NotFound, "no product with %s %q", lookup.kind, lookup.value)
+		}
+		return nil, status.Errorf(codes.Internal, "failed to look up product: %v", err)
+	}
+	if err := c.cache.Set(ctx, key, []byte(strconv.FormatInt(id, 10)), 3600); err != nil {
+		slog.Warn("failed to set product lookup in cache", "key", key, "error", err)
+	}
+	return get(id)
+}
+
+func (c *productController) GetProductBySku(ctx context.Context, req *pb.GetProductBySkuRequest) (*pb.GetProductBySkuResponse, error) {
+	sku := strings.TrimSpace(req.GetSku())
+	if sku == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "sku is required")
+	}
+	product, err := c.getProductBy(ctx, productLookup{
+		kind:  "sku",
+		value: sku,
+		// Variant SKUs identify their product too.
+		query: `SELECT id FROM products WHERE sku = $1
+		UNION ALL
+		SELECT product_id FROM product_variants WHERE sku = $1
+		LIMIT 1`,
+		matches: func(product *pb.Product) bool {
+			if product.Sku == sku {
+				return true
+			}
+			for _, variant := range product.Variants {
+				if variant.Sku == sku {
+					return true
+				}
+			}
+			return false
+		},
+	}, req.GetCurrency(), req.GetLocale())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetProductBySkuResponse{Product: product}, nil
+}
+
+func (c *productController) GetProductBySlug(ctx context.Context, req *pb.GetProductBySlugRequest) (*pb.GetProductBySlugResponse, error) {
+	slug := normalizeSlug(req.GetSlug())
+	if slug == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "slug is required")
+	}
+	product, err := c.getProductBy(ctx, productLookup{
+		kind:    "slug",
+		value:   slug,
+		query:   `SELECT id FROM products WHERE slug = $1`,
+		matches: func(product *pb.Product) bool { return product.Slug == slug },
+	}, req.GetCurrency(), req.GetLocale())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetProductBySlugResponse{Product: product}, nil
+}
+
+func (c *productController) GetProductByBarcode(ctx context.Context, req *pb.GetProductByBarcodeRequest) (*pb.GetProductByBarcodeResponse, error) {
+	barcode, err := productBarcode(req.GetBarcode())
+	if err != nil {
+		return nil, err
+	}
+	if barcode == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "barcode is required")
+	}
+	product, err := c.getProductBy(ctx, productLookup{
+		kind:    "barcode",
+		value:   barcode,
+		query:   `SELECT id FROM products WHERE barcode = $1`,
+		matches: func(product *pb.Product) bool { return product.Barcode == barcode },
+	}, req.GetCurrency(), req.GetLocale())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetProductByBarcodeResponse{Product: product}, nil
+}
+
+// slugOrGenerated returns the slug requested for a new product, or one
+// generated from its name, and whether it was generated.
+func (c *productController) slugOrGenerated(ctx context.Context, slug, name string) (string, bool, error) {
+	if strings.TrimSpace(slug) != "" {
+		slug, err := requestedSlug(slug)
+		return slug, false, err
+	}
+	slug, err := c.availableSlug(ctx, slugFromName(name))
+	if err != nil {
+		return "", false, err
+	}
+	return slug, true, nil
+}
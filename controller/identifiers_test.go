@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	skuLookupQuery        = `SELECT id FROM products WHERE sku = $1`
+	slugLookupQuery       = `SELECT id FROM products WHERE slug = $1`
+	variantSkuInUseQuery  = `SELECT EXISTS (SELECT 1 FROM product_variants WHERE sku = $1)`
+	productSkuInUseQuery  = `SELECT EXISTS (SELECT 1 FROM products WHERE sku = $1)`
+	lockVariantPriceQuery = `SELECT product_id, price::STRING, currency FROM product_variants WHERE id = $1 FOR UPDATE`
+)
+
+// cacheProduct puts product in the product cache of c, as GetProduct would.
+func cacheProduct(t *testing.T, c *productController, product *pb.Product) {
+	t.Helper()
+	if err := c.codec.Set(context.Background(), productCacheKey(product.Id), product, 3600); err != nil {
+		t.Fatalf("caching product %d: %v", product.Id, err)
+	}
+}
+
+func TestGetProductBySku(t *testing.T) {
+	pool := newMockPool(t)
+	// Only the first lookup reaches the database; the second finds the id cached.
+	pool.ExpectQuery(regexp.QuoteMeta(skuLookupQuery)).WithArgs("DESK-OAK-L").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(int64(1)))
+
+	c, _, _ := newTestProductController(pool)
+	cacheProduct(t, c, &pb.Product{
+		Id:        1,
+		Name:      "Desk",
+		Lifecycle: pb.LifecycleState_LIFECYCLE_PUBLISHED,
+		Sku:       "DESK-OAK",
+		Variants:  []*pb.ProductVariant{{Id: 7, ProductId: 1, Sku: "DESK-OAK-L"}},
+	})
+
+	for i := 0; i < 2; i++ {
+		// Variant SKUs identify their product too.
+		response, err := c.GetProductBySku(context.Background(), &pb.GetProductBySkuRequest{Sku: " DESK-OAK-L "})
+		if err != nil {
+			t.Fatalf("GetProductBySku: %v", err)
+		}
+		if got := response.GetProduct().GetId(); got != 1 {
+			t.Fatalf("GetProductBySku = product %d, want 1", got)
+		}
+	}
+}
+
+func TestGetProductBySlugAfterSlugChange(t *testing.T) {
+	pool := newMockPool(t)
+	pool.ExpectQuery(regexp.QuoteMeta(slugLookupQuery)).WithArgs("oak-desk").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(int64(2)))
+
+	c, _, _ := newTestProductController(pool)
+	// The slug still points at product 1, which has since been renamed and
+	// its slug given to product 2.
+	if err := c.cache.Set(context.Background(), productLookupCacheKey("slug", "oak-desk"), []byte("1"), 3600); err != nil {
+		t.Fatal(err)
+	}
+	cacheProduct(t, c, &pb.Product{Id: 1, Lifecycle: pb.LifecycleState_LIFECYCLE_PUBLISHED, Slug: "old-oak-desk"})
+	cacheProduct(t, c, &pb.Product{Id: 2, Lifecycle: pb.LifecycleState_LIFECYCLE_PUBLISHED, Slug: "oak-desk"})
+
+	response, err := c.GetProductBySlug(context.Background(), &pb.GetProductBySlugRequest{Slug: "Oak Desk"})
+	if err != nil {
+		t.Fatalf("GetProductBySlug: %v", err)
+	}
+	if got := response.GetProduct().GetId(); got != 2 {
+		t.Fatalf("GetProductBySlug = product %d, want 2", got)
+	}
+}
+
+func TestGetProductBySlugNotFound(t *testing.T) {
+	tests := []struct {
+		name    string
+		product *pb.Product
+	}{
+		{"missing product", nil},
+		// Unpublished products are hidden from the public, by any identifier.
+		{"draft product", &pb.Product{Id: 1, Lifecycle: pb.LifecycleState_LIFECYCLE_DRAFT, Slug: "oak-desk"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newMockPool(t)
+			rows := pgxmock.NewRows([]string{"id"})
+			if tt.product != nil {
+				rows.AddRow(tt.product.Id)
+			}
+			pool.ExpectQuery(regexp.QuoteMeta(slugLookupQuery)).WithArgs("oak-desk").WillReturnRows(rows)
+
+			c, _, _ := newTestProductController(pool)
+			if tt.product != nil {
+				cacheProduct(t, c, tt.product)
+			}
+			_, err := c.GetProductBySlug(callerWith("alice", "customer"), &pb.GetProductBySlugRequest{Slug: "oak-desk"})
+			wantCode(t, err, codes.NotFound)
+		})
+	}
+}
+
+func TestProductSkuAvailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		sku      string
+		inUse    bool
+		wantCode codes.Code
+	}{
+		{"unused", "DESK-OAK", false, codes.OK},
+		{"used by a variant", "DESK-OAK", true, codes.AlreadyExists},
+		{"no sku", "", false, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			pool := newMockPool(t)
+			pool.ExpectBegin()
+			if tt.sku != "" {
+				pool.ExpectQuery(regexp.QuoteMeta(variantSkuInUseQuery)).WithArgs(tt.sku).
+					WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(tt.inUse))
+			}
+
+			tx, err := pool.Begin(ctx)
+			if err != nil {
+				t.Fatalf("Begin: %v", err)
+			}
+			wantCode(t, productSkuAvailable(ctx, tx, tt.sku), tt.wantCode)
+		})
+	}
+}
+
+func TestAddVariantWithProductSku(t *testing.T) {
+	pool := newMockPool(t)
+	pool.ExpectBeginTx(txOptions)
+	pool.ExpectQuery(regexp.QuoteMeta(lockProductQuery)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"lifecycle"}).AddRow("DRAFT"))
+	pool.ExpectQuery(regexp.QuoteMeta(productSkuInUseQuery)).WithArgs("DESK-OAK").
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+	expectRollback(pool)
+
+	c, publisher, _ := newTestProductController(pool)
+	_, err := c.AddVariant(callerWith("ed", "catalog-editor"), &pb.AddVariantRequest{
+		Variant: &pb.ProductVariant{ProductId: 1, Sku: "DESK-OAK"},
+	})
+	wantCode(t, err, codes.AlreadyExists)
+	if len(publisher.events) != 0 {
+		t.Errorf("published %v for a rejected variant", publisher.kinds())
+	}
+}
+
+func TestUpdateVariantWithProductSku(t *testing.T) {
+	pool := newMockPool(t)
+	pool.ExpectBeginTx(txOptions)
+	pool.ExpectQuery(regexp.QuoteMeta(lockVariantPriceQuery)).WithArgs(int64(7)).
+		WillReturnRows(pgxmock.NewRows([]string{"product_id", "price", "currency"}).AddRow(int64(1), nil, nil))
+	pool.ExpectQuery(regexp.QuoteMeta(lockProductQuery)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"lifecycle"}).AddRow("PUBLISHED"))
+	pool.ExpectQuery(regexp.QuoteMeta(productSkuInUseQuery)).WithArgs("LAMP-BRASS").
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+	expectRollback(pool)
+
+	c, _, _ := newTestProductController(pool)
+	_, err := c.UpdateVariant(callerWith("ed", "catalog-editor"), &pb.UpdateVariantRequest{
+		Variant: &pb.ProductVariant{Id: 7, ProductId: 1, Sku: "LAMP-BRASS"},
+	})
+	wantCode(t, err, codes.AlreadyExists)
+}
@@ -0,0 +1,330 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/inventory"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxWarehouseIDLength matches the warehouse_id and lot_code columns.
+const maxWarehouseIDLength = 64
+
+type inventoryController struct {
+	store     *inventory.Store
+	cache     database.CacheMethods
+	publisher events.Publisher
+	// reservationTTL applies to reservations that do not ask for one;
+	// maxReservationTTL caps the ones that do.
+	reservationTTL    time.Duration
+	maxReservationTTL time.Duration
+	pb.UnimplementedInventoryServiceServer
+}
+
+// NewInventoryController returns an instance that implements pb.InventoryServiceServer.
+func NewInventoryController(store *inventory.Store, cache database.CacheMethods, publisher events.Publisher, reservationTTL, maxReservationTTL time.Duration) pb.InventoryServiceServer {
+	return &inventoryController{
+		store:             store,
+		cache:             cache,
+		publisher:         publisher,
+		reservationTTL:    reservationTTL,
+		maxReservationTTL: maxReservationTTL,
+	}
+}
+
+// ExpireLots runs until ctx is cancelled, checking every interval for lots
+// past their best-before date and evicting the products whose stock changed
+// as a result.
+func ExpireLots(ctx context.Context, store *inventory.Store, cache database.CacheMethods, publisher events.Publisher, interval time.Duration) {
+	store.WatchExpiry(ctx, interval, func(productID int64) {
+		productChanged(ctx, cache, publisher, events.ProductUpdated, productID)
+	})
+}
+
+// ReleaseExpiredReservations runs until ctx is cancelled, releasing
+// reservations whose TTL has passed every interval and evicting the products
+// whose status or variant stock changed as a result.
+func ReleaseExpiredReservations(ctx context.Context, store *inventory.Store, cache database.CacheMethods, publisher events.Publisher, interval time.Duration) {
+	store.Sweep(ctx, interval, func(reservation inventory.Reservation) {
+		for _, productID := range reservation.ChangedProducts {
+			productChanged(ctx, cache, publisher, events.ProductUpdated, productID)
+		}
+	})
+}
+
+func (c *inventoryController) AdjustStock(ctx context.Context, req *pb.AdjustStockRequest) (*pb.AdjustStockResponse, error) {
+	if req.GetProductId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
+	}
+	warehouseID := strings.TrimSpace(req.GetWarehouseId())
+	if warehouseID == "" || len(warehouseID) > maxWarehouseIDLength {
+		return nil, status.Errorf(codes.InvalidArgument, "warehouse id must be 1 to %d characters", maxWarehouseIDLength)
+	}
+	if req.GetDelta() == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "delta must not be zero")
+	}
+	if req.GetReason() == pb.StockAdjustmentReason_STOCK_REASON_UNSPECIFIED {
+		return nil, status.Errorf(codes.InvalidArgument, "reason is required")
+	}
+	if req.GetVariantId() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "variant id must not be negative")
+	}
+
+	adjustment := inventory.Adjustment{
+		ProductID:   req.GetProductId(),
+		VariantID:   req.GetVariantId(),
+		WarehouseID: warehouseID,
+		Delta:       req.GetDelta(),
+		Reason:      req.GetReason().String(),
+		Note:        req.GetNote(),
+	}
+	if lot := req.GetLot(); lot != nil {
+		adjustment.Lot = &inventory.Lot{Code: strings.TrimSpace(lot.GetLotCode())}
+		if len(adjustment.Lot.Code) > maxWarehouseIDLength {
+			return nil, status.Errorf(codes.InvalidArgument, "lot code must be at most %d characters", maxWarehouseIDLength)
+		}
+		if lot.GetBestBefore() != nil {
+			adjustment.Lot.BestBefore = lot.GetBestBefore().AsTime()
+		}
+		if lot.GetReceivedAt() != nil {
+			adjustment.Lot.ReceivedAt = lot.GetReceivedAt().AsTime()
+		}
+	}
+
+	stock, err := c.store.Adjust(ctx, adjustment)
+	if err != nil {
+		return nil, inventoryError(err)
+	}
+
+	// Cached products carry the stock of their variants.
+	if stock.StatusChanged || req.GetVariantId() != 0 {
+		productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, req.GetProductId())
+	}
+
+	return &pb.AdjustStockResponse{
+		Level:         stockLevelToProto(stock.Levels[0]),
+		Available:     stock.Available,
+		ProductStatus: productStatusFromString(stock.Status),
+	}, nil
+}
+
+func (c *inventoryController) GetStock(ctx context.Context, req *pb.GetStockRequest) (*pb.GetStockResponse, error) {
+	if req.GetProductId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
+	}
+
+	stock, err := c.store.Get(ctx, req.GetProductId())
+	if err != nil {
+		return nil, inventoryError(err)
+	}
+
+	response := &pb.GetStockResponse{
+		Available:     stock.Available,
+		ProductStatus: productStatusFromString(stock.Status),
+	}
+	for _, level := range stock.Levels {
+		response.Levels = append(response.Levels, stockLevelToProto(level))
+	}
+	for _, lot := range stock.Lots {
+		response.Lots = append(response.Lots, lotToProto(lot))
+	}
+	return response, nil
+}
+
+func (c *inventoryController) ListExpiringLots(ctx context.Context, req *pb.ListExpiringLotsRequest) (*pb.ListExpiringLotsResponse, error) {
+	if req.GetWithinDays() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "within_days must not be negative")
+	}
+	pageSize := clampPageSize(req.GetPageSize(), 50)
+	offset := 0
+	if req.GetPageToken() != "" {
+		var err error
+		offset, err = strconv.Atoi(req.GetPageToken())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+
+	lots, err := c.store.ExpiringLots(ctx, inventory.LotFilter{
+		Within:      time.Duration(req.GetWithinDays()) * 24 * time.Hour,
+		ProductID:   req.GetProductId(),
+		WarehouseID: strings.TrimSpace(req.GetWarehouseId()),
+		Limit:       int(pageSize),
+		Offset:      offset,
+	})
+	if err != nil {
+		return nil, inventoryError(err)
+	}
+
+	response := &pb.ListExpiringLotsResponse{}
+	for _, lot := range lots {
+		response.Lots = append(response.Lots, lotToProto(lot))
+	}
+	if len(lots) == int(pageSize) {
+		response.NextPageToken = strconv.Itoa(offset + len(lots))
+	}
+	return response, nil
+}
+
+func (c *inventoryController) ReserveStock(ctx context.Context, req *pb.ReserveStockRequest) (*pb.ReserveStockResponse, error) {
+	if len(req.GetItems()) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "at least one item is required")
+	}
+	items := make([]inventory.ReservationItem, 0, len(req.GetItems()))
+	for _, item := range req.GetItems() {
+		if item.GetProductId() <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "product id is required")
+		}
+		if item.GetQuantity() <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "quantity of product %d must be positive", item.GetProductId())
+		}
+		if item.GetVariantId() < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "variant id must not be negative")
+		}
+		warehouseID := strings.TrimSpace(item.GetWarehouseId())
+		if len(warehouseID) > maxWarehouseIDLength {
+			return nil, status.Errorf(codes.InvalidArgument, "warehouse id must be at most %d characters", maxWarehouseIDLength)
+		}
+		items = append(items, inventory.ReservationItem{
+			ProductID:   item.GetProductId(),
+			VariantID:   item.GetVariantId(),
+			WarehouseID: warehouseID,
+			Quantity:    item.GetQuantity(),
+		})
+	}
+
+	ttl := c.reservationTTL
+	if req.GetTtlSeconds() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "ttl must not be negative")
+	}
+	if req.GetTtlSeconds() > 0 {
+		ttl = time.Duration(req.GetTtlSeconds()) * time.Second
+	}
+	if c.maxReservationTTL > 0 && ttl > c.maxReservationTTL {
+		ttl = c.maxReservationTTL
+	}
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+
+	reservation, err := c.store.Reserve(ctx, items, ttl)
+	if err != nil {
+		return nil, inventoryError(err)
+	}
+	c.reservationChanged(ctx, reservation)
+
+	return &pb.ReserveStockResponse{Reservation: reservationToProto(reservation)}, nil
+}
+
+func (c *inventoryController) CommitReservation(ctx context.Context, req *pb.CommitReservationRequest) (*pb.CommitReservationResponse, error) {
+	if req.GetReservationId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "reservation id is required")
+	}
+
+	reservation, err := c.store.Commit(ctx, req.GetReservationId())
+	if err != nil {
+		return nil, inventoryError(err)
+	}
+	c.reservationChanged(ctx, reservation)
+
+	return &pb.CommitReservationResponse{Reservation: reservationToProto(reservation)}, nil
+}
+
+func (c *inventoryController) ReleaseReservation(ctx context.Context, req *pb.ReleaseReservationRequest) (*pb.ReleaseReservationResponse, error) {
+	if req.GetReservationId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "reservation id is required")
+	}
+
+	reservation, err := c.store.Release(ctx, req.GetReservationId())
+	if err != nil {
+		return nil, inventoryError(err)
+	}
+	c.reservationChanged(ctx, reservation)
+
+	return &pb.ReleaseReservationResponse{Reservation: reservationToProto(reservation)}, nil
+}
+
+// reservationChanged evicts the products whose status or variant stock a
+// reservation changed.
+func (c *inventoryController) reservationChanged(ctx context.Context, reservation inventory.Reservation) {
+	for _, productID := range reservation.ChangedProducts {
+		productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, productID)
+	}
+}
+
+// inventoryError maps inventory errors to gRPC status errors.
+func inventoryError(err error) error {
+	switch {
+	case errors.Is(err, inventory.ErrProductNotFound):
+		return status.Errorf(codes.NotFound, "product not found")
+	case errors.Is(err, inventory.ErrVariantNotFound):
+		return status.Errorf(codes.NotFound, "%v", err)
+	case errors.Is(err, inventory.ErrInvalidLot):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, inventory.ErrReservationNotFound):
+		return status.Errorf(codes.NotFound, "reservation not found")
+	case errors.Is(err, inventory.ErrInsufficientStock),
+		errors.Is(err, inventory.ErrStockReserved),
+		errors.Is(err, inventory.ErrReservationClosed),
+		errors.Is(err, inventory.ErrReservationExpired):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	default:
+		return status.Errorf(codes.Internal, "%v", err)
+	}
+}
+
+func stockLevelToProto(level inventory.Level) *pb.StockLevel {
+	return &pb.StockLevel{
+		VariantId:   level.VariantID,
+		WarehouseId: level.WarehouseID,
+		OnHand:      level.OnHand,
+		Reserved:    level.Reserved,
+		Available:   level.Available,
+		UpdatedAt:   timestamppb.New(level.UpdatedAt),
+	}
+}
+
+func lotToProto(lot inventory.Lot) *pb.Lot {
+	return &pb.Lot{
+		Id:          lot.ID,
+		ProductId:   lot.ProductID,
+		VariantId:   lot.VariantID,
+		WarehouseId: lot.WarehouseID,
+		LotCode:     lot.Code,
+		Quantity:    lot.Quantity,
+		ReceivedAt:  timestamppb.New(lot.ReceivedAt),
+		BestBefore:  timestamppb.New(lot.BestBefore),
+		Expired:     lot.Expired,
+	}
+}
+
+func reservationToProto(reservation inventory.Reservation) *pb.Reservation {
+	message := &pb.Reservation{
+		Id:        reservation.ID,
+		Status:    pb.ReservationStatus(pb.ReservationStatus_value[reservation.Status]),
+		ExpiresAt: timestamppb.New(reservation.ExpiresAt),
+		CreatedAt: timestamppb.New(reservation.CreatedAt),
+	}
+	for _, item := range reservation.Items {
+		message.Items = append(message.Items, &pb.ReservationItem{
+			ProductId:   item.ProductID,
+			VariantId:   item.VariantID,
+			Quantity:    item.Quantity,
+			WarehouseId: item.WarehouseID,
+		})
+	}
+	return message
+}
+
+func productStatusFromString(value string) pb.ProductStatus {
+	return pb.ProductStatus(pb.ProductStatus_value[value])
+}
@@ -0,0 +1,390 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/access"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxTransitionNoteLength matches the note column.
+const maxTransitionNoteLength = 1000
+
+// errInvalidTransition is returned for transitions the lifecycle does not
+// allow from the current state of a product.
+var errInvalidTransition = errors.New("invalid lifecycle transition")
+
+// lifecycleSources lists, per target state, the states a product may move from.
+var lifecycleSources = map[pb.LifecycleState][]pb.LifecycleState{
+	pb.LifecycleState_LIFECYCLE_IN_REVIEW:    {pb.LifecycleState_LIFECYCLE_DRAFT},
+	pb.LifecycleState_LIFECYCLE_PUBLISHED:    {pb.LifecycleState_LIFECYCLE_IN_REVIEW},
+	pb.LifecycleState_LIFECYCLE_DRAFT:        {pb.LifecycleState_LIFECYCLE_IN_REVIEW},
+	pb.LifecycleState_LIFECYCLE_DISCONTINUED: {pb.LifecycleState_LIFECYCLE_PUBLISHED},
+	pb.LifecycleState_LIFECYCLE_ARCHIVED:     {pb.LifecycleState_LIFECYCLE_DISCONTINUED},
+}
+
+// LifecycleRoles names the roles allowed to move products through their lifecycle.
+type LifecycleRoles struct {
+	// Editors may submit, discontinue and archive products and see
+	// unpublished ones.
+	Editors []string
+	// Approvers may publish or reject products in review, and can do
+	// everything editors can.
+	Approvers []string
+}
+
+func (r LifecycleRoles) staff() []string {
+	return append(slices.Clone(r.Editors), r.Approvers...)
+}
+
+// lifecycleName returns the products.lifecycle value of state.
+func lifecycleName(state pb.LifecycleState) string {
+	return strings.TrimPrefix(state.String(), "LIFECYCLE_")
+}
+
+func lifecycleFromName(name string) pb.LifecycleState {
+	return pb.LifecycleState(pb.LifecycleState_value["LIFECYCLE_"+name])
+}
+
+// lifecycleGuard checks the preconditions of a transition on a locked product.
+type lifecycleGuard func(ctx context.Context, tx pgx.Tx, productID int64) error
+
+const transitionColumns = `id, product_id, from_state, to_state, actor, note, created_at`
+
+func scanTransition(row pgx.Row) (*pb.ProductTransition, error) {
+	var (
+		transition pb.ProductTransition
+		from, to   string
+		createdAt  time.Time
+	)
+	if err := row.Scan(&transition.Id, &transition.ProductId, &from, &to, &transition.Actor, &transition.Note, &createdAt); err != nil {
+		return nil, err
+	}
+	transition.From = lifecycleFromName(from)
+	transition.To = lifecycleFromName(to)
+	transition.CreatedAt = timestamppb.New(createdAt)
+	return &transition, nil
+}
+
+// transitionEvent returns the kind of event published for a transition.
+func transitionEvent(from, to pb.LifecycleState) events.Kind {
+	switch {
+	case to == pb.LifecycleState_LIFECYCLE_PUBLISHED:
+		return events.ProductPublished
+	case from == pb.LifecycleState_LIFECYCLE_PUBLISHED:
+		return events.ProductUnpublished
+	default:
+		return events.ProductUpdated
+	}
+}
+
+// transitionProduct moves a product to another lifecycle state if the
+// lifecycle allows it from its current state and guard passes, and records
+// the transition and its event in the same transaction. Discontinuing a
+// product also marks it DISCONTINUED. Callers evict the product from the
+// cache once it returns.
+func transitionProduct(ctx context.Context, pool database.Pool, publisher events.Publisher, productID int64, to pb.LifecycleState, actor, note string, guard lifecycleGuard) (*pb.ProductTransition, error) {
+	var transition *pb.ProductTransition
+	err := database.ExecuteTx(ctx, pool, func(tx pgx.Tx) error {
+		var current string
+		if err := tx.QueryRow(ctx, `SELECT lifecycle FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&current); err != nil {
+			return err
+		}
+		from := lifecycleFromName(current)
+		if !slices.Contains(lifecycleSources[to], from) {
+			return fmt.Errorf("%w: cannot move a product from %s to %s", errInvalidTransition, current, lifecycleName(to))
+		}
+		if guard != nil {
+			if err := guard(ctx, tx, productID); err != nil {
+				return err
+			}
+		}
+
+		// A schedule is used up by the transition it was for; a rejected
+		// product needs a new review before it can be scheduled again.
+		query := `
+		UPDATE products
+		SET
+			lifecycle = $2,
+			product_status = CASE WHEN $2 = 'DISCONTINUED' THEN 'DISCONTINUED' ELSE product_status END,
+			publish_at = CASE WHEN $2 IN ('PUBLISHED', 'DRAFT') THEN NULL ELSE publish_at END,
+			unpublish_at = CASE WHEN $2 = 'DISCONTINUED' THEN NULL ELSE unpublish_at END,
+			updated_at = now()
+		WHERE id = $1`
+		if _, err := tx.Exec(ctx, query, productID, lifecycleName(to)); err != nil {
+			return err
+		}
+
+		var err error
+		transition, err = scanTransition(tx.QueryRow(ctx, `
+		INSERT INTO product_transitions (product_id, from_state, to_state, actor, note)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+transitionColumns, productID, current, lifecycleName(to), actor, note))
+		if err != nil {
+			return err
+		}
+
+		payload, err := protojson.Marshal(transition)
+		if err != nil {
+			return err
+		}
+		return publisher.PublishTx(ctx, tx, events.Event{Kind: transitionEvent(from, to), ProductID: productID, Payload: payload})
+	})
+	return transition, err
+}
+
+// readyForReview requires the content a product needs before anyone reviews it.
+func readyForReview(ctx context.Context, tx pgx.Tx, productID int64) error {
+	var (
+		name, description, category string
+		priced                      bool
+	)
+	query := `SELECT name, COALESCE(description, ''), COALESCE(category, ''), price > 0 FROM products WHERE id = $1`
+	if err := tx.QueryRow(ctx, query, productID).Scan(&name, &description, &category, &priced); err != nil {
+		return err
+	}
+
+	var missing []string
+	if strings.TrimSpace(name) == "" {
+		missing = append(missing, "name")
+	}
+	if strings.TrimSpace(description) == "" {
+		missing = append(missing, "description")
+	}
+	if category == "" {
+		missing = append(missing, "category")
+	}
+	if !priced {
+		missing = append(missing, "price")
+	}
+	if len(missing) > 0 {
+		return status.Errorf(codes.FailedPrecondition, "product is not ready for review, missing: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// notSubmittedBy keeps whoever submitted a product for review from approving
+// it. Approvers must identify themselves, or they could not be told apart
+// from the submitter.
+func notSubmittedBy(approver string) lifecycleGuard {
+	return func(ctx context.Context, tx pgx.Tx, productID int64) error {
+		if approver == "" {
+			return status.Errorf(codes.PermissionDenied, "approving a product requires an identified caller")
+		}
+		var submitter string
+		query := `SELECT actor FROM product_transitions WHERE product_id = $1 AND to_state = 'IN_REVIEW' AND actor <> '' ORDER BY created_at DESC LIMIT 1`
+		err := tx.QueryRow(ctx, query, productID).Scan(&submitter)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if submitter == approver {
+			return status.Errorf(codes.PermissionDenied, "products cannot be approved by whoever submitted them")
+		}
+		return nil
+	}
+}
+
+// authorize returns the caller if it has one of roles.
+func authorize(ctx context.Context, action string, roles []string) (access.Principal, error) {
+	principal := access.FromContext(ctx)
+	if !principal.HasAny(roles...) {
+		return principal, status.Errorf(codes.PermissionDenied, "%s requires one of the roles: %s", action, strings.Join(roles, ", "))
+	}
+	return principal, nil
+}
+
+// visible reports whether the caller may read a product in state: the public
+// sees published products only.
+func (r LifecycleRoles) visible(ctx context.Context, state pb.LifecycleState) bool {
+	return state == pb.LifecycleState_LIFECYCLE_PUBLISHED || access.FromContext(ctx).HasAny(r.staff()...)
+}
+
+// lockForEdit locks a product whose content, such as its variants,
+// translations or media, is about to change in tx. Like UpdateProduct, it
+// refuses archived products and drops the publication schedule of a product
+// in review, which approved the content as it was. Unknown products return
+// pgx.ErrNoRows.
+func lockForEdit(ctx context.Context, tx pgx.Tx, productID int64) error {
+	var lifecycle string
+	if err := tx.QueryRow(ctx, `SELECT lifecycle FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&lifecycle); err != nil {
+		return err
+	}
+	switch lifecycleFromName(lifecycle) {
+	case pb.LifecycleState_LIFECYCLE_ARCHIVED:
+		return status.Errorf(codes.FailedPrecondition, "archived products cannot be changed")
+	case pb.LifecycleState_LIFECYCLE_IN_REVIEW:
+		_, err := tx.Exec(ctx, `UPDATE products SET publish_at = NULL WHERE id = $1`, productID)
+		return err
+	}
+	return nil
+}
+
+// visibleLifecycles returns the lifecycle states ListProducts may return to
+// the caller, or nil for all of them.
+func (c *productController) visibleLifecycles(ctx context.Context, requested []pb.LifecycleState) ([]string, error) {
+	if !access.FromContext(ctx).HasAny(c.roles.staff()...) {
+		if len(requested) > 0 {
+			return nil, status.Errorf(codes.PermissionDenied, "only staff can filter on lifecycle")
+		}
+		return []string{lifecycleName(pb.LifecycleState_LIFECYCLE_PUBLISHED)}, nil
+	}
+
+	var names []string
+	for _, state := range requested {
+		if state == pb.LifecycleState_LIFECYCLE_UNSPECIFIED {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid lifecycle filter")
+		}
+		if name := lifecycleName(state); !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// transition runs a lifecycle RPC: it checks the caller's roles and the
+// note, moves the product and drops cached copies of it.
+func (c *productController) transition(ctx context.Context, productID int64, to pb.LifecycleState, roles []string, note string, guards ...lifecycleGuard) (*pb.ProductTransition, error) {
+	if productID <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
+	}
+	if len(note) > maxTransitionNoteLength {
+		return nil, status.Errorf(codes.InvalidArgument, "note must be at most %d characters", maxTransitionNoteLength)
+	}
+	action := "moving a product to " + lifecycleName(to)
+	principal, err := authorize(ctx, action, roles)
+	if err != nil {
+		return nil, err
+	}
+
+	guard := func(ctx context.Context, tx pgx.Tx, productID int64) error {
+		for _, guard := range guards {
+			if err := guard(ctx, tx, productID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	transition, err := transitionProduct(ctx, c.pool, c.publisher, productID, to, principal.Subject, note, guard)
+	if err != nil {
+		return nil, lifecycleError(err)
+	}
+
+	evictProduct(ctx, c.cache, productID)
+	return transition, nil
+}
+
+func (c *productController) SubmitProductForReview(ctx context.Context, req *pb.SubmitProductForReviewRequest) (*pb.SubmitProductForReviewResponse, error) {
+	// The submitter is recorded so that it cannot approve its own submission.
+	if access.FromContext(ctx).Subject == "" {
+		return nil, status.Errorf(codes.PermissionDenied, "submitting a product for review requires an identified caller")
+	}
+	transition, err := c.transition(ctx, req.GetProductId(), pb.LifecycleState_LIFECYCLE_IN_REVIEW, c.roles.staff(), req.GetNote(), readyForReview)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SubmitProductForReviewResponse{Transition: transition}, nil
+}
+
+func (c *productController) ApproveProduct(ctx context.Context, req *pb.ApproveProductRequest) (*pb.ApproveProductResponse, error) {
+	approver := access.FromContext(ctx).Subject
+	transition, err := c.transition(ctx, req.GetProductId(), pb.LifecycleState_LIFECYCLE_PUBLISHED, c.roles.Approvers, req.GetNote(), readyForReview, notSubmittedBy(approver))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ApproveProductResponse{Transition: transition}, nil
+}
+
+func (c *productController) RejectProduct(ctx context.Context, req *pb.RejectProductRequest) (*pb.RejectProductResponse, error) {
+	if strings.TrimSpace(req.GetNote()) == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "a note explaining the rejection is required")
+	}
+	transition, err := c.transition(ctx, req.GetProductId(), pb.LifecycleState_LIFECYCLE_DRAFT, c.roles.Approvers, req.GetNote())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RejectProductResponse{Transition: transition}, nil
+}
+
+func (c *productController) DiscontinueProduct(ctx context.Context, req *pb.DiscontinueProductRequest) (*pb.DiscontinueProductResponse, error) {
+	transition, err := c.transition(ctx, req.GetProductId(), pb.LifecycleState_LIFECYCLE_DISCONTINUED, c.roles.staff(), req.GetNote())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DiscontinueProductResponse{Transition: transition}, nil
+}
+
+func (c *productController) ArchiveProduct(ctx context.Context, req *pb.ArchiveProductRequest) (*pb.ArchiveProductResponse, error) {
+	transition, err := c.transition(ctx, req.GetProductId(), pb.LifecycleState_LIFECYCLE_ARCHIVED, c.roles.staff(), req.GetNote())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ArchiveProductResponse{Transition: transition}, nil
+}
+
+func (c *productController) ListProductTransitions(ctx context.Context, req *pb.ListProductTransitionsRequest) (*pb.ListProductTransitionsResponse, error) {
+	if _, err := authorize(ctx, "listing lifecycle transitions", c.roles.staff()); err != nil {
+		return nil, err
+	}
+	pageSize := clampPageSize(req.GetPageSize(), 50)
+	offset := 0
+	if req.GetPageToken() != "" {
+		var err error
+		if offset, err = strconv.Atoi(req.GetPageToken()); err != nil || offset < 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+
+	query := `SELECT ` + transitionColumns + ` FROM product_transitions WHERE product_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3`
+	rows, err := c.pool.Query(ctx, query, req.GetProductId(), pageSize, offset)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list transitions: %v", err)
+	}
+	defer rows.Close()
+
+	transitions := []*pb.ProductTransition{}
+	for rows.Next() {
+		transition, err := scanTransition(rows)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to scan transition: %v", err)
+		}
+		transitions = append(transitions, transition)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list transitions: %v", err)
+	}
+
+	nextPageToken := ""
+	if len(transitions) == int(pageSize) {
+		nextPageToken = strconv.Itoa(offset + len(transitions))
+	}
+	return &pb.ListProductTransitionsResponse{Transitions: transitions, NextPageToken: nextPageToken}, nil
+}
+
+// lifecycleError maps errors of lifecycle transitions to gRPC status errors.
+func lifecycleError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return status.Errorf(codes.NotFound, "product not found")
+	case errors.Is(err, errInvalidTransition):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	default:
+		return status.Errorf(codes.Internal, "failed to change product lifecycle: %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/locales"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const lockProductQuery = `SELECT lifecycle FROM products WHERE id = $1 FOR UPDATE`
+
+func TestWritesRequireStaff(t *testing.T) {
+	resolver, err := locales.NewResolver("en", []string{"en", "fr"}, nil)
+	if err != nil {
+		t.Fatalf("NewResolver: %v", err)
+	}
+	anonymous := context.Background()
+	customer := callerWith("alice", "customer")
+
+	tests := []struct {
+		name string
+		call func(ctx context.Context, products *productController, translations *translationController, media *mediaController) error
+	}{
+		{"CreateProduct", func(ctx context.Context, c *productController, _ *translationController, _ *mediaController) error {
+			_, err := c.CreateProduct(ctx, &pb.CreateProductRequest{Name: "Desk"})
+			return err
+		}},
+		{"DeleteProduct", func(ctx context.Context, c *productController, _ *translationController, _ *mediaController) error {
+			_, err := c.DeleteProduct(ctx, &pb.DeleteProductRequest{ProductId: 1})
+			return err
+		}},
+		{"AddVariant", func(ctx context.Context, c *productController, _ *translationController, _ *mediaController) error {
+			_, err := c.AddVariant(ctx, &pb.AddVariantRequest{Variant: &pb.ProductVariant{ProductId: 1}})
+			return err
+		}},
+		{"UpdateVariant", func(ctx context.Context, c *productController, _ *translationController, _ *mediaController) error {
+			_, err := c.UpdateVariant(ctx, &pb.UpdateVariantRequest{Variant: &pb.ProductVariant{Id: 2}})
+			return err
+		}},
+		{"RemoveVariant", func(ctx context.Context, c *productController, _ *translationController, _ *mediaController) error {
+			_, err := c.RemoveVariant(ctx, &pb.RemoveVariantRequest{VariantId: 2})
+			return err
+		}},
+		{"SetProductTranslation", func(ctx context.Context, _ *productController, c *translationController, _ *mediaController) error {
+			_, err := c.SetProductTranslation(ctx, &pb.SetProductTranslationRequest{ProductId: 1, Translation: &pb.ProductTranslation{Locale: "fr", Name: "Bureau"}})
+			return err
+		}},
+		{"DeleteProductTranslation", func(ctx context.Context, _ *productController, c *translationController, _ *mediaController) error {
+			_, err := c.DeleteProductTranslation(ctx, &pb.DeleteProductTranslationRequest{ProductId: 1, Locale: "fr"})
+			return err
+		}},
+		{"ReorderProductMedia", func(ctx context.Context, _ *productController, _ *translationController, c *mediaController) error {
+			_, err := c.ReorderProductMedia(ctx, &pb.ReorderProductMediaRequest{ProductId: 1, MediaIds: []int64{3}})
+			return err
+		}},
+		{"DeleteProductMedia", func(ctx context.Context, _ *productController, _ *translationController, c *mediaController) error {
+			_, err := c.DeleteProductMedia(ctx, &pb.DeleteProductMediaRequest{MediaId: 3})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		for _, ctx := range []context.Context{anonymous, customer} {
+			t.Run(tt.name, func(t *testing.T) {
+				// The mock expects no queries: nothing may be read or written.
+				pool := newMockPool(t)
+				products, _, _ := newTestProductController(pool)
+				translations := &translationController{pool: pool, cache: products.cache, publisher: products.publisher, locales: resolver, roles: testRoles}
+				media := &mediaController{pool: pool, cache: products.cache, publisher: products.publisher, store: products.blobs, roles: testRoles}
+				wantCode(t, tt.call(ctx, products, translations, media), codes.PermissionDenied)
+			})
+		}
+	}
+}
+
+func TestDeleteProductRequiresArchived(t *testing.T) {
+	for _, lifecycle := range []string{"DRAFT", "IN_REVIEW", "PUBLISHED", "DISCONTINUED"} {
+		t.Run(lifecycle, func(t *testing.T) {
+			pool := newMockPool(t)
+			pool.ExpectBeginTx(txOptions)
+			pool.ExpectQuery(regexp.QuoteMeta(lockProductQuery)).WithArgs(int64(1)).
+				WillReturnRows(pgxmock.NewRows([]string{"lifecycle"}).AddRow(lifecycle))
+			expectRollback(pool)
+
+			c, publisher, blobs := newTestProductController(pool)
+			_, err := c.DeleteProduct(callerWith("ed", "catalog-editor"), &pb.DeleteProductRequest{ProductId: 1})
+			wantCode(t, err, codes.FailedPrecondition)
+			if len(publisher.events) != 0 || len(blobs.deleted) != 0 {
+				t.Errorf("a refused delete published %v and deleted blobs %v", publisher.kinds(), blobs.deleted)
+			}
+		})
+	}
+}
+
+func TestDeleteArchivedProduct(t *testing.T) {
+	pool := newMockPool(t)
+	pool.ExpectBeginTx(txOptions)
+	pool.ExpectQuery(regexp.QuoteMeta(lockProductQuery)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"lifecycle"}).AddRow("ARCHIVED"))
+	// Blob keys are read by the delete itself, in the same transaction.
+	pool.ExpectQuery(regexp.QuoteMeta(`DELETE FROM product_media WHERE product_id = $1 RETURNING blob_key, thumbnail_key`)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"blob_key", "thumbnail_key"}).
+			AddRow("products/1/10.png", "products/1/10-thumb.jpg").
+			AddRow("products/1/11.mp4", ""))
+	pool.ExpectExec(regexp.QuoteMeta(`DELETE FROM products WHERE id = $1`)).WithArgs(int64(1)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	expectCommit(pool)
+
+	c, publisher, blobs := newTestProductController(pool)
+	response, err := c.DeleteProduct(callerWith("ed", "catalog-editor"), &pb.DeleteProductRequest{ProductId: 1})
+	if err != nil {
+		t.Fatalf("DeleteProduct: %v", err)
+	}
+	if !response.GetDeleted() {
+		t.Error("Deleted = false, want true")
+	}
+	if want := []string{"products/1/10.png", "products/1/10-thumb.jpg", "products/1/11.mp4"}; !slices.Equal(blobs.deleted, want) {
+		t.Errorf("deleted blobs %v, want %v", blobs.deleted, want)
+	}
+	if want := []events.Kind{events.ProductDeleted}; !slices.Equal(publisher.kinds(), want) {
+		t.Errorf("published %v, want %v", publisher.kinds(), want)
+	}
+}
+
+func TestDeleteMissingProduct(t *testing.T) {
+	pool := newMockPool(t)
+	pool.ExpectBeginTx(txOptions)
+	pool.ExpectQuery(regexp.QuoteMeta(lockProductQuery)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"lifecycle"}))
+	expectRollback(pool)
+
+	c, _, _ := newTestProductController(pool)
+	_, err := c.DeleteProduct(callerWith("ed", "catalog-editor"), &pb.DeleteProductRequest{ProductId: 1})
+	wantCode(t, err, codes.NotFound)
+}
+
+func TestLockForEdit(t *testing.T) {
+	tests := []struct {
+		lifecycle      string
+		wantCode       codes.Code
+		clearsSchedule bool
+	}{
+		{"DRAFT", codes.OK, false},
+		{"IN_REVIEW", codes.OK, true},
+		{"PUBLISHED", codes.OK, false},
+		{"DISCONTINUED", codes.OK, false},
+		{"ARCHIVED", codes.FailedPrecondition, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lifecycle, func(t *testing.T) {
+			ctx := context.Background()
+			pool := newMockPool(t)
+			pool.ExpectBegin()
+			pool.ExpectQuery(regexp.QuoteMeta(lockProductQuery)).WithArgs(int64(1)).
+				WillReturnRows(pgxmock.NewRows([]string{"lifecycle"}).AddRow(tt.lifecycle))
+			if tt.clearsSchedule {
+				pool.ExpectExec(regexp.QuoteMeta(`UPDATE products SET publish_at = NULL WHERE id = $1`)).WithArgs(int64(1)).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			}
+
+			tx, err := pool.Begin(ctx)
+			if err != nil {
+				t.Fatalf("Begin: %v", err)
+			}
+			wantCode(t, lockForEdit(ctx, tx, 1), tt.wantCode)
+		})
+	}
+
+	t.Run("missing product", func(t *testing.T) {
+		ctx := context.Background()
+		pool := newMockPool(t)
+		pool.ExpectBegin()
+		pool.ExpectQuery(regexp.QuoteMeta(lockProductQuery)).WithArgs(int64(1)).
+			WillReturnRows(pgxmock.NewRows([]string{"lifecycle"}))
+
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		if err := lockForEdit(ctx, tx, 1); !errors.Is(err, pgx.ErrNoRows) {
+			t.Fatalf("lockForEdit = %v, want pgx.ErrNoRows", err)
+		}
+	})
+}
+
+func TestRemoveVariantOfArchivedProduct(t *testing.T) {
+	pool := newMockPool(t)
+	pool.ExpectBeginTx(txOptions)
+	pool.ExpectQuery(regexp.QuoteMeta(`SELECT product_id FROM product_variants WHERE id = $1 FOR UPDATE`)).WithArgs(int64(2)).
+		WillReturnRows(pgxmock.NewRows([]string{"product_id"}).AddRow(int64(1)))
+	pool.ExpectQuery(regexp.QuoteMeta(lockProductQuery)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"lifecycle"}).AddRow("ARCHIVED"))
+	expectRollback(pool)
+
+	c, publisher, _ := newTestProductController(pool)
+	_, err := c.RemoveVariant(callerWith("ed", "catalog-editor"), &pb.RemoveVariantRequest{VariantId: 2})
+	wantCode(t, err, codes.FailedPrecondition)
+	if len(publisher.events) != 0 {
+		t.Errorf("a refused change published %v", publisher.kinds())
+	}
+}
+
+func TestListProductTransitionsClampsPageSize(t *testing.T) {
+	pool := newMockPool(t)
+	pool.ExpectQuery(regexp.QuoteMeta(`FROM product_transitions WHERE product_id = $1`)).WithArgs(int64(1), int32(maxPageSize), 0).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "product_id", "from_state", "to_state", "actor", "note", "created_at"}))
+
+	c, _, _ := newTestProductController(pool)
+	if _, err := c.ListProductTransitions(callerWith("ed", "catalog-editor"), &pb.ListProductTransitionsRequest{ProductId: 1, PageSize: 1_000_000}); err != nil {
+		t.Fatalf("ListProductTransitions: %v", err)
+	}
+}
+
+// downloadStream collects the messages of DownloadProductMedia.
+type downloadStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent []*pb.DownloadProductMediaResponse
+}
+
+func (s *downloadStream) Context() context.Context { return s.ctx }
+
+func (s *downloadStream) Send(response *pb.DownloadProductMediaResponse) error {
+	s.sent = append(s.sent, response)
+	return nil
+}
+
+func TestDownloadMediaOfUnpublishedProduct(t *testing.T) {
+	pool := newMockPool(t)
+	pool.ExpectQuery(regexp.QuoteMeta(`FROM product_media`)).WithArgs(int64(3)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "product_id", "kind", "content_type", "filename", "alt_text", "size_bytes", "position", "blob_key", "thumbnail_key", "created_at", "lifecycle"}).
+			AddRow(int64(3), int64(1), "MEDIA_KIND_IMAGE", "image/png", "desk.png", "", int64(100), int32(0), "products/1/3.png", "", time.Time{}, "DRAFT"))
+
+	c := &mediaController{pool: pool, store: &recordingBlobStore{}, roles: testRoles}
+	stream := &downloadStream{ctx: callerWith("alice", "customer")}
+	wantCode(t, c.DownloadProductMedia(&pb.DownloadProductMediaRequest{MediaId: 3}, stream), codes.NotFound)
+	if len(stream.sent) != 0 {
+		t.Errorf("sent %d messages about hidden media", len(stream.sent))
+	}
+}
+
+func TestFindDuplicatesHidesUnpublishedProducts(t *testing.T) {
+	t.Run("of an unpublished product", func(t *testing.T) {
+		pool := newMockPool(t)
+		pool.ExpectQuery(regexp.QuoteMeta(`, lifecycle FROM products WHERE id = $1`)).WithArgs(int64(1)).
+			WillReturnRows(pgxmock.NewRows([]string{"id", "name", "category_id", "category", "product_type", "variation", "lifecycle"}).
+				AddRow(int64(1), "Oak desk", int64(0), "", "", []byte(nil), "DRAFT"))
+
+		c, _, _ := newTestProductController(pool)
+		_, err := c.FindDuplicates(callerWith("alice", "customer"), &pb.FindDuplicatesRequest{ProductId: 1})
+		wantCode(t, err, codes.NotFound)
+	})
+
+	candidates := []string{"id", "name", "category_id", "category", "product_type", "variation"}
+	t.Run("public", func(t *testing.T) {
+		pool := newMockPool(t)
+		pool.ExpectQuery(regexp.QuoteMeta(`AND lifecycle = ANY($4)`)).WithArgs("oak desk", int64(0), maxDuplicateCandidates, []string{"PUBLISHED"}).
+			WillReturnRows(pgxmock.NewRows(candidates))
+
+		c, _, _ := newTestProductController(pool)
+		if _, err := c.FindDuplicates(callerWith("alice", "customer"), &pb.FindDuplicatesRequest{Name: "Oak desk"}); err != nil {
+			t.Fatalf("FindDuplicates: %v", err)
+		}
+	})
+
+	t.Run("staff", func(t *testing.T) {
+		pool := newMockPool(t)
+		pool.ExpectQuery(`similarity`).WithArgs("oak desk", int64(0), maxDuplicateCandidates).
+			WillReturnRows(pgxmock.NewRows(candidates))
+
+		c, _, _ := newTestProductController(pool)
+		if _, err := c.FindDuplicates(callerWith("ed", "catalog-editor"), &pb.FindDuplicatesRequest{Name: "Oak desk"}); err != nil {
+			t.Fatalf("FindDuplicates: %v", err)
+		}
+	})
+}
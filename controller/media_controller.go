@@ -0,0 +1,436 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/media"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/sonyflake"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	maxFilenameLength = 255
+	maxAltTextLength  = 1000
+	// downloadChunkSize stays well below the default 4 MiB gRPC message limit.
+	downloadChunkSize = 64 * 1024
+)
+
+const mediaColumns = `id, product_id, kind, content_type, filename, alt_text, size_bytes, position, blob_key, thumbnail_key, created_at`
+
+// storedMedia is a product_media row with the keys of its blobs.
+type storedMedia struct {
+	media        *pb.ProductMedia
+	blobKey      string
+	thumbnailKey string
+}
+
+// scanMedia scans a row of mediaColumns, followed by any extra columns.
+func scanMedia(row pgx.Row, publicURL string, extra ...interface{}) (storedMedia, error) {
+	var (
+		stored    = storedMedia{media: &pb.ProductMedia{}}
+		kind      string
+		createdAt time.Time
+	)
+	m := stored.media
+	dest := []interface{}{&m.Id, &m.ProductId, &kind, &m.ContentType, &m.Filename, &m.AltText, &m.SizeBytes, &m.Position, &stored.blobKey, &stored.thumbnailKey, &createdAt}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return storedMedia{}, err
+	}
+	m.Kind = pb.MediaKind(pb.MediaKind_value[kind])
+	m.Url = mediaURL(publicURL, stored.blobKey)
+	m.ThumbnailUrl = mediaURL(publicURL, stored.thumbnailKey)
+	m.CreatedAt = timestamppb.New(createdAt)
+	return stored, nil
+}
+
+// mediaURL returns the public URL of a blob, or an empty string when blobs
+// are not served publicly.
+func mediaURL(publicURL, key string) string {
+	if publicURL == "" || key == "" {
+		return ""
+	}
+	return strings.TrimRight(publicURL, "/") + "/" + key
+}
+
+// loadMedia returns the media of the given products ordered by position.
+func loadMedia(ctx context.Context, pool database.Pool, publicURL string, productIDs []int64) (map[int64][]*pb.ProductMedia, error) {
+	list := make(map[int64][]*pb.ProductMedia, len(productIDs))
+	if len(productIDs) == 0 {
+		return list, nil
+	}
+
+	rows, err := pool.Query(ctx, `SELECT `+mediaColumns+` FROM product_media WHERE product_id = ANY($1) ORDER BY product_id, position, id`, productIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load media: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		stored, err := scanMedia(rows, publicURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan media: %w", err)
+		}
+		list[stored.media.ProductId] = append(list[stored.media.ProductId], stored.media)
+	}
+	return list, rows.Err()
+}
+
+// deleteMediaRows deletes the media rows of a product and returns the keys of
+// their blobs, for the caller to delete once tx committed.
+func deleteMediaRows(ctx context.Context, tx pgx.Tx, productID int64) ([]string, error) {
+	rows, err := tx.Query(ctx, `DELETE FROM product_media WHERE product_id = $1 RETURNING blob_key, thumbnail_key`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete media: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var blobKey, thumbnailKey string
+		if err := rows.Scan(&blobKey, &thumbnailKey); err != nil {
+			return nil, fmt.Errorf("failed to scan media: %w", err)
+		}
+		keys = append(keys, blobKey)
+		if thumbnailKey != "" {
+			keys = append(keys, thumbnailKey)
+		}
+	}
+	return keys, rows.Err()
+}
+
+// deleteBlobs removes blobs whose rows are gone. Failures only leave
+// unreferenced blobs behind, so they are logged rather than returned.
+func deleteBlobs(ctx context.Context, store media.BlobStore, keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := store.Delete(ctx, key); err != nil {
+			slog.Warn("failed to delete media blob", "key", key, "error", err)
+		}
+	}
+}
+
+type mediaController struct {
+	pool           database.Pool
+	cache          database.CacheMethods
+	publisher      events.Publisher
+	store          media.BlobStore
+	publicURL      string
+	maxUploadBytes int64
+	thumbnailSize  int
+	maxImagePixels int64
+	roles          LifecycleRoles
+	pb.UnimplementedMediaServiceServer
+}
+
+// NewMediaController returns an instance that implements pb.MediaServiceServer.
+// Only staff in roles may change media or download that of unpublished
+// products.
+func NewMediaController(pool database.Pool, cache database.CacheMethods, publisher events.Publisher, store media.BlobStore, publicURL string, maxUploadBytes int64, thumbnailSize int, maxImagePixels int64, roles LifecycleRoles) pb.MediaServiceServer {
+	if maxUploadBytes <= 0 {
+		maxUploadBytes = 10 << 20
+	}
+	if thumbnailSize <= 0 {
+		thumbnailSize = 256
+	}
+	if maxImagePixels <= 0 {
+		maxImagePixels = 40_000_000
+	}
+	return &mediaController{
+		pool:           pool,
+		cache:          cache,
+		publisher:      publisher,
+		store:          store,
+		publicURL:      publicURL,
+		maxUploadBytes: maxUploadBytes,
+		thumbnailSize:  thumbnailSize,
+		maxImagePixels: maxImagePixels,
+		roles:          roles,
+	}
+}
+
+func (c *mediaController) UploadProductMedia(stream pb.MediaService_UploadProductMediaServer) error {
+	ctx := stream.Context()
+	if _, err := authorize(ctx, "uploading media", c.roles.staff()); err != nil {
+		return err
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "metadata is required: %v", err)
+	}
+	metadata := first.GetMetadata()
+	if metadata == nil {
+		return status.Errorf(codes.InvalidArgument, "the first message must carry the metadata")
+	}
+	if metadata.GetProductId() <= 0 {
+		return status.Errorf(codes.InvalidArgument, "product id is required")
+	}
+	filename := filepath.Base(strings.TrimSpace(metadata.GetFilename()))
+	if filename == "." || filename == "/" || len(filename) > maxFilenameLength {
+		return status.Errorf(codes.InvalidArgument, "filename must be 1 to %d characters", maxFilenameLength)
+	}
+	if len(metadata.GetAltText()) > maxAltTextLength {
+		return status.Errorf(codes.InvalidArgument, "alt text must be at most %d characters", maxAltTextLength)
+	}
+
+	var content bytes.Buffer
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if req.GetMetadata() != nil {
+			return status.Errorf(codes.InvalidArgument, "metadata must only be sent first")
+		}
+		if int64(content.Len()+len(req.GetChunk())) > c.maxUploadBytes {
+			return status.Errorf(codes.InvalidArgument, "media must be at most %d bytes", c.maxUploadBytes)
+		}
+		content.Write(req.GetChunk())
+	}
+	if content.Len() == 0 {
+		return status.Errorf(codes.InvalidArgument, "media is empty")
+	}
+
+	contentType, kind, extension, err := media.Sniff(content.Bytes())
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	// Checked again under lock when the media is recorded, but refusing
+	// early avoids storing blobs that would be deleted right away.
+	var lifecycle string
+	if err := c.pool.QueryRow(ctx, `SELECT lifecycle FROM products WHERE id = $1`, metadata.GetProductId()).Scan(&lifecycle); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return status.Errorf(codes.NotFound, "product not found")
+		}
+		return status.Errorf(codes.Internal, "failed to read product: %v", err)
+	}
+	if lifecycleFromName(lifecycle) == pb.LifecycleState_LIFECYCLE_ARCHIVED {
+		return status.Errorf(codes.FailedPrecondition, "archived products cannot be changed")
+	}
+
+	var thumbnail []byte
+	if kind == media.KindImage {
+		if thumbnail, err = media.Thumbnail(content.Bytes(), c.thumbnailSize, c.maxImagePixels); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid image: %v", err)
+		}
+	}
+
+	id, err := sonyflake.GenerateID()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to generate media id: %v", err)
+	}
+	prefix := fmt.Sprintf("products/%d/%d", metadata.GetProductId(), id)
+	blobKey := prefix + extension
+	if err := c.store.Put(ctx, blobKey, bytes.NewReader(content.Bytes()), int64(content.Len()), contentType); err != nil {
+		return status.Errorf(codes.Internal, "failed to store media: %v", err)
+	}
+	var thumbnailKey string
+	if thumbnail != nil {
+		thumbnailKey = prefix + "-thumb.jpg"
+		if err := c.store.Put(ctx, thumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), "image/jpeg"); err != nil {
+			deleteBlobs(ctx, c.store, blobKey)
+			return status.Errorf(codes.Internal, "failed to store thumbnail: %v", err)
+		}
+	}
+
+	var stored storedMedia
+	err = database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		if err := lockForEdit(ctx, tx, metadata.GetProductId()); err != nil {
+			return err
+		}
+		query := `
+		INSERT INTO product_media (id, product_id, kind, content_type, filename, alt_text, size_bytes, position, blob_key, thumbnail_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, (SELECT COALESCE(max(position) + 1, 0) FROM product_media WHERE product_id = $2), $8, $9)
+		RETURNING ` + mediaColumns
+		var err error
+		stored, err = scanMedia(tx.QueryRow(ctx, query, int64(id), metadata.GetProductId(), string(kind), contentType, filename, metadata.GetAltText(), content.Len(), blobKey, thumbnailKey), c.publicURL)
+		return err
+	})
+	if err != nil {
+		deleteBlobs(ctx, c.store, blobKey, thumbnailKey)
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		if errors.Is(err, pgx.ErrNoRows) || database.IsForeignKeyViolation(err) {
+			return status.Errorf(codes.NotFound, "product not found")
+		}
+		return status.Errorf(codes.Internal, "failed to record media: %v", err)
+	}
+
+	productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, metadata.GetProductId())
+	return stream.SendAndClose(&pb.UploadProductMediaResponse{Media: stored.media})
+}
+
+func (c *mediaController) DownloadProductMedia(req *pb.DownloadProductMediaRequest, stream pb.MediaService_DownloadProductMediaServer) error {
+	ctx := stream.Context()
+	query := `
+	SELECT ` + mediaColumns + `, (SELECT lifecycle FROM products WHERE products.id = product_media.product_id)
+	FROM product_media
+	WHERE id = $1`
+	var lifecycle string
+	stored, err := scanMedia(c.pool.QueryRow(ctx, query, req.GetMediaId()), c.publicURL, &lifecycle)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return status.Errorf(codes.NotFound, "media not found")
+		}
+		return status.Errorf(codes.Internal, "failed to read media: %v", err)
+	}
+	// Media of products the caller cannot see does not exist for them.
+	if !c.roles.visible(ctx, lifecycleFromName(lifecycle)) {
+		return status.Errorf(codes.NotFound, "media not found")
+	}
+	key := stored.blobKey
+	if req.GetThumbnail() {
+		if stored.thumbnailKey == "" {
+			return status.Errorf(codes.FailedPrecondition, "media %d has no thumbnail", req.GetMediaId())
+		}
+		key = stored.thumbnailKey
+	}
+
+	blob, err := c.store.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, media.ErrNotFound) {
+			return status.Errorf(codes.NotFound, "%v", err)
+		}
+		return status.Errorf(codes.Internal, "failed to read media: %v", err)
+	}
+	defer blob.Close()
+
+	if err := stream.Send(&pb.DownloadProductMediaResponse{Data: &pb.DownloadProductMediaResponse_Media{Media: stored.media}}); err != nil {
+		return err
+	}
+	buf := make([]byte, downloadChunkSize)
+	for {
+		n, err := io.ReadFull(blob, buf)
+		if n > 0 {
+			if err := stream.Send(&pb.DownloadProductMediaResponse{Data: &pb.DownloadProductMediaResponse_Chunk{Chunk: buf[:n]}}); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read media: %v", err)
+		}
+	}
+}
+
+func (c *mediaController) ReorderProductMedia(ctx context.Context, req *pb.ReorderProductMediaRequest) (*pb.ReorderProductMediaResponse, error) {
+	if _, err := authorize(ctx, "reordering media", c.roles.staff()); err != nil {
+		return nil, err
+	}
+	err := database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		if err := lockForEdit(ctx, tx, req.GetProductId()); err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, `SELECT id FROM product_media WHERE product_id = $1 FOR UPDATE`, req.GetProductId())
+		if err != nil {
+			return err
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err != nil {
+			return err
+		}
+		if !sameIDs(ids, req.GetMediaIds()) {
+			return status.Errorf(codes.InvalidArgument, "media_ids must list each of the %d media of the product exactly once", len(ids))
+		}
+
+		for position, id := range req.GetMediaIds() {
+			if _, err := tx.Exec(ctx, `UPDATE product_media SET position = $2 WHERE id = $1`, id, position); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, status.Errorf(codes.NotFound, "product not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to reorder media: %v", err)
+	}
+
+	productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, req.GetProductId())
+
+	list, err := loadMedia(ctx, c.pool, c.publicURL, []int64{req.GetProductId()})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	return &pb.ReorderProductMediaResponse{Media: list[req.GetProductId()]}, nil
+}
+
+// sameIDs reports whether want holds exactly the ids in have, each once.
+func sameIDs(have, want []int64) bool {
+	if len(have) != len(want) {
+		return false
+	}
+	remaining := make(map[int64]bool, len(have))
+	for _, id := range have {
+		remaining[id] = true
+	}
+	for _, id := range want {
+		if !remaining[id] {
+			return false
+		}
+		delete(remaining, id)
+	}
+	return true
+}
+
+func (c *mediaController) DeleteProductMedia(ctx context.Context, req *pb.DeleteProductMediaRequest) (*pb.DeleteProductMediaResponse, error) {
+	if _, err := authorize(ctx, "deleting media", c.roles.staff()); err != nil {
+		return nil, err
+	}
+	var (
+		productID             int64
+		blobKey, thumbnailKey string
+	)
+	err := database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, `SELECT product_id FROM product_media WHERE id = $1`, req.GetMediaId()).Scan(&productID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return status.Errorf(codes.NotFound, "media not found")
+			}
+			return err
+		}
+		if err := lockForEdit(ctx, tx, productID); err != nil {
+			return err
+		}
+		return tx.QueryRow(ctx, `DELETE FROM product_media WHERE id = $1 RETURNING blob_key, thumbnail_key`, req.GetMediaId()).Scan(&blobKey, &thumbnailKey)
+	})
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, status.Errorf(codes.NotFound, "media not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to delete media: %v", err)
+	}
+	deleteBlobs(ctx, c.store, blobKey, thumbnailKey)
+
+	productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, productID)
+	return &pb.DeleteProductMediaResponse{Deleted: true}, nil
+}
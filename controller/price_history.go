@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/money"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// effectivePriceJoin adds the price change in effect right now, if any, as
+// effective_amount and effective_currency. Later effective_from values win,
+// so a temporary price overrides an open-ended one until it ends.
+const effectivePriceJoin = `
+	LEFT JOIN LATERAL (
+		SELECT amount AS effective_amount, currency AS effective_currency
+		FROM product_prices
+		WHERE product_id = products.id
+			AND variant_id = 0
+			AND effective_from <= now()
+			AND (effective_to IS NULL OR effective_to > now())
+		ORDER BY effective_from DESC, id DESC
+		LIMIT 1
+	) AS effective ON true
+`
+
+// effectivePriceColumns selects the effective price, falling back to the
+// product's own price when it has no price history.
+const effectivePriceColumns = `COALESCE(effective_amount, price)::STRING, COALESCE(effective_currency, currency)`
+
+// effectiveVariantPriceJoin is effectivePriceJoin for product_variants.
+// effectivePriceColumns then falls back to the variant's own price, which is
+// NULL when it sells at the product's price.
+const effectiveVariantPriceJoin = `
+	LEFT JOIN LATERAL (
+		SELECT amount AS effective_amount, currency AS effective_currency
+		FROM product_prices
+		WHERE product_id = product_variants.product_id
+			AND variant_id = product_variants.id
+			AND effective_from <= now()
+			AND (effective_to IS NULL OR effective_to > now())
+		ORDER BY effective_from DESC, id DESC
+		LIMIT 1
+	) AS effective ON true
+`
+
+// recordPrice adds a new base price to the history of a product, or of its
+// variant variantID unless that is 0, effective immediately. It is called in
+// the transaction that changes the stored price, and only when the price or
+// currency actually changed, so that edits of other fields leave scheduled
+// price changes in effect.
+func recordPrice(ctx context.Context, tx pgx.Tx, productID, variantID int64, price decimal.Decimal, currency string) error {
+	query := `
+	INSERT INTO product_prices (product_id, variant_id, currency, amount, effective_from, applied_at)
+	VALUES ($1, $2, $3, $4::DECIMAL, now(), now())
+	`
+	if _, err := tx.Exec(ctx, query, productID, variantID, currency, price.String()); err != nil {
+		return fmt.Errorf("failed to record price history: %w", err)
+	}
+	return nil
+}
+
+// clearVariantPrices ends the price history of a variant that goes back to
+// selling at the product's price: changes in effect end now and scheduled
+// ones are dropped.
+func clearVariantPrices(ctx context.Context, tx pgx.Tx, variantID int64) error {
+	_, err := tx.Exec(ctx, `
+	DELETE FROM product_prices
+	WHERE variant_id = $1 AND effective_from >= now()`, variantID)
+	if err != nil {
+		return fmt.Errorf("failed to clear price history: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+	UPDATE product_prices SET effective_to = now()
+	WHERE variant_id = $1 AND (effective_to IS NULL OR effective_to > now())`, variantID)
+	if err != nil {
+		return fmt.Errorf("failed to clear price history: %w", err)
+	}
+	return nil
+}
+
+// priceChangeState classifies a price change relative to now, given the id of
+// the change currently in effect.
+func priceChangeState(change *pb.PriceChange, activeID int64, now time.Time) pb.PriceChangeState {
+	switch {
+	case change.GetId() == activeID:
+		return pb.PriceChangeState_PRICE_CHANGE_ACTIVE
+	case change.GetEffectiveFrom().AsTime().After(now):
+		return pb.PriceChangeState_PRICE_CHANGE_SCHEDULED
+	case change.GetEffectiveTo() != nil && !change.GetEffectiveTo().AsTime().After(now):
+		return pb.PriceChangeState_PRICE_CHANGE_EXPIRED
+	default:
+		return pb.PriceChangeState_PRICE_CHANGE_SUPERSEDED
+	}
+}
+
+// ApplyScheduledPrices runs until ctx is cancelled, checking every interval
+// for scheduled price changes that started or ended. Each affected product is
+// evicted from the cache and a PriceChanged event is published. Changes are
+// claimed with a single UPDATE, so replicas running concurrently never report
+// the same change twice.
+func ApplyScheduledPrices(ctx context.Context, pool database.Pool, cache database.CacheMethods, publisher events.Publisher, interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		productIDs, err := claimPriceTransitions(ctx, pool)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("failed to apply scheduled prices", "error", err)
+			}
+			continue
+		}
+		for _, productID := range productIDs {
+			slog.Info("scheduled price change took effect", "product_id", productID)
+			productChanged(ctx, cache, publisher, events.PriceChanged, productID)
+		}
+	}
+}
+
+// claimPriceTransitions marks price changes whose start or end has passed and
+// returns the distinct products they belong to.
+func claimPriceTransitions(ctx context.Context, pool database.Pool) ([]int64, error) {
+	queries := []string{
+		`UPDATE product_prices SET applied_at = now()
+		WHERE applied_at IS NULL AND effective_from <= now()
+		RETURNING product_id`,
+		`UPDATE product_prices SET expired_at = now()
+		WHERE expired_at IS NULL AND effective_to <= now()
+		RETURNING product_id`,
+	}
+
+	seen := make(map[int64]bool)
+	var productIDs []int64
+	for _, query := range queries {
+		rows, err := pool.Query(ctx, query)
+		if err != nil {
+			return productIDs, err
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err != nil {
+			return productIDs, err
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				productIDs = append(productIDs, id)
+			}
+		}
+	}
+	return productIDs, nil
+}
+
+// priceChangeColumns lists the product_prices columns in the order
+// scanPriceChange expects them.
+const priceChangeColumns = `id, product_id, variant_id, amount::STRING, currency, effective_from, effective_to, created_at`
+
+// scanPriceChange reads a row selected with priceChangeColumns.
+func scanPriceChange(row pgx.Row) (*pb.PriceChange, error) {
+	var (
+		change           pb.PriceChange
+		amount, currency string
+		from, createdAt  time.Time
+		to               *time.Time
+	)
+	if err := row.Scan(&change.Id, &change.ProductId, &change.VariantId, &amount, &currency, &from, &to, &createdAt); err != nil {
+		return nil, err
+	}
+	value, err := decimal.NewFromString(amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored price %q: %w", amount, err)
+	}
+	change.Price = money.FromDecimal(value, currency)
+	change.EffectiveFrom = timestamppb.New(from)
+	change.CreatedAt = timestamppb.New(createdAt)
+	if to != nil {
+		change.EffectiveTo = timestamppb.New(*to)
+	}
+	return &change, nil
+}
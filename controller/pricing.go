@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/money"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pricing"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// loadPriceLists returns the explicit per-currency prices of the given products.
+func loadPriceLists(ctx context.Context, pool database.Pool, productIDs []int64) (map[int64][]*pb.Money, error) {
+	priceLists := make(map[int64][]*pb.Money, len(productIDs))
+	if len(productIDs) == 0 {
+		return priceLists, nil
+	}
+
+	query := `
+	SELECT product_id, currency, amount::STRING
+	FROM product_currency_prices
+	WHERE product_id = ANY($1)
+	ORDER BY product_id, currency
+	`
+	rows, err := pool.Query(ctx, query, productIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load price lists: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			productID        int64
+			currency, amount string
+		)
+		if err := rows.Scan(&productID, &currency, &amount); err != nil {
+			return nil, fmt.Errorf("failed to scan price list: %w", err)
+		}
+		value, err := decimal.NewFromString(amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored price %q: %w", amount, err)
+		}
+		priceLists[productID] = append(priceLists[productID], money.FromDecimal(value, currency))
+	}
+	return priceLists, rows.Err()
+}
+
+// requestedCurrency validates the currency a client asked prices to be returned in.
+func requestedCurrency(converter *pricing.Converter, currency string) (string, error) {
+	if currency == "" {
+		return "", nil
+	}
+	normalized, err := converter.NormalizeCurrency(currency)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return normalized, nil
+}
+
+// applyCurrency rewrites the price of product in currency, preferring an
+// explicit price list entry over converting with the exchange rates.
+func applyCurrency(converter *pricing.Converter, product *pb.Product, currency string) error {
+	if currency == "" {
+		return nil
+	}
+	for _, variant := range product.GetVariants() {
+		if variant.GetPrice() == nil || variant.GetPrice().GetCurrencyCode() == currency {
+			continue
+		}
+		amount, err := convertPrice(converter, product.GetId(), variant.GetPrice(), currency)
+		if err != nil {
+			return err
+		}
+		variant.Price = money.FromDecimal(amount, currency)
+	}
+	if product.GetPriceMoney().GetCurrencyCode() == currency {
+		return nil
+	}
+
+	for _, entry := range product.GetPriceList() {
+		if entry.GetCurrencyCode() == currency {
+			amount := money.ToDecimal(entry)
+			product.PriceMoney = money.FromDecimal(amount, currency)
+			product.Price = money.ToFloat(amount)
+			return nil
+		}
+	}
+
+	amount, err := convertPrice(converter, product.GetId(), product.GetPriceMoney(), currency)
+	if err != nil {
+		return err
+	}
+	product.PriceMoney = money.FromDecimal(amount, currency)
+	product.Price = money.ToFloat(amount)
+	return nil
+}
+
+// convertPrice converts a price of a product to currency at the current
+// exchange rates.
+func convertPrice(converter *pricing.Converter, productID int64, price *pb.Money, currency string) (decimal.Decimal, error) {
+	amount, err := converter.Convert(money.ToDecimal(price), price.GetCurrencyCode(), currency)
+	if err != nil {
+		if errors.Is(err, pricing.ErrNoExchangeRate) {
+			return decimal.Decimal{}, status.Errorf(codes.FailedPrecondition, "cannot price product %d in %s: %v", productID, currency, err)
+		}
+		return decimal.Decimal{}, status.Errorf(codes.Internal, "failed to convert price: %v", err)
+	}
+	return amount, nil
+}
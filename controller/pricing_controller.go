@@ -0,0 +1,304 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/money"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pricing"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type pricingController struct {
+	pool      database.Pool
+	cache     database.CacheMethods
+	publisher events.Publisher
+	converter *pricing.Converter
+	// adminRoles may change exchange rates and prices, and schedule price changes.
+	adminRoles []string
+	pb.UnimplementedPricingServiceServer
+}
+
+// NewPricingController returns an instance that implements pb.PricingServiceServer.
+// Only callers with one of adminRoles may change exchange rates and prices.
+func NewPricingController(pool database.Pool, cache database.CacheMethods, publisher events.Publisher, converter *pricing.Converter, adminRoles []string) pb.PricingServiceServer {
+	return &pricingController{
+		pool:       pool,
+		cache:      cache,
+		publisher:  publisher,
+		converter:  converter,
+		adminRoles: adminRoles,
+	}
+}
+
+// ExchangeRateRefresher returns an events.Handler that reloads exchange rates
+// when another replica changes them.
+func ExchangeRateRefresher(ctx context.Context, converter *pricing.Converter) events.Handler {
+	return func(event events.Event) {
+		if event.Kind != events.ExchangeRatesUpdated {
+			return
+		}
+		if err := converter.Refresh(ctx); err != nil {
+			slog.Warn("failed to refresh exchange rates", "error", err)
+		}
+	}
+}
+
+func (c *pricingController) SetExchangeRate(ctx context.Context, req *pb.SetExchangeRateRequest) (*pb.SetExchangeRateResponse, error) {
+	if _, err := authorize(ctx, "setting exchange rates", c.adminRoles); err != nil {
+		return nil, err
+	}
+	base, err := c.converter.NormalizeCurrency(req.GetBaseCurrency())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid base currency: %v", err)
+	}
+	quote, err := c.converter.NormalizeCurrency(req.GetQuoteCurrency())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid quote currency: %v", err)
+	}
+	if base == quote {
+		return nil, status.Errorf(codes.InvalidArgument, "base and quote currency must differ")
+	}
+	rate, err := decimal.NewFromString(req.GetRate())
+	if err != nil || !rate.IsPositive() {
+		return nil, status.Errorf(codes.InvalidArgument, "rate must be a positive decimal")
+	}
+
+	stored, err := c.converter.SetRate(ctx, base, quote, rate)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	if err := c.publisher.Publish(ctx, events.Event{Kind: events.ExchangeRatesUpdated}); err != nil {
+		slog.Warn("failed to publish exchange rate update", "error", err)
+	}
+
+	return &pb.SetExchangeRateResponse{ExchangeRate: exchangeRateToProto(stored)}, nil
+}
+
+func (c *pricingController) ListExchangeRates(ctx context.Context, req *pb.ListExchangeRatesRequest) (*pb.ListExchangeRatesResponse, error) {
+	rates, err := c.converter.ListRates(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	response := &pb.ListExchangeRatesResponse{}
+	for _, rate := range rates {
+		response.ExchangeRates = append(response.ExchangeRates, exchangeRateToProto(rate))
+	}
+	return response, nil
+}
+
+func (c *pricingController) SetProductPrice(ctx context.Context, req *pb.SetProductPriceRequest) (*pb.SetProductPriceResponse, error) {
+	if _, err := authorize(ctx, "setting product prices", c.adminRoles); err != nil {
+		return nil, err
+	}
+	if req.GetProductId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
+	}
+	if req.GetPrice() == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "price is required")
+	}
+	if err := money.Validate(req.GetPrice()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid price: %v", err)
+	}
+	currency, err := c.converter.NormalizeCurrency(req.GetPrice().GetCurrencyCode())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid price: %v", err)
+	}
+	amount := money.ToDecimal(req.GetPrice()).Round(money.Scale)
+
+	query := `
+	UPSERT INTO product_currency_prices (product_id, currency, amount)
+	SELECT id, $2, $3::DECIMAL FROM products WHERE id = $1
+	`
+	tag, err := c.pool.Exec(ctx, query, req.GetProductId(), currency, amount.String())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to set product price: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, status.Errorf(codes.NotFound, "product not found")
+	}
+
+	productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, req.GetProductId())
+
+	priceLists, err := loadPriceLists(ctx, c.pool, []int64{req.GetProductId()})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	return &pb.SetProductPriceResponse{PriceList: priceLists[req.GetProductId()]}, nil
+}
+
+func (c *pricingController) DeleteProductPrice(ctx context.Context, req *pb.DeleteProductPriceRequest) (*pb.DeleteProductPriceResponse, error) {
+	if _, err := authorize(ctx, "deleting product prices", c.adminRoles); err != nil {
+		return nil, err
+	}
+	if req.GetProductId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
+	}
+	currency, err := c.converter.NormalizeCurrency(req.GetCurrency())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	tag, err := c.pool.Exec(ctx, `DELETE FROM product_currency_prices WHERE product_id = $1 AND currency = $2`, req.GetProductId(), currency)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to delete product price: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, status.Errorf(codes.NotFound, "product price not found")
+	}
+
+	productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, req.GetProductId())
+
+	return &pb.DeleteProductPriceResponse{Deleted: true}, nil
+}
+
+func (c *pricingController) SchedulePriceChange(ctx context.Context, req *pb.SchedulePriceChangeRequest) (*pb.SchedulePriceChangeResponse, error) {
+	if _, err := authorize(ctx, "scheduling price changes", c.adminRoles); err != nil {
+		return nil, err
+	}
+	if req.GetProductId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
+	}
+	if req.GetVariantId() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "variant id must not be negative")
+	}
+	if req.GetPrice() == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "price is required")
+	}
+	if err := money.Validate(req.GetPrice()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid price: %v", err)
+	}
+	currency, err := c.converter.NormalizeCurrency(req.GetPrice().GetCurrencyCode())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid price: %v", err)
+	}
+	amount := money.ToDecimal(req.GetPrice()).Round(money.Scale)
+
+	effectiveFrom := time.Now()
+	if req.GetEffectiveFrom() != nil {
+		effectiveFrom = req.GetEffectiveFrom().AsTime()
+	}
+	var effectiveTo *time.Time
+	if req.GetEffectiveTo() != nil {
+		to := req.GetEffectiveTo().AsTime()
+		if !to.After(effectiveFrom) {
+			return nil, status.Errorf(codes.InvalidArgument, "effective_to must be after effective_from")
+		}
+		effectiveTo = &to
+	}
+
+	// Changes that are already in effect are marked applied here so that the
+	// scheduler does not announce them a second time.
+	query := `
+	INSERT INTO product_prices (product_id, variant_id, currency, amount, effective_from, effective_to, applied_at)
+	SELECT id, $6, $2, $3::DECIMAL, $4::TIMESTAMPTZ, $5::TIMESTAMPTZ, CASE WHEN $4::TIMESTAMPTZ <= now() THEN now() END
+	FROM products
+	WHERE id = $1 AND ($6 = 0 OR EXISTS (SELECT 1 FROM product_variants WHERE id = $6 AND product_id = $1))
+	RETURNING ` + priceChangeColumns
+	change, err := scanPriceChange(c.pool.QueryRow(ctx, query, req.GetProductId(), currency, amount.String(), effectiveFrom, effectiveTo, req.GetVariantId()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, status.Errorf(codes.NotFound, "product or variant not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to schedule price change: %v", err)
+	}
+
+	now := time.Now()
+	if effectiveFrom.After(now) {
+		change.State = pb.PriceChangeState_PRICE_CHANGE_SCHEDULED
+	} else {
+		change.State = pb.PriceChangeState_PRICE_CHANGE_ACTIVE
+		productChanged(ctx, c.cache, c.publisher, events.PriceChanged, req.GetProductId())
+	}
+
+	return &pb.SchedulePriceChangeResponse{PriceChange: change}, nil
+}
+
+func (c *pricingController) GetPriceHistory(ctx context.Context, req *pb.GetPriceHistoryRequest) (*pb.GetPriceHistoryResponse, error) {
+	if req.GetProductId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
+	}
+	pageSize := clampPageSize(req.GetPageSize(), 50)
+	offset := 0
+	if req.GetPageToken() != "" {
+		var err error
+		offset, err = strconv.Atoi(req.GetPageToken())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+
+	var (
+		now      time.Time
+		activeID *int64
+	)
+	activeQuery := `
+	SELECT now(), (
+		SELECT id FROM product_prices
+		WHERE product_id = $1 AND variant_id = $2
+			AND effective_from <= now()
+			AND (effective_to IS NULL OR effective_to > now())
+		ORDER BY effective_from DESC, id DESC
+		LIMIT 1
+	)
+	`
+	if err := c.pool.QueryRow(ctx, activeQuery, req.GetProductId(), req.GetVariantId()).Scan(&now, &activeID); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to resolve effective price: %v", err)
+	}
+
+	query := `
+	SELECT ` + priceChangeColumns + `
+	FROM product_prices
+	WHERE product_id = $1 AND variant_id = $2
+	ORDER BY effective_from DESC, id DESC
+	LIMIT $3 OFFSET $4
+	`
+	rows, err := c.pool.Query(ctx, query, req.GetProductId(), req.GetVariantId(), pageSize, offset)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "query error: %v", err)
+	}
+	defer rows.Close()
+
+	response := &pb.GetPriceHistoryResponse{}
+	for rows.Next() {
+		change, err := scanPriceChange(rows)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to scan row: %v", err)
+		}
+		var active int64
+		if activeID != nil {
+			active = *activeID
+		}
+		change.State = priceChangeState(change, active, now)
+		response.PriceChanges = append(response.PriceChanges, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "error iterating rows: %v", err)
+	}
+
+	if len(response.PriceChanges) == int(pageSize) {
+		response.NextPageToken = strconv.Itoa(offset + len(response.PriceChanges))
+	}
+	return response, nil
+}
+
+func exchangeRateToProto(rate pricing.ExchangeRate) *pb.ExchangeRate {
+	return &pb.ExchangeRate{
+		BaseCurrency:  rate.Base,
+		QuoteCurrency: rate.Quote,
+		Rate:          rate.Rate.String(),
+		UpdatedAt:     timestamppb.New(rate.UpdatedAt),
+	}
+}
@@ -2,49 +2,123 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
 	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/duplicates"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/inventory"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/locales"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/media"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/money"
 	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pricing"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/producttypes"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/promotions"
 	"github.com/yaninyzwitty/grpc-cocroach-microservice/sonyflake"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// newProductID generates the ids of new products. Tests replace it, as
+// sonyflake needs a private IP address to derive its machine id from.
+var newProductID = sonyflake.GenerateID
+
 type productController struct {
-	pool            *pgxpool.Pool
-	memcachedClient *database.MemcachedClient
+	pool       database.Pool
+	cache      database.CacheMethods
+	codec      *database.CacheCodec
+	publisher  events.Publisher
+	queryStats *database.QueryStats
+	converter  *pricing.Converter
+	promotions *promotions.Engine
+	inventory  *inventory.Store
+	types      *producttypes.Registry
+	blobs      media.BlobStore
+	// mediaURL is the base URL media blobs are served from.
+	mediaURL   string
+	locales    *locales.Resolver
+	roles      LifecycleRoles
+	duplicates DuplicateCheck
 	pb.UnimplementedProductServiceServer
 }
 
 // NewProductController returns an instance that implements pb.ProductServiceServer.
-func NewProductController(pool *pgxpool.Pool, memcachedClient *database.MemcachedClient) pb.ProductServiceServer {
+func NewProductController(pool database.Pool, cache database.CacheMethods, compression database.Compression, publisher events.Publisher, queryStats *database.QueryStats, converter *pricing.Converter, promotions *promotions.Engine, inventory *inventory.Store, types *producttypes.Registry, blobs media.BlobStore, mediaURL string, resolver *locales.Resolver, roles LifecycleRoles, duplicateCheck DuplicateCheck) pb.ProductServiceServer {
+	if duplicateCheck.Threshold <= 0 {
+		duplicateCheck.Threshold = defaultDuplicateThreshold
+	}
 	return &productController{
-		pool:            pool,
-		memcachedClient: memcachedClient,
+		pool:       pool,
+		cache:      cache,
+		codec:      database.NewCacheCodec(cache, compression),
+		publisher:  publisher,
+		queryStats: queryStats,
+		converter:  converter,
+		promotions: promotions,
+		inventory:  inventory,
+		types:      types,
+		blobs:      blobs,
+		mediaURL:   mediaURL,
+		locales:    resolver,
+		roles:      roles,
+		duplicates: duplicateCheck,
 	}
 }
 
 func (c *productController) CreateProduct(ctx context.Context, req *pb.CreateProductRequest) (*pb.CreateProductResponse, error) {
-	productID, err := sonyflake.GenerateID()
+	if _, err := authorize(ctx, "creating a product", c.roles.staff()); err != nil {
+		return nil, err
+	}
+	productID, err := newProductID()
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to generate product id: %v", err)
 	}
 
+	price, currency, err := money.Resolve(req.PriceMoney, req.Price)
+	if err == nil {
+		currency, err = c.converter.NormalizeCurrency(currency)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid price: %v", err)
+	}
+
+	productTags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if req.ProductStatus == pb.ProductStatus_DISCONTINUED {
+		return nil, status.Errorf(codes.InvalidArgument, "new products cannot be discontinued")
+	}
+	sku, err := productSku(req.GetSku())
+	if err != nil {
+		return nil, err
+	}
+	barcode, err := productBarcode(req.GetBarcode())
+	if err != nil {
+		return nil, err
+	}
+	slug, generatedSlug, err := c.slugOrGenerated(ctx, req.GetSlug(), req.GetName())
+	if err != nil {
+		return nil, err
+	}
+
 	product := &pb.Product{
 		Id:            int64(productID),
 		Name:          req.Name,
 		Description:   req.Description,
-		Price:         req.Price,
+		Price:         money.ToFloat(price),
+		PriceMoney:    money.FromDecimal(price, currency),
 		Category:      req.Category,
-		Tags:          req.Tags,
+		Tags:          productTags,
 		ProductState:  req.ProductState,
 		ProductStatus: req.ProductStatus,
 	}
@@ -57,30 +131,112 @@ func (c *productController) CreateProduct(ctx context.Context, req *pb.CreatePro
 	case *pb.CreateProductRequest_Food:
 		product.Variation = &pb.Product_Food{Food: v.Food}
 	default:
-		return nil, status.Errorf(codes.InvalidArgument, "invalid product variation type")
+		if req.GetProductType() == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid product variation type")
+		}
+	}
+
+	productType, attributes, variation, err := c.resolveProductType(ctx, product, req.GetProductType(), req.GetAttributes())
+	if err != nil {
+		return nil, err
+	}
+	categoryID, categoryName, err := c.resolveCategory(ctx, req.GetCategoryId(), req.GetCategory())
+	if err != nil {
+		return nil, err
+	}
+	product.Category = categoryName
+	if categoryID != nil {
+		product.CategoryId = *categoryID
+	}
+
+	candidate := duplicates.Product{
+		ID:          product.Id,
+		Name:        product.Name,
+		CategoryID:  product.CategoryId,
+		Category:    product.Category,
+		ProductType: productType,
+		Attributes:  duplicates.Attributes(attributes),
+	}
+	// Duplicates to reject are looked for in the transaction that inserts the
+	// product, so that concurrent imports of one product cannot both pass.
+	rejectDuplicates := c.duplicates.Strict || req.GetRejectDuplicates()
+	var possibleDuplicates []*pb.DuplicateMatch
+	if !rejectDuplicates {
+		if possibleDuplicates, err = c.findDuplicates(ctx, c.pool, candidate, c.duplicates.Threshold, defaultDuplicateLimit, nil); err != nil {
+			return nil, err
+		}
 	}
 
 	var createdAt, updatedAt time.Time
 
-	query := `INSERT INTO products (id, name, description, price, category, tags,  product_state, product_status, variation) 
-	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING created_at, updated_at`
-	err = c.pool.QueryRow(ctx, query, int64(productID), product.Name, product.Description, product.Price, product.Category, product.Tags, product.ProductState, product.ProductStatus, product.Variation).Scan(&createdAt, &updatedAt)
+	// New products start as drafts and are not listed publicly until published.
+	query := `INSERT INTO products (id, name, description, price, category, tags,  product_state, product_status, variation, currency, product_type, category_id, lifecycle, sku, slug, barcode) 
+	          VALUES ($1, $2, $3, $4::DECIMAL, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), $12, 'DRAFT', NULLIF($13, ''), $14, NULLIF($15, '')) RETURNING created_at, updated_at`
+	insert := func(tx pgx.Tx) error {
+		if rejectDuplicates {
+			matches, err := c.findDuplicates(ctx, tx, candidate, c.duplicates.Threshold, defaultDuplicateLimit, nil)
+			if err != nil {
+				return err
+			}
+			if len(matches) > 0 {
+				best := matches[0]
+				return status.Errorf(codes.AlreadyExists, "likely a duplicate of product %d %q (score %.2f)", best.ProductId, best.Name, best.Score)
+			}
+		}
+		if err := productSkuAvailable(ctx, tx, sku); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(ctx, query, int64(productID), product.Name, product.Description, price.String(), product.Category, product.Tags, product.ProductState, product.ProductStatus, variation, currency, productType, categoryID, sku, slug, barcode).Scan(&createdAt, &updatedAt); err != nil {
+			return err
+		}
+		return recordPrice(ctx, tx, product.Id, 0, price, currency)
+	}
+	for attempt := 1; ; attempt++ {
+		err = database.ExecuteTx(ctx, c.pool, insert)
+		// A generated slug taken concurrently is generated again.
+		if err == nil || !generatedSlug || attempt == maxSlugAttempts || database.ConstraintName(err) != productSlugIndex {
+			break
+		}
+		if slug, err = c.availableSlug(ctx, slugFromName(product.Name)); err != nil {
+			return nil, err
+		}
+	}
 
 	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		if identifierErr := identifierError(err); identifierErr != nil {
+			return nil, identifierErr
+		}
 		return nil, status.Errorf(codes.Internal, "failed to create product: %v", err)
 	}
+	if err := recordTags(ctx, c.pool, product.Tags); err != nil {
+		slog.Warn("failed to record tags", "id", product.Id, "error", err)
+	}
+
+	productChanged(ctx, c.cache, c.publisher, events.ProductCreated, product.Id)
 
 	response := &pb.CreateProductResponse{
-		Id:            product.Id,
-		Name:          product.Name,
-		Description:   product.Description,
-		Price:         product.Price,
-		Category:      product.Category,
-		Tags:          product.Tags,
-		CreatedAt:     timestamppb.New(createdAt),
-		UpdatedAt:     timestamppb.New(updatedAt),
-		ProductState:  product.ProductState,
-		ProductStatus: product.ProductStatus,
+		Id:                 product.Id,
+		Name:               product.Name,
+		Description:        product.Description,
+		Price:              product.Price,
+		PriceMoney:         product.PriceMoney,
+		Category:           product.Category,
+		Tags:               product.Tags,
+		CreatedAt:          timestamppb.New(createdAt),
+		UpdatedAt:          timestamppb.New(updatedAt),
+		ProductState:       product.ProductState,
+		ProductStatus:      product.ProductStatus,
+		ProductType:        productType,
+		Attributes:         attributes,
+		CategoryId:         product.CategoryId,
+		Lifecycle:          pb.LifecycleState_LIFECYCLE_DRAFT,
+		Sku:                sku,
+		Slug:               slug,
+		Barcode:            barcode,
+		PossibleDuplicates: possibleDuplicates,
 	}
 	switch v := req.Variation.(type) {
 	case *pb.CreateProductRequest_Clothing:
@@ -99,70 +255,187 @@ func (c *productController) UpdateProduct(ctx context.Context, req *pb.UpdatePro
 	if req.GetId() == 0 {
 		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
 	}
+	if _, err := authorize(ctx, "updating a product", c.roles.staff()); err != nil {
+		return nil, err
+	}
+
+	price, currency, err := money.Resolve(req.GetPriceMoney(), req.GetPrice())
+	if err == nil {
+		currency, err = c.converter.NormalizeCurrency(currency)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid price: %v", err)
+	}
 
 	productID := req.GetId()
 	name := req.GetName()
 	description := req.GetDescription()
-	price := req.GetPrice()
+	priceStr := price.String()
 	category := req.GetCategory()
-	tags := req.GetTags()
+	tags, err := normalizeTags(req.GetTags())
+	if err != nil {
+		return nil, err
+	}
 	productState := req.GetProductState()
 	productStatus := req.GetProductStatus()
-	variation := req.GetVariation()
+
+	requested := &pb.Product{}
+	switch v := req.Variation.(type) {
+	case *pb.UpdateProductRequest_Clothing:
+		requested.Variation = &pb.Product_Clothing{Clothing: v.Clothing}
+	case *pb.UpdateProductRequest_Electronics:
+		requested.Variation = &pb.Product_Electronics{Electronics: v.Electronics}
+	case *pb.UpdateProductRequest_Food:
+		requested.Variation = &pb.Product_Food{Food: v.Food}
+	}
+	productType, attributes, variation, err := c.resolveProductType(ctx, requested, req.GetProductType(), req.GetAttributes())
+	if err != nil {
+		return nil, err
+	}
+	categoryID, category, err := c.resolveCategory(ctx, req.GetCategoryId(), category)
+	if err != nil {
+		return nil, err
+	}
+
+	var sku, slug, barcode string
+	if req.Sku != nil {
+		if sku, err = productSku(req.GetSku()); err != nil {
+			return nil, err
+		}
+	}
+	if req.Slug != nil {
+		if slug, err = requestedSlug(req.GetSlug()); err != nil {
+			return nil, err
+		}
+	}
+	if req.Barcode != nil {
+		if barcode, err = productBarcode(req.GetBarcode()); err != nil {
+			return nil, err
+		}
+	}
 
 	query := `
 	UPDATE products
 	SET 
 		name = $2,
 		description = $3,
-		price = $4,
+		price = $4::DECIMAL,
 		category = $5,
 		tags = $6,
 		product_state = $7,
 		product_status = $8,
 		variation = $9,
-		updated_at = $10
+		updated_at = $10,
+		currency = $11,
+		product_type = NULLIF($12, ''),
+		category_id = $13,
+		sku = CASE WHEN $14::BOOL THEN NULLIF($15, '') ELSE sku END,
+		slug = COALESCE(NULLIF($16, ''), slug),
+		barcode = CASE WHEN $17::BOOL THEN NULLIF($18, '') ELSE barcode END,
+		publish_at = CASE WHEN lifecycle = 'IN_REVIEW' THEN NULL ELSE publish_at END
 	WHERE id = $1
-	RETURNING id, name, description, price, category, tags, product_state, product_status, variation, created_at, updated_at;
+	RETURNING id, name, description, price::STRING, category, tags, product_state, product_status, created_at, updated_at, currency,
+		COALESCE(sku, ''), COALESCE(slug, ''), COALESCE(barcode, '');
 	`
 
 	updatedAt := time.Now()
 	var createdTime time.Time
 	var updatedTime time.Time
-	err := c.pool.QueryRow(ctx, query,
-		productID, name, description, price, category, tags, productState, productStatus, variation, updatedAt).Scan(
-		&productID, &name, &description, &price, &category, &tags, &productState, &productStatus, &variation, &createdTime, &updatedTime,
-	)
+	var lifecycle string
+	err = database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		var previousPrice, previousCurrency string
+		if err := tx.QueryRow(ctx, `SELECT price::STRING, currency, lifecycle FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&previousPrice, &previousCurrency, &lifecycle); err != nil {
+			return err
+		}
+		// The lifecycle is checked under the row lock so that a concurrent
+		// transition cannot slip in before the update. DISCONTINUED follows
+		// the lifecycle and can only change through its RPCs. Edits to a
+		// product in review drop its publication schedule, which approved
+		// the content as it was.
+		switch state := lifecycleFromName(lifecycle); {
+		case state == pb.LifecycleState_LIFECYCLE_ARCHIVED:
+			return status.Errorf(codes.FailedPrecondition, "archived products cannot be changed")
+		case state == pb.LifecycleState_LIFECYCLE_DISCONTINUED && productStatus != pb.ProductStatus_DISCONTINUED:
+			return status.Errorf(codes.FailedPrecondition, "discontinued products stay DISCONTINUED")
+		case state != pb.LifecycleState_LIFECYCLE_DISCONTINUED && productStatus == pb.ProductStatus_DISCONTINUED:
+			return status.Errorf(codes.FailedPrecondition, "use DiscontinueProduct to discontinue a product")
+		}
+		if req.Sku != nil {
+			if err := productSkuAvailable(ctx, tx, sku); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.QueryRow(ctx, query,
+			productID, name, description, priceStr, category, tags, productState, productStatus, variation, updatedAt, currency, productType, categoryID,
+			req.Sku != nil, sku, slug, req.Barcode != nil, barcode).Scan(
+			&productID, &name, &description, &priceStr, &category, &tags, &productState, &productStatus, &createdTime, &updatedTime, &currency,
+			&sku, &slug, &barcode,
+		); err != nil {
+			return err
+		}
+		// A new base price enters the history, or an earlier price change
+		// that is still in effect would keep overriding it. Other edits
+		// leave the history, and any sale running, alone.
+		if previous, err := decimal.NewFromString(previousPrice); err == nil && previous.Equal(price) && previousCurrency == currency {
+			return nil
+		}
+		return recordPrice(ctx, tx, productID, 0, price, currency)
+	})
 
 	if err != nil {
-		if err.Error() == "no rows in result set" { // Check for "not found" explicitly
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		if identifierErr := identifierError(err); identifierErr != nil {
+			return nil, identifierErr
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, status.Errorf(codes.NotFound, "product not found")
 		}
 		return nil, status.Errorf(codes.Internal, "failed to update product: %v", err)
 	}
+	if err := recordTags(ctx, c.pool, tags); err != nil {
+		slog.Warn("failed to record tags", "id", productID, "error", err)
+	}
+	// Stock decides between IN_STOCK and OUT_OF_STOCK for tracked products.
+	stock, err := c.inventory.SyncStatus(ctx, productID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	productStatus = productStatusFromString(stock.Status)
+
+	productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, productID)
 
 	product := &pb.Product{
 		Id:            productID,
 		Name:          name,
 		Description:   description,
-		Price:         price,
 		Category:      category,
 		Tags:          tags,
 		ProductState:  productState,
 		ProductStatus: productStatus,
 		CreatedAt:     timestamppb.New(createdTime),
 		UpdatedAt:     timestamppb.New(updatedTime),
+		Variation:     requested.Variation,
+		ProductType:   productType,
+		Attributes:    attributes,
+		Lifecycle:     lifecycleFromName(lifecycle),
+		Sku:           sku,
+		Slug:          slug,
+		Barcode:       barcode,
 	}
-
-	// Handle the variation field
-	switch v := req.Variation.(type) {
-	case *pb.UpdateProductRequest_Clothing:
-		product.Variation = &pb.Product_Clothing{Clothing: v.Clothing}
-	case *pb.UpdateProductRequest_Electronics:
-		product.Variation = &pb.Product_Electronics{Electronics: v.Electronics}
-	case *pb.UpdateProductRequest_Food:
-		product.Variation = &pb.Product_Food{Food: v.Food}
+	if categoryID != nil {
+		product.CategoryId = *categoryID
+	}
+	if err := setPrice(product, priceStr, currency); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	priceLists, err := loadPriceLists(ctx, c.pool, []int64{productID})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
 	}
+	product.PriceList = priceLists[productID]
 
 	return &pb.UpdateProductResponse{
 		Product: product,
@@ -172,24 +445,46 @@ func (c *productController) DeleteProduct(ctx context.Context, req *pb.DeletePro
 	if req.GetProductId() == 0 {
 		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
 	}
+	if _, err := authorize(ctx, "deleting a product", c.roles.staff()); err != nil {
+		return nil, err
+	}
 	productID := req.GetProductId()
-	query := `
-	DELETE FROM products
-	WHERE id = $1
-`
-	_, err := c.pool.Exec(ctx, query, productID) // Use Exec for DELETE
-	if err != nil {
-		// Check if the product exists before deletion
-		var count int
-		countQuery := `SELECT COUNT(*) FROM products WHERE id = $1`
-		errCount := c.pool.QueryRow(ctx, countQuery, productID).Scan(&count)
-		if errCount == nil && count == 0 {
-			return nil, status.Errorf(codes.NotFound, "product not found")
+	// Media rows go with the product; their blobs are removed once the
+	// delete committed.
+	var blobKeys []string
+	err := database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		// Products leave the catalog through the lifecycle first, so only
+		// archived ones can be deleted.
+		var lifecycle string
+		if err := tx.QueryRow(ctx, `SELECT lifecycle FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&lifecycle); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return status.Errorf(codes.NotFound, "product not found")
+			}
+			return fmt.Errorf("failed to read product: %w", err)
+		}
+		if lifecycleFromName(lifecycle) != pb.LifecycleState_LIFECYCLE_ARCHIVED {
+			return status.Errorf(codes.FailedPrecondition, "only archived products can be deleted")
 		}
 
-		return nil, status.Errorf(codes.Internal, "failed to delete product: %v", err)
+		var err error
+		if blobKeys, err = deleteMediaRows(ctx, tx, productID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM products WHERE id = $1`, productID); err != nil {
+			return fmt.Errorf("failed to delete product: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "%v", err)
 	}
 
+	deleteBlobs(ctx, c.blobs, blobKeys...)
+	productChanged(ctx, c.cache, c.publisher, events.ProductDeleted, productID)
+
 	return &pb.DeleteProductResponse{
 		Deleted: true,
 	}, nil
@@ -200,6 +495,30 @@ func (c *productController) GetProduct(ctx context.Context, req *pb.GetProductRe
 	if req.GetId() <= 0 {
 		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
 	}
+	currency, err := requestedCurrency(c.converter, req.GetCurrency())
+	if err != nil {
+		return nil, err
+	}
+
+	// Localized copies are cached separately; the default locale keeps the plain key.
+	locale := requestedLocale(ctx, c.locales, req.GetLocale())
+	cacheKey := productCacheKey(req.GetId())
+	if locale != c.locales.Default() {
+		cacheKey = localizedProductCacheKey(productListGeneration(ctx, c.cache), req.GetId(), locale)
+	}
+	var cachedProduct pb.Product
+	if found, err := c.codec.Get(ctx, cacheKey, &cachedProduct); err != nil {
+		slog.Warn("cache error", "key", cacheKey, "error", err)
+	} else if found {
+		if !c.roles.visible(ctx, cachedProduct.Lifecycle) {
+			return nil, status.Errorf(codes.NotFound, "product not found")
+		}
+		c.recordProduct(ctx, req.GetId())
+		if err := c.presentPrice(&cachedProduct, currency, time.Now()); err != nil {
+			return nil, err
+		}
+		return &pb.GetProductResponse{Product: &cachedProduct}, nil
+	}
 
 	// Define the SQL query to retrieve the product.
 	query := `
@@ -207,30 +526,43 @@ func (c *productController) GetProduct(ctx context.Context, req *pb.GetProductRe
 			id,
 			name,
 			description,
-			price,
+			` + effectivePriceColumns + `,
 			category,
+			` + categoryNameColumn + `,
 			tags,
 			created_at,
 			updated_at,
 			product_state,
 			product_status,
-			variation
-		FROM products
+			variation,
+			COALESCE(product_type, ''),
+			COALESCE(category_id, 0),
+			lifecycle,
+			publish_at,
+			unpublish_at,
+			COALESCE(sku, ''),
+			COALESCE(slug, ''),
+			COALESCE(barcode, '')
+		FROM products` + effectivePriceJoin + `
 		WHERE id = $1
 	`
 
 	var product pb.Product
 	var variationData []byte
+	var price, productCurrency, productType, lifecycle, storedCategory string
 	var createdAt, updatedAt time.Time
+	var publishAt, unpublishAt *time.Time
 	// Scan product_state and product_status as strings so we can convert them later.
 	var productStateStr, productStatusStr string
 
 	// Execute the query and scan the results.
-	err := c.pool.QueryRow(ctx, query, req.GetId()).Scan(
+	err = c.pool.QueryRow(ctx, query, req.GetId()).Scan(
 		&product.Id,
 		&product.Name,
 		&product.Description,
-		&product.Price,
+		&price,
+		&productCurrency,
+		&storedCategory,
 		&product.Category,
 		&product.Tags,
 		&createdAt,
@@ -238,14 +570,48 @@ func (c *productController) GetProduct(ctx context.Context, req *pb.GetProductRe
 		&productStateStr,
 		&productStatusStr,
 		&variationData,
+		&productType,
+		&product.CategoryId,
+		&lifecycle,
+		&publishAt,
+		&unpublishAt,
+		&product.Sku,
+		&product.Slug,
+		&product.Barcode,
 	)
 	if err != nil {
+		// Missing products look the same as hidden ones.
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, status.Errorf(codes.NotFound, "product not found")
+		}
 		return nil, status.Errorf(codes.Internal, "failed to get product: %v", err)
 	}
 
+	if err := setPrice(&product, price, productCurrency); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	priceLists, err := loadPriceLists(ctx, c.pool, []int64{product.Id})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	product.PriceList = priceLists[product.Id]
+	variants, err := loadVariants(ctx, c.pool, c.inventory, []int64{product.Id})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	product.Variants = variants[product.Id]
+	productMedia, err := loadMedia(ctx, c.pool, c.mediaURL, []int64{product.Id})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	product.Media = productMedia[product.Id]
+
 	// Convert timestamps to google.protobuf.Timestamp.
 	product.CreatedAt = timestamppb.New(createdAt)
 	product.UpdatedAt = timestamppb.New(updatedAt)
+	product.Lifecycle = lifecycleFromName(lifecycle)
+	product.PublishAt = optionalTimestamp(publishAt)
+	product.UnpublishAt = optionalTimestamp(unpublishAt)
 
 	// Convert the product state string to its enum.
 	if stateVal, ok := pb.ProductState_value[productStateStr]; ok {
@@ -261,39 +627,24 @@ func (c *productController) GetProduct(ctx context.Context, req *pb.GetProductRe
 		return nil, status.Errorf(codes.Internal, "invalid product status: %s", productStatusStr)
 	}
 
-	// If variation data is present, decode it.
-	if len(variationData) > 0 {
-		// Log the original variation data for debugging.
-		original := string(variationData)
-
-		// Transform the JSON data to match the expected oneof field names in the proto.
-		// Replace any capitalized keys ("Clothing", "Electronics", "Food") with the lowercase versions.
-		transformed := original
-		transformed = strings.Replace(transformed, `"Clothing":`, `"clothing":`, 1)
-		transformed = strings.Replace(transformed, `"Electronics":`, `"electronics":`, 1)
-		transformed = strings.Replace(transformed, `"Food":`, `"food":`, 1)
+	if err := setVariation(&product, productType, storedCategory, variationData); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to decode variation: %v", err)
+	}
+	if err := c.localize(ctx, []*pb.Product{&product}, locale); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
 
-		// Unmarshal the transformed JSON into a temporary Product.
-		var tmpProduct pb.Product
-		unmarshaler := protojson.UnmarshalOptions{
-			DiscardUnknown: true,
-		}
-		if err := unmarshaler.Unmarshal([]byte(transformed), &tmpProduct); err != nil {
-			return nil, status.Errorf(codes.Internal, "failed to decode variation: %v", err)
-		}
+	if err := c.codec.Set(ctx, cacheKey, &product, 3600); err != nil {
+		slog.Warn("failed to set product in cache", "key", cacheKey, "error", err)
+	}
+	if !c.roles.visible(ctx, product.Lifecycle) {
+		return nil, status.Errorf(codes.NotFound, "product not found")
+	}
+	c.recordProduct(ctx, req.GetId())
 
-		// Assign the correct oneof field based on the type.
-		switch v := tmpProduct.Variation.(type) {
-		case *pb.Product_Clothing:
-			product.Variation = &pb.Product_Clothing{Clothing: v.Clothing}
-		case *pb.Product_Food:
-			product.Variation = &pb.Product_Food{Food: v.Food}
-		case *pb.Product_Electronics:
-			product.Variation = &pb.Product_Electronics{Electronics: v.Electronics}
-		default:
-			// If the variation does not match any expected type, leave it as nil.
-			product.Variation = nil
-		}
+	// Prices are converted after caching so one entry serves every currency.
+	if err := c.presentPrice(&product, currency, time.Now()); err != nil {
+		return nil, err
 	}
 
 	// Return the product wrapped in a GetProductResponse.
@@ -302,11 +653,20 @@ func (c *productController) GetProduct(ctx context.Context, req *pb.GetProductRe
 	}, nil
 }
 
-func (c *productController) ListProducts(ctx context.Context, req *pb.ListProductsRequest) (*pb.ListProductsResponse, error) {
-	pageSize := req.PageSize
-	if pageSize <= 0 {
-		pageSize = 10
+// maxPageSize caps the page_size of list RPCs.
+const maxPageSize = 100
+
+// clampPageSize returns the requested page size, fallback when none was
+// requested, and at most maxPageSize.
+func clampPageSize(requested, fallback int32) int32 {
+	if requested <= 0 {
+		return fallback
 	}
+	return min(requested, maxPageSize)
+}
+
+func (c *productController) ListProducts(ctx context.Context, req *pb.ListProductsRequest) (*pb.ListProductsResponse, error) {
+	pageSize := clampPageSize(req.PageSize, 10)
 
 	// For simplicity, we treat the page token as an offset (encoded as a string).
 	offset := 0
@@ -318,25 +678,38 @@ func (c *productController) ListProducts(ctx context.Context, req *pb.ListProduc
 		}
 	}
 
+	currency, err := requestedCurrency(c.converter, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	locale := requestedLocale(ctx, c.locales, req.Locale)
+	lifecycles, err := c.visibleLifecycles(ctx, req.Lifecycles)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attribute and category filters are not warmed, so only plain listings are recorded.
+	if offset == 0 && len(req.VariantAttributes) == 0 && req.CategoryId == 0 && recordsQueryStats(ctx) {
+		c.queryStats.RecordList(database.ListQuery{PageSize: pageSize, SearchTerm: req.SearchTerm})
+	}
+
 	// Generate a cache key based on the request parameters (page size, page token, and search term).
-	cacheKey := fmt.Sprintf("product-list:%d:%d:%s", pageSize, offset, req.SearchTerm)
+	cacheKey := productListCacheKey(productListGeneration(ctx, c.cache), pageSize, offset, locale, lifecycles, req)
 
 	// Attempt to retrieve the product list from cache.
-	cacheBytes, err := c.memcachedClient.Get(ctx, cacheKey)
-	if err == nil && cacheBytes != nil {
-		// Cache hit: unmarshal and return the cached products.
-		var cachedResponse pb.ListProductsResponse
-		if err := protojson.Unmarshal(cacheBytes, &cachedResponse); err == nil {
-			return &cachedResponse, nil
-		} else {
-			// Cache unmarshalling failed, log and continue to fetch from DB.
-			slog.Warn("failed to unmarshal cached product list", "key", cacheKey, "error", err)
-		}
-	} else {
-		// Cache miss or error, proceed to fetch from DB.
-		if err != nil {
-			slog.Warn("cache error", "key", cacheKey, "error", err)
+	// Entries that are missing, stale or written with another schema version are misses.
+	var cachedResponse pb.ListProductsResponse
+	if found, err := c.codec.Get(ctx, cacheKey, &cachedResponse); err != nil {
+		// Cache error, proceed to fetch from DB.
+		slog.Warn("cache error", "key", cacheKey, "error", err)
+	} else if found {
+		now := time.Now()
+		for _, product := range cachedResponse.Products {
+			if err := c.presentPrice(product, currency, now); err != nil {
+				return nil, err
+			}
 		}
+		return &cachedResponse, nil
 	}
 
 	query := `
@@ -344,22 +717,51 @@ func (c *productController) ListProducts(ctx context.Context, req *pb.ListProduc
 		id,
 		name,
 		description,
-		price,
+		` + effectivePriceColumns + `,
 		category,
+		` + categoryNameColumn + `,
 		tags,
 		created_at,
 		updated_at,
 		product_state,
 		product_status,
-		variation
-	FROM products
-	`
+		variation,
+		COALESCE(product_type, ''),
+		COALESCE(category_id, 0),
+		lifecycle,
+		publish_at,
+		unpublish_at,
+		COALESCE(sku, ''),
+		COALESCE(slug, ''),
+		COALESCE(barcode, '')
+	FROM products` + effectivePriceJoin
 
 	args := []interface{}{}
-	// If a search term is provided, filter on the product name.
+	var conditions []string
+	// If a search term is provided, filter on the product name and its
+	// translations into the requested locale.
 	if req.SearchTerm != "" {
-		query += " WHERE name ILIKE $1"
-		args = append(args, fmt.Sprintf("%%%s%%", req.SearchTerm))
+		args = append(args, fmt.Sprintf("%%%s%%", req.SearchTerm), c.locales.Chain(locale))
+		conditions = append(conditions, fmt.Sprintf(
+			"(name ILIKE $%[1]d OR EXISTS (SELECT 1 FROM product_translations AS t WHERE t.product_id = products.id AND t.locale = ANY($%[2]d) AND t.name ILIKE $%[1]d))",
+			len(args)-1, len(args)))
+	}
+	// Attribute filters match products with at least one variant having all of them.
+	if len(req.VariantAttributes) > 0 {
+		var condition string
+		condition, args = variantAttributeFilter(req.VariantAttributes, args)
+		conditions = append(conditions, condition)
+	}
+	if req.CategoryId != 0 {
+		args = append(args, req.CategoryId)
+		conditions = append(conditions, categoryFilter(len(args)))
+	}
+	if lifecycles != nil {
+		args = append(args, lifecycles)
+		conditions = append(conditions, fmt.Sprintf("lifecycle = ANY($%d)", len(args)))
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
 	}
 
 	// Append ordering, limit, and offset.
@@ -377,23 +779,35 @@ func (c *productController) ListProducts(ctx context.Context, req *pb.ListProduc
 	products := []*pb.Product{}
 	for rows.Next() {
 		var (
-			id            int64
-			name          string
-			description   string
-			price         float64 // DECIMAL will be scanned as float64
-			category      string
-			tags          []string
-			createdAt     time.Time
-			updatedAt     time.Time
-			productState  string
-			productStatus string
-			variationJSON []byte // JSONB column
+			id             int64
+			name           string
+			description    string
+			price          string // DECIMAL is read as text to keep it exact
+			currency       string
+			storedCategory string
+			category       string
+			tags           []string
+			createdAt      time.Time
+			updatedAt      time.Time
+			productState   string
+			productStatus  string
+			variationJSON  []byte // JSONB column
+			productType    string
+			categoryID     int64
+			lifecycle      string
+			publishAt      *time.Time
+			unpublishAt    *time.Time
+			sku            string
+			slug           string
+			barcode        string
 		)
 		err := rows.Scan(
 			&id,
 			&name,
 			&description,
 			&price,
+			&currency,
+			&storedCategory,
 			&category,
 			&tags,
 			&createdAt,
@@ -401,6 +815,14 @@ func (c *productController) ListProducts(ctx context.Context, req *pb.ListProduc
 			&productState,
 			&productStatus,
 			&variationJSON,
+			&productType,
+			&categoryID,
+			&lifecycle,
+			&publishAt,
+			&unpublishAt,
+			&sku,
+			&slug,
+			&barcode,
 		)
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "failed to scan row: %v", err)
@@ -415,41 +837,26 @@ func (c *productController) ListProducts(ctx context.Context, req *pb.ListProduc
 			Id:            id,
 			Name:          name,
 			Description:   description,
-			Price:         float32(price),
 			Category:      category,
+			CategoryId:    categoryID,
 			Tags:          tags,
 			CreatedAt:     createdProto,
 			UpdatedAt:     updatedProto,
 			ProductState:  c.convertProductState(productState),
 			ProductStatus: c.convertProductStatus(productStatus),
+			Lifecycle:     lifecycleFromName(lifecycle),
+			PublishAt:     optionalTimestamp(publishAt),
+			UnpublishAt:   optionalTimestamp(unpublishAt),
+			Sku:           sku,
+			Slug:          slug,
+			Barcode:       barcode,
+		}
+		if err := setPrice(product, price, currency); err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
 		}
 
-		// Unmarshal the variation JSON based on the product category.
-		// (Assuming the category indicates which variation message to use.)
-		switch category {
-		case "clothing":
-			var clothing pb.ClothingVariation
-			if err := protojson.Unmarshal(variationJSON, &clothing); err != nil {
-				return nil, status.Errorf(codes.Internal, "failed to unmarshal clothing variation: %v", err)
-			}
-			product.Variation = &pb.Product_Clothing{Clothing: &clothing}
-
-		case "electronics":
-			var electronics pb.ElectronicsVariation
-			if err := protojson.Unmarshal(variationJSON, &electronics); err != nil {
-				return nil, status.Errorf(codes.Internal, "failed to unmarshal electronics variation: %v", err)
-			}
-			product.Variation = &pb.Product_Electronics{Electronics: &electronics}
-
-		case "food":
-			var food pb.FoodVariation
-			if err := protojson.Unmarshal(variationJSON, &food); err != nil {
-				return nil, status.Errorf(codes.Internal, "failed to unmarshal food variation: %v", err)
-			}
-			product.Variation = &pb.Product_Food{Food: &food}
-
-		default:
-			// If no known category is set, you could choose to log or ignore.
+		if err := setVariation(product, productType, storedCategory, variationJSON); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to decode variation of product %d: %v", id, err)
 		}
 
 		products = append(products, product)
@@ -459,6 +866,31 @@ func (c *productController) ListProducts(ctx context.Context, req *pb.ListProduc
 		return nil, status.Errorf(codes.Internal, "error iterating rows: %v", err)
 	}
 
+	productIDs := make([]int64, len(products))
+	for i, product := range products {
+		productIDs[i] = product.Id
+	}
+	priceLists, err := loadPriceLists(ctx, c.pool, productIDs)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	variants, err := loadVariants(ctx, c.pool, c.inventory, productIDs)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	productMedia, err := loadMedia(ctx, c.pool, c.mediaURL, productIDs)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	for _, product := range products {
+		product.PriceList = priceLists[product.Id]
+		product.Variants = variants[product.Id]
+		product.Media = productMedia[product.Id]
+	}
+	if err := c.localize(ctx, products, locale); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
 	// Calculate the next page token.
 	// If the number of returned products equals pageSize then there might be more.
 	nextPageToken := ""
@@ -472,18 +904,44 @@ func (c *productController) ListProducts(ctx context.Context, req *pb.ListProduc
 	}
 
 	// Cache the product list for 1 hour (3600 seconds).
-	productBytes, err := protojson.Marshal(response)
-	if err != nil {
-		slog.Warn("failed to marshal product list for caching", "key", cacheKey, "error", err)
-	} else {
-		if err := c.memcachedClient.Set(ctx, cacheKey, productBytes, 3600); err != nil {
-			slog.Warn("failed to set product list in cache", "key", cacheKey, "error", err)
+	if err := c.codec.Set(ctx, cacheKey, response, 3600); err != nil {
+		slog.Warn("failed to set product list in cache", "key", cacheKey, "error", err)
+	}
+
+	// Prices are converted after caching so one entry serves every currency.
+	now := time.Now()
+	for _, product := range response.Products {
+		if err := c.presentPrice(product, currency, now); err != nil {
+			return nil, err
 		}
 	}
 	return response, nil
 
 }
 
+// presentPrice converts the price of product to currency and evaluates the
+// promotions running at now. Neither is cached, since both change
+// independently of the product.
+func (c *productController) presentPrice(product *pb.Product, currency string, now time.Time) error {
+	if err := applyCurrency(c.converter, product, currency); err != nil {
+		return err
+	}
+	c.promotions.Evaluate(product, now)
+	return nil
+}
+
+// setPrice fills both the exact price and the deprecated float price of product
+// from the text form of a DECIMAL column.
+func setPrice(product *pb.Product, price, currency string) error {
+	amount, err := decimal.NewFromString(price)
+	if err != nil {
+		return fmt.Errorf("invalid stored price %q: %w", price, err)
+	}
+	product.Price = money.ToFloat(amount)
+	product.PriceMoney = money.FromDecimal(amount, currency)
+	return nil
+}
+
 // Helper conversion functions (adjust enum values based on your proto definitions).
 func (c *productController) convertProductState(state string) pb.ProductState {
 	switch state {
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/producttypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type productTypeController struct {
+	registry *producttypes.Registry
+	// adminRoles may define product types.
+	adminRoles []string
+	pb.UnimplementedProductTypeServiceServer
+}
+
+// NewProductTypeController returns an instance that implements pb.ProductTypeServiceServer.
+// Only callers with one of adminRoles may define product types.
+func NewProductTypeController(registry *producttypes.Registry, adminRoles []string) pb.ProductTypeServiceServer {
+	return &productTypeController{registry: registry, adminRoles: adminRoles}
+}
+
+func (c *productTypeController) DefineProductType(ctx context.Context, req *pb.DefineProductTypeRequest) (*pb.DefineProductTypeResponse, error) {
+	if _, err := authorize(ctx, "defining product types", c.adminRoles); err != nil {
+		return nil, err
+	}
+	if req.GetProductType() == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "product type is required")
+	}
+	productType, err := c.registry.Define(ctx, req.GetProductType())
+	if err != nil {
+		return nil, productTypeError(err)
+	}
+	return &pb.DefineProductTypeResponse{ProductType: productType}, nil
+}
+
+func (c *productTypeController) GetProductType(ctx context.Context, req *pb.GetProductTypeRequest) (*pb.GetProductTypeResponse, error) {
+	productType, err := c.registry.Get(ctx, req.GetName())
+	if err != nil {
+		return nil, productTypeError(err)
+	}
+	return &pb.GetProductTypeResponse{ProductType: productType}, nil
+}
+
+func (c *productTypeController) ListProductTypes(ctx context.Context, req *pb.ListProductTypesRequest) (*pb.ListProductTypesResponse, error) {
+	productTypes, err := c.registry.List(ctx)
+	if err != nil {
+		return nil, productTypeError(err)
+	}
+	return &pb.ListProductTypesResponse{ProductTypes: productTypes}, nil
+}
+
+// productTypeError maps registry errors to gRPC status errors.
+func productTypeError(err error) error {
+	switch {
+	case errors.Is(err, producttypes.ErrUnknownType):
+		return status.Errorf(codes.NotFound, "%v", err)
+	case errors.Is(err, producttypes.ErrInvalidType), errors.Is(err, producttypes.ErrInvalidAttributes):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	default:
+		return status.Errorf(codes.Internal, "%v", err)
+	}
+}
+
+// builtinVariation returns the product type and message of the variation
+// oneof of product, which predates the registry. The built-in types are
+// registered by schema.sql under the same names.
+func builtinVariation(product *pb.Product) (string, proto.Message) {
+	switch v := product.GetVariation().(type) {
+	case *pb.Product_Clothing:
+		return "clothing", v.Clothing
+	case *pb.Product_Electronics:
+		return "electronics", v.Electronics
+	case *pb.Product_Food:
+		return "food", v.Food
+	default:
+		return "", nil
+	}
+}
+
+// resolveProductType determines the product type and attributes of a product
+// being written from its variation oneof or the requested type and
+// attributes, validates them against the registry and returns them with the
+// variation column value. It returns an empty type when the product has
+// neither.
+func (c *productController) resolveProductType(ctx context.Context, product *pb.Product, productType string, attributes *structpb.Struct) (string, *structpb.Struct, []byte, error) {
+	kind, message := builtinVariation(product)
+	if kind != "" {
+		if productType != "" && productType != kind {
+			return "", nil, nil, status.Errorf(codes.InvalidArgument, "product type %q does not match the %s variation", productType, kind)
+		}
+		if attributes != nil {
+			return "", nil, nil, status.Errorf(codes.InvalidArgument, "attributes cannot be combined with a variation")
+		}
+		var err error
+		if attributes, err = producttypes.MessageAttributes(message); err != nil {
+			return "", nil, nil, status.Errorf(codes.InvalidArgument, "invalid variation: %v", err)
+		}
+		productType = kind
+	} else if producttypes.IsBuiltin(productType) {
+		// Built-in types are written and read through the oneof.
+		return "", nil, nil, status.Errorf(codes.InvalidArgument, "products of type %s must set the %s variation", productType, productType)
+	}
+	if productType == "" {
+		if attributes != nil {
+			return "", nil, nil, status.Errorf(codes.InvalidArgument, "attributes require a product type")
+		}
+		return "", nil, []byte("{}"), nil
+	}
+
+	if err := c.types.ValidateAttributes(ctx, productType, attributes.AsMap()); err != nil {
+		if errors.Is(err, producttypes.ErrUnknownType) {
+			return "", nil, nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		return "", nil, nil, productTypeError(err)
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if message != nil {
+		data, err = producttypes.EncodeMessage(message)
+	} else {
+		data, err = producttypes.EncodeAttributes(attributes)
+	}
+	if err != nil {
+		return "", nil, nil, status.Errorf(codes.Internal, "failed to encode variation: %v", err)
+	}
+	return productType, attributes, data, nil
+}
+
+// setVariation decodes the variation column of a product into its variation
+// oneof, product type and attributes. category is the products.category
+// column, which legacy encodings are decoded by.
+func setVariation(product *pb.Product, productType, category string, data []byte) error {
+	variation, err := producttypes.DecodeAny(productType, category, data)
+	if err != nil {
+		return err
+	}
+	switch message := variation.Message.(type) {
+	case *pb.ClothingVariation:
+		product.Variation = &pb.Product_Clothing{Clothing: message}
+	case *pb.ElectronicsVariation:
+		product.Variation = &pb.Product_Electronics{Electronics: message}
+	case *pb.FoodVariation:
+		product.Variation = &pb.Product_Food{Food: message}
+	}
+	product.ProductType = variation.Type
+	product.Attributes = variation.Attributes
+	return nil
+}
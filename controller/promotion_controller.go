@@ -0,0 +1,268 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/money"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pricing"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/promotions"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type promotionController struct {
+	pool      database.Pool
+	publisher events.Publisher
+	converter *pricing.Converter
+	engine    *promotions.Engine
+	// adminRoles may create, update and delete promotions.
+	adminRoles []string
+	pb.UnimplementedPromotionServiceServer
+}
+
+// NewPromotionController returns an instance that implements pb.PromotionServiceServer.
+// Only callers with one of adminRoles may change promotions.
+func NewPromotionController(pool database.Pool, publisher events.Publisher, converter *pricing.Converter, engine *promotions.Engine, adminRoles []string) pb.PromotionServiceServer {
+	return &promotionController{
+		pool:       pool,
+		publisher:  publisher,
+		converter:  converter,
+		engine:     engine,
+		adminRoles: adminRoles,
+	}
+}
+
+// PromotionRefresher returns an events.Handler that reloads promotions when
+// another replica changes them.
+func PromotionRefresher(ctx context.Context, engine *promotions.Engine) events.Handler {
+	return func(event events.Event) {
+		if event.Kind != events.PromotionsUpdated {
+			return
+		}
+		if err := engine.Refresh(ctx); err != nil {
+			slog.Warn("failed to refresh promotions", "error", err)
+		}
+	}
+}
+
+func (c *promotionController) CreatePromotion(ctx context.Context, req *pb.CreatePromotionRequest) (*pb.CreatePromotionResponse, error) {
+	if _, err := authorize(ctx, "creating promotions", c.adminRoles); err != nil {
+		return nil, err
+	}
+	args, err := c.promotionArgs(req.GetPromotion())
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO promotions (name, discount_type, percentage, amount_off, currency, categories, tags, product_ids, stackable, starts_at, ends_at)
+	VALUES ($1, $2, $3::DECIMAL, $4::DECIMAL, $5, $6, $7, $8, $9, $10, $11)
+	RETURNING ` + promotions.Columns
+	promotion, err := promotions.Scan(c.pool.QueryRow(ctx, query, args...))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create promotion: %v", err)
+	}
+
+	c.promotionsChanged(ctx)
+	return &pb.CreatePromotionResponse{Promotion: promotion}, nil
+}
+
+func (c *promotionController) GetPromotion(ctx context.Context, req *pb.GetPromotionRequest) (*pb.GetPromotionResponse, error) {
+	if req.GetId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "promotion id is required")
+	}
+
+	query := `SELECT ` + promotions.Columns + ` FROM promotions WHERE id = $1`
+	promotion, err := promotions.Scan(c.pool.QueryRow(ctx, query, req.GetId()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, status.Errorf(codes.NotFound, "promotion not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get promotion: %v", err)
+	}
+	return &pb.GetPromotionResponse{Promotion: promotion}, nil
+}
+
+func (c *promotionController) ListPromotions(ctx context.Context, req *pb.ListPromotionsRequest) (*pb.ListPromotionsResponse, error) {
+	pageSize := clampPageSize(req.GetPageSize(), 50)
+	offset := 0
+	if req.GetPageToken() != "" {
+		var err error
+		offset, err = strconv.Atoi(req.GetPageToken())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+
+	query := `SELECT ` + promotions.Columns + ` FROM promotions`
+	if req.GetActiveOnly() {
+		query += ` WHERE (starts_at IS NULL OR starts_at <= now()) AND (ends_at IS NULL OR ends_at > now())`
+	}
+	query += ` ORDER BY id LIMIT $1 OFFSET $2`
+
+	rows, err := c.pool.Query(ctx, query, pageSize, offset)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "query error: %v", err)
+	}
+	defer rows.Close()
+
+	response := &pb.ListPromotionsResponse{}
+	for rows.Next() {
+		promotion, err := promotions.Scan(rows)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to scan row: %v", err)
+		}
+		response.Promotions = append(response.Promotions, promotion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "error iterating rows: %v", err)
+	}
+
+	if len(response.Promotions) == int(pageSize) {
+		response.NextPageToken = strconv.Itoa(offset + len(response.Promotions))
+	}
+	return response, nil
+}
+
+func (c *promotionController) UpdatePromotion(ctx context.Context, req *pb.UpdatePromotionRequest) (*pb.UpdatePromotionResponse, error) {
+	if _, err := authorize(ctx, "updating promotions", c.adminRoles); err != nil {
+		return nil, err
+	}
+	if req.GetPromotion().GetId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "promotion id is required")
+	}
+	args, err := c.promotionArgs(req.GetPromotion())
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, req.GetPromotion().GetId())
+
+	query := `
+	UPDATE promotions
+	SET
+		name = $1,
+		discount_type = $2,
+		percentage = $3::DECIMAL,
+		amount_off = $4::DECIMAL,
+		currency = $5,
+		categories = $6,
+		tags = $7,
+		product_ids = $8,
+		stackable = $9,
+		starts_at = $10,
+		ends_at = $11,
+		updated_at = now()
+	WHERE id = $12
+	RETURNING ` + promotions.Columns
+	promotion, err := promotions.Scan(c.pool.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, status.Errorf(codes.NotFound, "promotion not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to update promotion: %v", err)
+	}
+
+	c.promotionsChanged(ctx)
+	return &pb.UpdatePromotionResponse{Promotion: promotion}, nil
+}
+
+func (c *promotionController) DeletePromotion(ctx context.Context, req *pb.DeletePromotionRequest) (*pb.DeletePromotionResponse, error) {
+	if _, err := authorize(ctx, "deleting promotions", c.adminRoles); err != nil {
+		return nil, err
+	}
+	if req.GetId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "promotion id is required")
+	}
+
+	tag, err := c.pool.Exec(ctx, `DELETE FROM promotions WHERE id = $1`, req.GetId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to delete promotion: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, status.Errorf(codes.NotFound, "promotion not found")
+	}
+
+	c.promotionsChanged(ctx)
+	return &pb.DeletePromotionResponse{Deleted: true}, nil
+}
+
+// promotionArgs validates promotion and returns the column values shared by
+// CreatePromotion and UpdatePromotion, in the order of their placeholders.
+func (c *promotionController) promotionArgs(promotion *pb.Promotion) ([]interface{}, error) {
+	if promotion == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "promotion is required")
+	}
+	if err := promotions.Validate(promotion); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid promotion: %v", err)
+	}
+
+	var percentage, amountOff, currency *string
+	if promotion.GetDiscountType() == pb.DiscountType_PERCENTAGE {
+		value := promotion.GetPercentage()
+		percentage = &value
+	} else {
+		code, err := c.converter.NormalizeCurrency(promotion.GetAmountOff().GetCurrencyCode())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid amount_off: %v", err)
+		}
+		value := money.ToDecimal(promotion.GetAmountOff()).Round(money.Scale).String()
+		amountOff, currency = &value, &code
+	}
+
+	var startsAt, endsAt *time.Time
+	if promotion.GetStartsAt() != nil {
+		t := promotion.GetStartsAt().AsTime()
+		startsAt = &t
+	}
+	if promotion.GetEndsAt() != nil {
+		t := promotion.GetEndsAt().AsTime()
+		endsAt = &t
+	}
+
+	categories := promotion.GetCategories()
+	if categories == nil {
+		categories = []string{}
+	}
+	tags := promotion.GetTags()
+	if tags == nil {
+		tags = []string{}
+	}
+	productIDs := promotion.GetProductIds()
+	if productIDs == nil {
+		productIDs = []int64{}
+	}
+
+	return []interface{}{
+		promotion.GetName(),
+		promotion.GetDiscountType().String(),
+		percentage,
+		amountOff,
+		currency,
+		categories,
+		tags,
+		productIDs,
+		promotion.GetStackable(),
+		startsAt,
+		endsAt,
+	}, nil
+}
+
+// promotionsChanged reloads the promotions of this replica and tells the
+// others to do the same. Cached products hold no sale prices, so nothing
+// needs evicting.
+func (c *promotionController) promotionsChanged(ctx context.Context) {
+	if err := c.engine.Refresh(ctx); err != nil {
+		slog.Warn("failed to refresh promotions", "error", err)
+	}
+	if err := c.publisher.Publish(ctx, events.Event{Kind: events.PromotionsUpdated}); err != nil {
+		slog.Warn("failed to publish promotion update", "error", err)
+	}
+}
@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// scheduleBatchSize caps the transitions applied per scheduler run.
+const scheduleBatchSize = 100
+
+// optionalTime converts an optional timestamp for a nullable column.
+func optionalTime(ts *timestamppb.Timestamp) (*time.Time, error) {
+	if ts == nil {
+		return nil, nil
+	}
+	if err := ts.CheckValid(); err != nil {
+		return nil, err
+	}
+	t := ts.AsTime()
+	return &t, nil
+}
+
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func (c *productController) ScheduleProduct(ctx context.Context, req *pb.ScheduleProductRequest) (*pb.ScheduleProductResponse, error) {
+	productID := req.GetProductId()
+	if productID <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
+	}
+	publishAt, err := optionalTime(req.GetPublishAt())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid publish_at: %v", err)
+	}
+	unpublishAt, err := optionalTime(req.GetUnpublishAt())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid unpublish_at: %v", err)
+	}
+	switch {
+	case publishAt != nil && req.GetClearPublishAt():
+		return nil, status.Errorf(codes.InvalidArgument, "publish_at cannot be set and cleared at once")
+	case unpublishAt != nil && req.GetClearUnpublishAt():
+		return nil, status.Errorf(codes.InvalidArgument, "unpublish_at cannot be set and cleared at once")
+	case publishAt == nil && unpublishAt == nil && !req.GetClearPublishAt() && !req.GetClearUnpublishAt():
+		return nil, status.Errorf(codes.InvalidArgument, "nothing to schedule")
+	}
+
+	// Scheduling publication approves the product ahead of time.
+	roles := c.roles.staff()
+	if publishAt != nil {
+		roles = c.roles.Approvers
+	}
+	principal, err := authorize(ctx, "scheduling a product", roles)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fields that are neither set nor cleared keep their current value.
+	var scheduledPublish, scheduledUnpublish *time.Time
+	err = database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		var lifecycle string
+		query := `SELECT lifecycle, publish_at, unpublish_at FROM products WHERE id = $1 FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, productID).Scan(&lifecycle, &scheduledPublish, &scheduledUnpublish); err != nil {
+			return err
+		}
+		switch state := lifecycleFromName(lifecycle); {
+		case publishAt != nil && state != pb.LifecycleState_LIFECYCLE_IN_REVIEW:
+			return status.Errorf(codes.FailedPrecondition, "only products in review can be scheduled for publication, product is %s", lifecycle)
+		case unpublishAt != nil && state != pb.LifecycleState_LIFECYCLE_DRAFT && state != pb.LifecycleState_LIFECYCLE_IN_REVIEW && state != pb.LifecycleState_LIFECYCLE_PUBLISHED:
+			return status.Errorf(codes.FailedPrecondition, "%s products cannot be scheduled for withdrawal", lifecycle)
+		}
+
+		switch {
+		case publishAt != nil:
+			scheduledPublish = publishAt
+		case req.GetClearPublishAt():
+			scheduledPublish = nil
+		}
+		switch {
+		case unpublishAt != nil:
+			scheduledUnpublish = unpublishAt
+		case req.GetClearUnpublishAt():
+			scheduledUnpublish = nil
+		}
+		if scheduledPublish != nil && scheduledUnpublish != nil && !scheduledUnpublish.After(*scheduledPublish) {
+			return status.Errorf(codes.InvalidArgument, "unpublish_at must be after publish_at")
+		}
+
+		if publishAt != nil {
+			if err := readyForReview(ctx, tx, productID); err != nil {
+				return err
+			}
+			if err := notSubmittedBy(principal.Subject)(ctx, tx, productID); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.Exec(ctx, `UPDATE products SET publish_at = $2, unpublish_at = $3, updated_at = now() WHERE id = $1`, productID, scheduledPublish, scheduledUnpublish)
+		return err
+	})
+	if err != nil {
+		return nil, lifecycleError(err)
+	}
+
+	productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, productID)
+	return &pb.ScheduleProductResponse{
+		ProductId:   productID,
+		PublishAt:   optionalTimestamp(scheduledPublish),
+		UnpublishAt: optionalTimestamp(scheduledUnpublish),
+	}, nil
+}
+
+// PublishScheduledProducts runs until ctx is cancelled, checking every
+// interval for products whose publish_at or unpublish_at has passed and
+// moving them to PUBLISHED or DISCONTINUED. Only the replica holding lease
+// applies schedules, and every transition checks the lease in its
+// transaction, so each one is applied and its event published exactly once.
+func PublishScheduledProducts(ctx context.Context, pool database.Pool, cache database.CacheMethods, publisher events.Publisher, lease *database.Lease, interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := lease.Release(releaseCtx); err != nil {
+			slog.Warn("failed to release the publication lease", "error", err)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		held, err := lease.Acquire(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("failed to acquire the publication lease", "error", err)
+			}
+			continue
+		}
+		if !held {
+			continue
+		}
+		if err := applySchedules(ctx, pool, cache, publisher, lease); err != nil && ctx.Err() == nil {
+			slog.Warn("failed to apply product schedules", "error", err)
+		}
+	}
+}
+
+// applySchedules applies the transitions that are due.
+func applySchedules(ctx context.Context, pool database.Pool, cache database.CacheMethods, publisher events.Publisher, lease *database.Lease) error {
+	query := `
+	SELECT id, lifecycle FROM products
+	WHERE (lifecycle = 'IN_REVIEW' AND publish_at <= now())
+		OR (lifecycle = 'PUBLISHED' AND unpublish_at <= now())
+	ORDER BY id
+	LIMIT $1`
+	rows, err := pool.Query(ctx, query, scheduleBatchSize)
+	if err != nil {
+		return err
+	}
+	type due struct {
+		productID int64
+		lifecycle string
+	}
+	dueProducts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (due, error) {
+		var d due
+		err := row.Scan(&d.productID, &d.lifecycle)
+		return d, err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, d := range dueProducts {
+		to, note := pb.LifecycleState_LIFECYCLE_PUBLISHED, "scheduled publication"
+		holdsLease := func(ctx context.Context, tx pgx.Tx, _ int64) error { return lease.Check(ctx, tx) }
+		guards := []lifecycleGuard{holdsLease, readyForReview}
+		if lifecycleFromName(d.lifecycle) == pb.LifecycleState_LIFECYCLE_PUBLISHED {
+			to, note = pb.LifecycleState_LIFECYCLE_DISCONTINUED, "scheduled withdrawal"
+			guards = guards[:1]
+		}
+		guard := func(ctx context.Context, tx pgx.Tx, productID int64) error {
+			for _, guard := range guards {
+				if err := guard(ctx, tx, productID); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		_, err := transitionProduct(ctx, pool, publisher, d.productID, to, "", note, guard)
+		switch {
+		case err == nil:
+			slog.Info("applied product schedule", "product_id", d.productID, "lifecycle", lifecycleName(to))
+			evictProduct(ctx, cache, d.productID)
+		case errors.Is(err, database.ErrLeaseLost):
+			return err
+		case errors.Is(err, pgx.ErrNoRows), errors.Is(err, errInvalidTransition):
+			// Deleted or moved by hand since it was read.
+		case status.Code(err) == codes.FailedPrecondition:
+			// The product was edited during review and is no longer ready;
+			// drop the schedule rather than retrying it forever.
+			slog.Warn("dropping the publication schedule of a product that is not ready", "product_id", d.productID, "error", err)
+			if _, err := pool.Exec(ctx, `UPDATE products SET publish_at = NULL WHERE id = $1 AND lifecycle = 'IN_REVIEW'`, d.productID); err != nil {
+				return err
+			}
+			evictProduct(ctx, cache, d.productID)
+		default:
+			return err
+		}
+	}
+	return nil
+}
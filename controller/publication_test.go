@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	lockScheduleQuery  = `SELECT lifecycle, publish_at, unpublish_at FROM products WHERE id = $1 FOR UPDATE`
+	readyQuery         = `SELECT name, COALESCE(description, ''), COALESCE(category, ''), price > 0 FROM products WHERE id = $1`
+	submitterQuery     = `SELECT actor FROM product_transitions WHERE product_id = $1 AND to_state = 'IN_REVIEW'`
+	saveScheduleQuery  = `UPDATE products SET publish_at = $2, unpublish_at = $3, updated_at = now() WHERE id = $1`
+	checkLeaseQuery    = `SELECT holder = $2 AND expires_at > now() FROM leases WHERE name = $1`
+	dropScheduleQuery  = `UPDATE products SET publish_at = NULL WHERE id = $1 AND lifecycle = 'IN_REVIEW'`
+	publicationLeaseID = "product-publication"
+)
+
+var transitionRowColumns = []string{"id", "product_id", "from_state", "to_state", "actor", "note", "created_at"}
+
+func TestScheduleProductArguments(t *testing.T) {
+	inAnHour := timestamppb.New(time.Now().Add(time.Hour))
+	tests := []struct {
+		name string
+		ctx  context.Context
+		req  *pb.ScheduleProductRequest
+		want codes.Code
+	}{
+		{"nothing to schedule", callerWith("mia", "catalog-manager"), &pb.ScheduleProductRequest{ProductId: 1}, codes.InvalidArgument},
+		{"publish_at set and cleared", callerWith("mia", "catalog-manager"), &pb.ScheduleProductRequest{ProductId: 1, PublishAt: inAnHour, ClearPublishAt: true}, codes.InvalidArgument},
+		{"invalid publish_at", callerWith("mia", "catalog-manager"), &pb.ScheduleProductRequest{ProductId: 1, PublishAt: &timestamppb.Timestamp{Nanos: -1}}, codes.InvalidArgument},
+		// Scheduling publication approves the product ahead of time.
+		{"publication by an editor", callerWith("ed", "catalog-editor"), &pb.ScheduleProductRequest{ProductId: 1, PublishAt: inAnHour}, codes.PermissionDenied},
+		{"withdrawal by the public", callerWith("alice", "customer"), &pb.ScheduleProductRequest{ProductId: 1, UnpublishAt: inAnHour}, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, _ := newTestProductController(newMockPool(t))
+			_, err := c.ScheduleProduct(tt.ctx, tt.req)
+			wantCode(t, err, tt.want)
+		})
+	}
+}
+
+func TestSchedulePublicationOutsideReview(t *testing.T) {
+	for _, lifecycle := range []string{"DRAFT", "PUBLISHED", "DISCONTINUED", "ARCHIVED"} {
+		t.Run(lifecycle, func(t *testing.T) {
+			pool := newMockPool(t)
+			pool.ExpectBeginTx(txOptions)
+			pool.ExpectQuery(regexp.QuoteMeta(lockScheduleQuery)).WithArgs(int64(1)).
+				WillReturnRows(pgxmock.NewRows([]string{"lifecycle", "publish_at", "unpublish_at"}).AddRow(lifecycle, nil, nil))
+			expectRollback(pool)
+
+			c, _, _ := newTestProductController(pool)
+			_, err := c.ScheduleProduct(callerWith("mia", "catalog-manager"), &pb.ScheduleProductRequest{ProductId: 1, PublishAt: timestamppb.New(time.Now().Add(time.Hour))})
+			wantCode(t, err, codes.FailedPrecondition)
+		})
+	}
+}
+
+func TestScheduleWithdrawalBeforePublication(t *testing.T) {
+	publishAt := time.Now().Add(2 * time.Hour).UTC()
+	pool := newMockPool(t)
+	pool.ExpectBeginTx(txOptions)
+	pool.ExpectQuery(regexp.QuoteMeta(lockScheduleQuery)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"lifecycle", "publish_at", "unpublish_at"}).AddRow("IN_REVIEW", &publishAt, nil))
+	expectRollback(pool)
+
+	c, _, _ := newTestProductController(pool)
+	_, err := c.ScheduleProduct(callerWith("ed", "catalog-editor"), &pb.ScheduleProductRequest{ProductId: 1, UnpublishAt: timestamppb.New(publishAt.Add(-time.Hour))})
+	wantCode(t, err, codes.InvalidArgument)
+}
+
+func TestSchedulePublicationBySubmitter(t *testing.T) {
+	pool := newMockPool(t)
+	pool.ExpectBeginTx(txOptions)
+	pool.ExpectQuery(regexp.QuoteMeta(lockScheduleQuery)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"lifecycle", "publish_at", "unpublish_at"}).AddRow("IN_REVIEW", nil, nil))
+	pool.ExpectQuery(regexp.QuoteMeta(readyQuery)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"name", "description", "category", "priced"}).AddRow("Desk", "Solid oak", "furniture", true))
+	pool.ExpectQuery(regexp.QuoteMeta(submitterQuery)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"actor"}).AddRow("mia"))
+	expectRollback(pool)
+
+	c, _, _ := newTestProductController(pool)
+	_, err := c.ScheduleProduct(callerWith("mia", "catalog-manager"), &pb.ScheduleProductRequest{ProductId: 1, PublishAt: timestamppb.New(time.Now().Add(time.Hour))})
+	wantCode(t, err, codes.PermissionDenied)
+}
+
+func TestSchedulePublication(t *testing.T) {
+	publishAt := timestamppb.New(time.Now().Add(time.Hour))
+	want := publishAt.AsTime()
+	pool := newMockPool(t)
+	pool.ExpectBeginTx(txOptions)
+	pool.ExpectQuery(regexp.QuoteMeta(lockScheduleQuery)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"lifecycle", "publish_at", "unpublish_at"}).AddRow("IN_REVIEW", nil, nil))
+	pool.ExpectQuery(regexp.QuoteMeta(readyQuery)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"name", "description", "category", "priced"}).AddRow("Desk", "Solid oak", "furniture", true))
+	pool.ExpectQuery(regexp.QuoteMeta(submitterQuery)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"actor"}).AddRow("ed"))
+	pool.ExpectExec(regexp.QuoteMeta(saveScheduleQuery)).WithArgs(int64(1), &want, (*time.Time)(nil)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectCommit(pool)
+
+	c, publisher, _ := newTestProductController(pool)
+	response, err := c.ScheduleProduct(callerWith("mia", "catalog-manager"), &pb.ScheduleProductRequest{ProductId: 1, PublishAt: publishAt})
+	if err != nil {
+		t.Fatalf("ScheduleProduct: %v", err)
+	}
+	if !response.GetPublishAt().AsTime().Equal(want) || response.GetUnpublishAt() != nil {
+		t.Errorf("schedule = %v to %v, want %v to never", response.GetPublishAt(), response.GetUnpublishAt(), want)
+	}
+	if kinds := publisher.kinds(); !slices.Equal(kinds, []events.Kind{events.ProductUpdated}) {
+		t.Errorf("published %v, want %v", kinds, events.ProductUpdated)
+	}
+}
+
+// expectDueProducts expects applySchedules to look for due schedules and
+// find products, given as pairs of id and lifecycle.
+func expectDueProducts(pool pgxmock.PgxPoolIface, products ...interface{}) {
+	rows := pgxmock.NewRows([]string{"id", "lifecycle"})
+	for i := 0; i < len(products); i += 2 {
+		rows.AddRow(products[i], products[i+1])
+	}
+	pool.ExpectQuery(`publish_at <= now\(\)`).WithArgs(scheduleBatchSize).WillReturnRows(rows)
+}
+
+// expectScheduledTransition expects the transaction of a scheduled
+// transition up to its guards.
+func expectScheduledTransition(pool pgxmock.PgxPoolIface, productID int64, lifecycle string, holdsLease bool) {
+	pool.ExpectBeginTx(txOptions)
+	pool.ExpectQuery(regexp.QuoteMeta(lockProductQuery)).WithArgs(productID).
+		WillReturnRows(pgxmock.NewRows([]string{"lifecycle"}).AddRow(lifecycle))
+	pool.ExpectQuery(regexp.QuoteMeta(checkLeaseQuery)).WithArgs(publicationLeaseID, pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"held"}).AddRow(holdsLease))
+}
+
+// expectTransitionWrite expects a transition that passed its guards to be
+// written and committed.
+func expectTransitionWrite(pool pgxmock.PgxPoolIface, productID int64, from, to, note string) {
+	pool.ExpectExec(`UPDATE products\s+SET\s+lifecycle = \$2`).WithArgs(productID, to).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	pool.ExpectQuery(`INSERT INTO product_transitions`).WithArgs(productID, from, to, "", note).
+		WillReturnRows(pgxmock.NewRows(transitionRowColumns).AddRow(productID*10, productID, from, to, "", note, time.Now()))
+	expectCommit(pool)
+}
+
+func TestApplySchedules(t *testing.T) {
+	pool := newMockPool(t)
+	expectDueProducts(pool, int64(1), "IN_REVIEW", int64(2), "PUBLISHED", int64(3), "IN_REVIEW")
+
+	// Due for publication and still ready.
+	expectScheduledTransition(pool, 1, "IN_REVIEW", true)
+	pool.ExpectQuery(regexp.QuoteMeta(readyQuery)).WithArgs(int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"name", "description", "category", "priced"}).AddRow("Desk", "Solid oak", "furniture", true))
+	expectTransitionWrite(pool, 1, "IN_REVIEW", "PUBLISHED", "scheduled publication")
+
+	// Due for withdrawal.
+	expectScheduledTransition(pool, 2, "PUBLISHED", true)
+	expectTransitionWrite(pool, 2, "PUBLISHED", "DISCONTINUED", "scheduled withdrawal")
+
+	// Edited during review so that it is no longer ready: its schedule is
+	// dropped instead of being retried forever.
+	expectScheduledTransition(pool, 3, "IN_REVIEW", true)
+	pool.ExpectQuery(regexp.QuoteMeta(readyQuery)).WithArgs(int64(3)).
+		WillReturnRows(pgxmock.NewRows([]string{"name", "description", "category", "priced"}).AddRow("Lamp", "", "lighting", true))
+	expectRollback(pool)
+	pool.ExpectExec(regexp.QuoteMeta(dropScheduleQuery)).WithArgs(int64(3)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	cache := database.NewLocalCache(100, time.Minute)
+	publisher := &recordingPublisher{}
+	lease := database.NewLease(nil, publicationLeaseID, time.Minute)
+	if err := applySchedules(context.Background(), pool, cache, publisher, lease); err != nil {
+		t.Fatalf("applySchedules: %v", err)
+	}
+	if want := []events.Kind{events.ProductPublished, events.ProductUnpublished}; !slices.Equal(publisher.kinds(), want) {
+		t.Errorf("published %v, want %v", publisher.kinds(), want)
+	}
+}
+
+func TestApplySchedulesWithoutLease(t *testing.T) {
+	pool := newMockPool(t)
+	expectDueProducts(pool, int64(1), "IN_REVIEW", int64(2), "PUBLISHED")
+	// Another replica took the lease over: nothing is applied, not even the
+	// products after the first one.
+	expectScheduledTransition(pool, 1, "IN_REVIEW", false)
+	expectRollback(pool)
+
+	publisher := &recordingPublisher{}
+	lease := database.NewLease(nil, publicationLeaseID, time.Minute)
+	err := applySchedules(context.Background(), pool, database.NewLocalCache(100, time.Minute), publisher, lease)
+	if !errors.Is(err, database.ErrLeaseLost) {
+		t.Fatalf("applySchedules = %v, want %v", err, database.ErrLeaseLost)
+	}
+	if len(publisher.events) != 0 {
+		t.Errorf("published %v without the lease", publisher.kinds())
+	}
+}
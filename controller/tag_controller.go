@@ -0,0 +1,266 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/tags"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// mergeTagsBatchSize bounds the products rewritten per transaction by
+	// MergeTags, keeping transactions short on large catalogs.
+	mergeTagsBatchSize = 100
+	defaultTagLimit    = 10
+	maxTagLimit        = 100
+)
+
+// tagColumns selects a tag with the number of products carrying it, using the
+// inverted index on products.tags.
+const tagColumns = `t.name, (SELECT count(*) FROM products AS p WHERE p.tags @> ARRAY[t.name])`
+
+type tagController struct {
+	pool      database.Pool
+	cache     database.CacheMethods
+	publisher events.Publisher
+	// adminRoles may merge tags.
+	adminRoles []string
+	pb.UnimplementedTagServiceServer
+}
+
+// NewTagController returns an instance that implements pb.TagServiceServer.
+// Only callers with one of adminRoles may merge tags.
+func NewTagController(pool database.Pool, cache database.CacheMethods, publisher events.Publisher, adminRoles []string) pb.TagServiceServer {
+	return &tagController{
+		pool:       pool,
+		cache:      cache,
+		publisher:  publisher,
+		adminRoles: adminRoles,
+	}
+}
+
+// normalizeTags normalizes the tags of a product being written.
+func normalizeTags(values []string) ([]string, error) {
+	normalized := tags.NormalizeAll(values)
+	for _, tag := range normalized {
+		if len(tag) > tags.MaxLength {
+			return nil, status.Errorf(codes.InvalidArgument, "tag %q is longer than %d bytes", tag, tags.MaxLength)
+		}
+	}
+	return normalized, nil
+}
+
+// recordTags adds tags to the vocabulary.
+func recordTags(ctx context.Context, pool database.Pool, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	_, err := pool.Exec(ctx, `INSERT INTO tags (name) SELECT unnest($1::STRING[]) ON CONFLICT (name) DO NOTHING`, names)
+	return err
+}
+
+// likePrefix escapes prefix for a LIKE pattern matching strings that start with it.
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
+
+func scanTags(rows pgx.Rows) ([]*pb.Tag, error) {
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*pb.Tag, error) {
+		var tag pb.Tag
+		err := row.Scan(&tag.Name, &tag.ProductCount)
+		return &tag, err
+	})
+}
+
+func (c *tagController) ListTags(ctx context.Context, req *pb.ListTagsRequest) (*pb.ListTagsResponse, error) {
+	pageSize := clampPageSize(req.GetPageSize(), 50)
+	offset := 0
+	if req.GetPageToken() != "" {
+		var err error
+		offset, err = strconv.Atoi(req.GetPageToken())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+
+	query := `
+	SELECT ` + tagColumns + `
+	FROM tags AS t
+	WHERE t.name LIKE $1
+	ORDER BY t.name
+	LIMIT $2 OFFSET $3`
+	rows, err := c.pool.Query(ctx, query, likePrefix(tags.Normalize(req.GetPrefix())), pageSize, offset)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list tags: %v", err)
+	}
+	list, err := scanTags(rows)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list tags: %v", err)
+	}
+
+	response := &pb.ListTagsResponse{Tags: list}
+	if len(list) == int(pageSize) {
+		response.NextPageToken = strconv.Itoa(offset + len(list))
+	}
+	return response, nil
+}
+
+func (c *tagController) AutocompleteTags(ctx context.Context, req *pb.AutocompleteTagsRequest) (*pb.AutocompleteTagsResponse, error) {
+	prefix := tags.Normalize(req.GetPrefix())
+	if prefix == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "prefix is required")
+	}
+	limit := req.GetLimit()
+	if limit <= 0 {
+		limit = defaultTagLimit
+	}
+	limit = min(limit, maxTagLimit)
+
+	query := `
+	SELECT name, product_count FROM (
+		SELECT ` + tagColumns + ` AS product_count
+		FROM tags AS t
+		WHERE t.name LIKE $1
+	)
+	ORDER BY product_count DESC, name
+	LIMIT $2`
+	rows, err := c.pool.Query(ctx, query, likePrefix(prefix), limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to autocomplete tags: %v", err)
+	}
+	list, err := scanTags(rows)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to autocomplete tags: %v", err)
+	}
+	return &pb.AutocompleteTagsResponse{Tags: list}, nil
+}
+
+func (c *tagController) MergeTags(ctx context.Context, req *pb.MergeTagsRequest) (*pb.MergeTagsResponse, error) {
+	if _, err := authorize(ctx, "merging tags", c.adminRoles); err != nil {
+		return nil, err
+	}
+	target := tags.Normalize(req.GetTarget())
+	if target == "" || len(target) > tags.MaxLength {
+		return nil, status.Errorf(codes.InvalidArgument, "target must be 1 to %d bytes", tags.MaxLength)
+	}
+	var sources []string
+	for _, source := range tags.NormalizeAll(req.GetSources()) {
+		if source != target {
+			sources = append(sources, source)
+		}
+	}
+	// Products written before tags were normalized may carry a source as
+	// spelled in the request, so those spellings are replaced too, even when
+	// the source normalizes to the target.
+	for _, source := range req.GetSources() {
+		if source != target && !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "at least one source other than the target is required")
+	}
+
+	// Rewritten products no longer carry a source, so every batch picks up
+	// where the previous one ended, even if it committed only partially
+	// before a failure. As with UpdateProduct, archived products are left
+	// alone and products in review lose their publication schedule.
+	var updated int64
+	for {
+		var changed []int64
+		err := database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+			changed = changed[:0]
+			rows, err := tx.Query(ctx, `
+			SELECT id, tags FROM products
+			WHERE tags && $1::STRING[] AND lifecycle <> 'ARCHIVED'
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE`, sources, mergeTagsBatchSize)
+			if err != nil {
+				return err
+			}
+			type productTags struct {
+				id   int64
+				tags []string
+			}
+			batch, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (productTags, error) {
+				var p productTags
+				err := row.Scan(&p.id, &p.tags)
+				return p, err
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, p := range batch {
+				merged := mergeTags(p.tags, sources, target)
+				if _, err := tx.Exec(ctx, `
+				UPDATE products
+				SET tags = $2, updated_at = now(), publish_at = CASE WHEN lifecycle = 'IN_REVIEW' THEN NULL ELSE publish_at END
+				WHERE id = $1`, p.id, merged); err != nil {
+					return err
+				}
+				changed = append(changed, p.id)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to merge tags after updating %d products: %v", updated, err)
+		}
+
+		productsChanged(ctx, c.cache, c.publisher, events.TagsMerged, changed)
+		updated += int64(len(changed))
+		if len(changed) < mergeTagsBatchSize {
+			break
+		}
+	}
+
+	err := database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM tags WHERE name = ANY($1)`, sources); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, target)
+		return err
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to update tag vocabulary: %v", err)
+	}
+
+	response := &pb.MergeTagsResponse{Target: &pb.Tag{Name: target}, ProductsUpdated: updated}
+	if err := c.pool.QueryRow(ctx, `SELECT `+tagColumns+` FROM tags AS t WHERE t.name = $1`, target).Scan(&response.Target.Name, &response.Target.ProductCount); err != nil {
+		slog.Warn("failed to count tag", "tag", target, "error", err)
+	}
+	slog.Info("merged tags", "sources", sources, "target", target, "products", updated)
+	return response, nil
+}
+
+// mergeTags replaces every source in productTags with target, keeping the
+// position of the first occurrence and dropping duplicates.
+func mergeTags(productTags, sources []string, target string) []string {
+	replace := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		replace[source] = true
+	}
+	merged := make([]string, 0, len(productTags))
+	seen := make(map[string]bool, len(productTags))
+	for _, tag := range productTags {
+		if replace[tag] {
+			tag = target
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		merged = append(merged, tag)
+	}
+	return merged
+}
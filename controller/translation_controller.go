@@ -0,0 +1,344 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/locales"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	maxProductNameLength   = 255
+	maxVariationTextKeys   = 50
+	maxVariationTextLength = 255
+)
+
+const translationColumns = `locale, name, description, variation_text, updated_at`
+
+// scanTranslation scans translationColumns followed by any extra columns into extra.
+func scanTranslation(row pgx.Row, extra ...interface{}) (*pb.ProductTranslation, error) {
+	var (
+		translation   pb.ProductTranslation
+		variationText []byte
+		updatedAt     time.Time
+	)
+	dest := append([]interface{}{&translation.Locale, &translation.Name, &translation.Description, &variationText, &updatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(variationText, &translation.VariationText); err != nil {
+		return nil, fmt.Errorf("invalid stored variation text: %w", err)
+	}
+	translation.UpdatedAt = timestamppb.New(updatedAt)
+	return &translation, nil
+}
+
+// requestedLocale returns the configured locale closest to the one asked for
+// in the request, or in the accept-language metadata when the request names
+// none.
+func requestedLocale(ctx context.Context, resolver *locales.Resolver, locale string) string {
+	if locale == "" {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			locale = strings.Join(md.Get("accept-language"), ",")
+		}
+	}
+	return resolver.Match(locale)
+}
+
+// localize sets the locale of products and, unless it is the default one,
+// replaces their content with the translations found along its fallback
+// chain.
+func (c *productController) localize(ctx context.Context, products []*pb.Product, locale string) error {
+	for _, product := range products {
+		product.Locale = locale
+	}
+	if locale == c.locales.Default() || len(products) == 0 {
+		return nil
+	}
+
+	chain := c.locales.Chain(locale)
+	productIDs := make([]int64, len(products))
+	for i, product := range products {
+		productIDs[i] = product.Id
+	}
+	translations, err := loadTranslations(ctx, c.pool, productIDs, chain)
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		if list := translations[product.Id]; len(list) > 0 {
+			applyTranslations(product, list)
+		}
+	}
+	return nil
+}
+
+// loadTranslations returns the translations of products into the locales
+// of chain, each list ordered like chain.
+func loadTranslations(ctx context.Context, pool database.Pool, productIDs []int64, chain []string) (map[int64][]*pb.ProductTranslation, error) {
+	query := `SELECT ` + translationColumns + `, product_id FROM product_translations WHERE product_id = ANY($1) AND locale = ANY($2)`
+	rows, err := pool.Query(ctx, query, productIDs, chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load translations: %w", err)
+	}
+	defer rows.Close()
+
+	translations := make(map[int64][]*pb.ProductTranslation, len(productIDs))
+	for rows.Next() {
+		var productID int64
+		translation, err := scanTranslation(rows, &productID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan translation: %w", err)
+		}
+		translations[productID] = append(translations[productID], translation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load translations: %w", err)
+	}
+
+	rank := make(map[string]int, len(chain))
+	for i, locale := range chain {
+		rank[locale] = i
+	}
+	for _, list := range translations {
+		sort.Slice(list, func(i, j int) bool { return rank[list[i].Locale] < rank[list[j].Locale] })
+	}
+	return translations, nil
+}
+
+// applyTranslations overwrites the content of product with translations,
+// ordered from most to least preferred. Fields left empty by every
+// translation keep the content of the default locale.
+func applyTranslations(product *pb.Product, translations []*pb.ProductTranslation) {
+	text := make(map[string]string)
+	for i := len(translations) - 1; i >= 0; i-- {
+		translation := translations[i]
+		if translation.Name != "" {
+			product.Name = translation.Name
+		}
+		if translation.Description != "" {
+			product.Description = translation.Description
+		}
+		for key, value := range translation.VariationText {
+			if value != "" {
+				text[key] = value
+			}
+		}
+	}
+	if len(text) == 0 {
+		return
+	}
+
+	if _, message := builtinVariation(product); message != nil {
+		translateMessage(message, text)
+	}
+	translateStruct(product.Attributes, text)
+	for _, variant := range product.Variants {
+		if _, message := variantVariation(variant); message != nil {
+			translateMessage(message, text)
+		}
+	}
+}
+
+// translateMessage replaces the set string fields of message named in text.
+func translateMessage(message proto.Message, text map[string]string) {
+	m := message.ProtoReflect()
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if field.Kind() != protoreflect.StringKind || field.IsList() || field.IsMap() || !m.Has(field) {
+			continue
+		}
+		if value, ok := text[string(field.Name())]; ok {
+			m.Set(field, protoreflect.ValueOfString(value))
+		}
+	}
+}
+
+// translateStruct replaces the string attributes named in text.
+func translateStruct(attributes *structpb.Struct, text map[string]string) {
+	for key, value := range attributes.GetFields() {
+		if _, ok := value.GetKind().(*structpb.Value_StringValue); !ok {
+			continue
+		}
+		if translated, ok := text[key]; ok {
+			attributes.Fields[key] = structpb.NewStringValue(translated)
+		}
+	}
+}
+
+type translationController struct {
+	pool      database.Pool
+	cache     database.CacheMethods
+	publisher events.Publisher
+	locales   *locales.Resolver
+	roles     LifecycleRoles
+	pb.UnimplementedTranslationServiceServer
+}
+
+// NewTranslationController returns an instance that implements pb.TranslationServiceServer.
+// Only staff in roles may write translations.
+func NewTranslationController(pool database.Pool, cache database.CacheMethods, publisher events.Publisher, resolver *locales.Resolver, roles LifecycleRoles) pb.TranslationServiceServer {
+	return &translationController{
+		pool:      pool,
+		cache:     cache,
+		publisher: publisher,
+		locales:   resolver,
+		roles:     roles,
+	}
+}
+
+// translationLocale validates the locale of a translation being written.
+func (c *translationController) translationLocale(locale string) (string, error) {
+	locale, err := c.locales.Canonical(locale)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if locale == c.locales.Default() {
+		return "", status.Errorf(codes.InvalidArgument, "content in the default locale %s is written to the product itself", locale)
+	}
+	return locale, nil
+}
+
+func (c *translationController) SetProductTranslation(ctx context.Context, req *pb.SetProductTranslationRequest) (*pb.SetProductTranslationResponse, error) {
+	translation := req.GetTranslation()
+	if req.GetProductId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
+	}
+	if translation == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "translation is required")
+	}
+	if _, err := authorize(ctx, "translating a product", c.roles.staff()); err != nil {
+		return nil, err
+	}
+	locale, err := c.translationLocale(translation.GetLocale())
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(translation.GetName())
+	if len(name) > maxProductNameLength {
+		return nil, status.Errorf(codes.InvalidArgument, "name must be at most %d characters", maxProductNameLength)
+	}
+	if len(translation.GetVariationText()) > maxVariationTextKeys {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d variation text attributes can be translated", maxVariationTextKeys)
+	}
+	variationText := make(map[string]string, len(translation.GetVariationText()))
+	for key, value := range translation.GetVariationText() {
+		if key == "" || len(key) > maxVariationTextLength || len(value) > maxVariationTextLength {
+			return nil, status.Errorf(codes.InvalidArgument, "variation text attributes and values must be at most %d characters", maxVariationTextLength)
+		}
+		variationText[key] = value
+	}
+	encoded, err := json.Marshal(variationText)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode variation text: %v", err)
+	}
+
+	query := `
+	INSERT INTO product_translations (product_id, locale, name, description, variation_text)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (product_id, locale) DO UPDATE
+	SET name = excluded.name, description = excluded.description, variation_text = excluded.variation_text, updated_at = now()
+	RETURNING ` + translationColumns
+	var saved *pb.ProductTranslation
+	err = database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		if err := lockForEdit(ctx, tx, req.GetProductId()); err != nil {
+			return err
+		}
+		var err error
+		saved, err = scanTranslation(tx.QueryRow(ctx, query, req.GetProductId(), locale, name, translation.GetDescription(), encoded))
+		return err
+	})
+	if err != nil {
+		return nil, translationError(err, "failed to save translation")
+	}
+
+	productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, req.GetProductId())
+	return &pb.SetProductTranslationResponse{Translation: saved}, nil
+}
+
+func (c *translationController) ListProductTranslations(ctx context.Context, req *pb.ListProductTranslationsRequest) (*pb.ListProductTranslationsResponse, error) {
+	var exists bool
+	if err := c.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM products WHERE id = $1)`, req.GetProductId()).Scan(&exists); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read product: %v", err)
+	}
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "product not found")
+	}
+
+	rows, err := c.pool.Query(ctx, `SELECT `+translationColumns+` FROM product_translations WHERE product_id = $1 ORDER BY locale`, req.GetProductId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list translations: %v", err)
+	}
+	defer rows.Close()
+
+	translations := []*pb.ProductTranslation{}
+	for rows.Next() {
+		translation, err := scanTranslation(rows)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to scan translation: %v", err)
+		}
+		translations = append(translations, translation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list translations: %v", err)
+	}
+	return &pb.ListProductTranslationsResponse{Translations: translations}, nil
+}
+
+func (c *translationController) DeleteProductTranslation(ctx context.Context, req *pb.DeleteProductTranslationRequest) (*pb.DeleteProductTranslationResponse, error) {
+	locale, err := c.translationLocale(req.GetLocale())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := authorize(ctx, "deleting a translation", c.roles.staff()); err != nil {
+		return nil, err
+	}
+
+	err = database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		if err := lockForEdit(ctx, tx, req.GetProductId()); err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, `DELETE FROM product_translations WHERE product_id = $1 AND locale = $2`, req.GetProductId(), locale)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return status.Errorf(codes.NotFound, "translation not found")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, translationError(err, "failed to delete translation")
+	}
+
+	productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, req.GetProductId())
+	return &pb.DeleteProductTranslationResponse{Deleted: true}, nil
+}
+
+// translationError maps errors of translation writes to gRPC status errors.
+func translationError(err error, message string) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return status.Errorf(codes.NotFound, "product not found")
+	}
+	return status.Errorf(codes.Internal, "%s: %v", message, err)
+}
@@ -0,0 +1,397 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/inventory"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/money"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/producttypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxSkuLength matches the sku and barcode columns.
+const maxSkuLength = 64
+
+// variantColumns selects a variant joined with effectiveVariantPriceJoin.
+// Variant stock is kept by the inventory store rather than in a column.
+const variantColumns = `id, product_id, sku, barcode, kind, attributes, ` + effectivePriceColumns + `, created_at, updated_at`
+
+// variantAttributes returns the kind and the canonical variation encoding
+// of a variant, or an empty kind when it has none.
+func variantAttributes(variant *pb.ProductVariant) (string, []byte, error) {
+	kind, message := variantVariation(variant)
+	if kind == "" {
+		return "", []byte("{}"), nil
+	}
+	attributes, err := producttypes.EncodeMessage(message)
+	return kind, attributes, err
+}
+
+// variantVariation returns the kind and message of the variation oneof of a
+// variant, or an empty kind when it has none.
+func variantVariation(variant *pb.ProductVariant) (string, proto.Message) {
+	switch v := variant.GetVariation().(type) {
+	case *pb.ProductVariant_Clothing:
+		return "clothing", v.Clothing
+	case *pb.ProductVariant_Electronics:
+		return "electronics", v.Electronics
+	case *pb.ProductVariant_Food:
+		return "food", v.Food
+	default:
+		return "", nil
+	}
+}
+
+// setVariantVariation decodes attributes written by variantAttributes.
+func setVariantVariation(variant *pb.ProductVariant, kind string, attributes []byte) error {
+	variation, err := producttypes.Decode(kind, attributes)
+	if err != nil {
+		return err
+	}
+	switch message := variation.Message.(type) {
+	case *pb.ClothingVariation:
+		variant.Variation = &pb.ProductVariant_Clothing{Clothing: message}
+	case *pb.ElectronicsVariation:
+		variant.Variation = &pb.ProductVariant_Electronics{Electronics: message}
+	case *pb.FoodVariation:
+		variant.Variation = &pb.ProductVariant_Food{Food: message}
+	}
+	return nil
+}
+
+func scanVariant(row pgx.Row) (*pb.ProductVariant, error) {
+	var (
+		variant              pb.ProductVariant
+		kind                 string
+		attributes           []byte
+		price, currency      *string
+		createdAt, updatedAt time.Time
+	)
+	err := row.Scan(&variant.Id, &variant.ProductId, &variant.Sku, &variant.Barcode, &kind, &attributes, &price, &currency, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := setVariantVariation(&variant, kind, attributes); err != nil {
+		return nil, fmt.Errorf("failed to decode variant %d attributes: %w", variant.Id, err)
+	}
+	if price != nil && currency != nil {
+		amount, err := decimal.NewFromString(*price)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored price %q: %w", *price, err)
+		}
+		variant.Price = money.FromDecimal(amount, *currency)
+	}
+	variant.CreatedAt = timestamppb.New(createdAt)
+	variant.UpdatedAt = timestamppb.New(updatedAt)
+	return &variant, nil
+}
+
+// loadVariants returns the variants of the given products, ordered by SKU,
+// with their available stock.
+func loadVariants(ctx context.Context, pool database.Pool, store *inventory.Store, productIDs []int64) (map[int64][]*pb.ProductVariant, error) {
+	variants := make(map[int64][]*pb.ProductVariant, len(productIDs))
+	if len(productIDs) == 0 {
+		return variants, nil
+	}
+
+	query := `SELECT ` + variantColumns + ` FROM product_variants` + effectiveVariantPriceJoin + `WHERE product_id = ANY($1) ORDER BY product_id, sku`
+	rows, err := pool.Query(ctx, query, productIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load variants: %w", err)
+	}
+	defer rows.Close()
+
+	var loaded []*pb.ProductVariant
+	for rows.Next() {
+		variant, err := scanVariant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan variant: %w", err)
+		}
+		variants[variant.ProductId] = append(variants[variant.ProductId], variant)
+		loaded = append(loaded, variant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load variants: %w", err)
+	}
+
+	if err := setVariantStock(ctx, store, loaded...); err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+// setVariantStock sets the stock of variants to their available quantity.
+func setVariantStock(ctx context.Context, store *inventory.Store, variants ...*pb.ProductVariant) error {
+	ids := make([]int64, 0, len(variants))
+	for _, variant := range variants {
+		ids = append(ids, variant.Id)
+	}
+	available, err := store.VariantsAvailable(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, variant := range variants {
+		variant.Stock = available[variant.Id]
+	}
+	return nil
+}
+
+// variantAttributeFilter returns a condition matching products with a variant
+// that has all of attributes, appending its arguments to args.
+func variantAttributeFilter(attributes map[string]string, args []interface{}) (string, []interface{}) {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	conditions := make([]string, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, key, attributes[key])
+		conditions = append(conditions, fmt.Sprintf("v.attributes->>$%d = $%d", len(args)-1, len(args)))
+	}
+	return `EXISTS (SELECT 1 FROM product_variants AS v WHERE v.product_id = products.id AND ` + strings.Join(conditions, " AND ") + `)`, args
+}
+
+// variantArgs validates variant and returns the column values shared by
+// AddVariant and UpdateVariant: sku, barcode, kind, attributes, price and
+// currency. Its stock is ignored; it changes through the inventory service.
+// The normalized price is returned too, nil when the variant sells at the
+// product's price.
+func (c *productController) variantArgs(variant *pb.ProductVariant) ([]interface{}, *pb.Money, error) {
+	if variant == nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "variant is required")
+	}
+	sku := strings.TrimSpace(variant.GetSku())
+	if sku == "" || len(sku) > maxSkuLength {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "sku must be 1 to %d characters", maxSkuLength)
+	}
+	barcode := strings.TrimSpace(variant.GetBarcode())
+	if len(barcode) > maxSkuLength {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "barcode must be at most %d characters", maxSkuLength)
+	}
+
+	var (
+		price            *pb.Money
+		amount, currency *string
+	)
+	if variant.GetPrice() != nil {
+		if err := money.Validate(variant.GetPrice()); err != nil {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "invalid price: %v", err)
+		}
+		code, err := c.converter.NormalizeCurrency(variant.GetPrice().GetCurrencyCode())
+		if err != nil {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "invalid price: %v", err)
+		}
+		rounded := money.ToDecimal(variant.GetPrice()).Round(money.Scale)
+		price = money.FromDecimal(rounded, code)
+		text := rounded.String()
+		amount, currency = &text, &code
+	}
+
+	kind, attributes, err := variantAttributes(variant)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid variation: %v", err)
+	}
+
+	return []interface{}{sku, barcode, kind, attributes, amount, currency}, price, nil
+}
+
+// readVariant reads a variant with its effective price in tx.
+func readVariant(ctx context.Context, tx pgx.Tx, variantID int64) (*pb.ProductVariant, error) {
+	query := `SELECT ` + variantColumns + ` FROM product_variants` + effectiveVariantPriceJoin + `WHERE id = $1`
+	return scanVariant(tx.QueryRow(ctx, query, variantID))
+}
+
+func (c *productController) AddVariant(ctx context.Context, req *pb.AddVariantRequest) (*pb.AddVariantResponse, error) {
+	productID := req.GetVariant().GetProductId()
+	if productID <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "product id is required")
+	}
+	if _, err := authorize(ctx, "adding a variant", c.roles.staff()); err != nil {
+		return nil, err
+	}
+	args, price, err := c.variantArgs(req.GetVariant())
+	if err != nil {
+		return nil, err
+	}
+	sku := args[0].(string)
+
+	query := `
+	INSERT INTO product_variants (product_id, sku, barcode, kind, attributes, price, currency)
+	VALUES ($1, $2, $3, $4, $5, $6::DECIMAL, $7)
+	RETURNING id`
+	var variant *pb.ProductVariant
+	err = database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		if err := lockForEdit(ctx, tx, productID); err != nil {
+			return err
+		}
+		if err := variantSkuAvailable(ctx, tx, sku); err != nil {
+			return err
+		}
+		var variantID int64
+		if err := tx.QueryRow(ctx, query, append([]interface{}{productID}, args...)...).Scan(&variantID); err != nil {
+			return err
+		}
+		// Like product prices, variant prices start their history when set.
+		if price != nil {
+			if err := recordPrice(ctx, tx, productID, variantID, money.ToDecimal(price), price.GetCurrencyCode()); err != nil {
+				return err
+			}
+		}
+		var err error
+		variant, err = readVariant(ctx, tx, variantID)
+		return err
+	})
+	if err != nil {
+		return nil, variantError(err)
+	}
+
+	productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, productID)
+	return &pb.AddVariantResponse{Variant: variant}, nil
+}
+
+func (c *productController) UpdateVariant(ctx context.Context, req *pb.UpdateVariantRequest) (*pb.UpdateVariantResponse, error) {
+	variantID := req.GetVariant().GetId()
+	if variantID <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "variant id is required")
+	}
+	if _, err := authorize(ctx, "updating a variant", c.roles.staff()); err != nil {
+		return nil, err
+	}
+	args, price, err := c.variantArgs(req.GetVariant())
+	if err != nil {
+		return nil, err
+	}
+	sku := args[0].(string)
+
+	query := `
+	UPDATE product_variants
+	SET
+		sku = $2,
+		barcode = $3,
+		kind = $4,
+		attributes = $5,
+		price = $6::DECIMAL,
+		currency = $7,
+		updated_at = now()
+	WHERE id = $1`
+	var variant *pb.ProductVariant
+	err = database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		var (
+			productID                       int64
+			previousPrice, previousCurrency *string
+		)
+		err := tx.QueryRow(ctx, `SELECT product_id, price::STRING, currency FROM product_variants WHERE id = $1 FOR UPDATE`, variantID).Scan(&productID, &previousPrice, &previousCurrency)
+		if err != nil {
+			return err
+		}
+		if err := lockForEdit(ctx, tx, productID); err != nil {
+			return err
+		}
+		if err := variantSkuAvailable(ctx, tx, sku); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, query, append([]interface{}{variantID}, args...)...); err != nil {
+			return err
+		}
+
+		// As for products, only a changed price enters the history. A
+		// variant going back to the product's price ends its history.
+		switch {
+		case price == nil && previousPrice != nil:
+			err = clearVariantPrices(ctx, tx, variantID)
+		case price != nil && !sameVariantPrice(previousPrice, previousCurrency, price):
+			err = recordPrice(ctx, tx, productID, variantID, money.ToDecimal(price), price.GetCurrencyCode())
+		}
+		if err != nil {
+			return err
+		}
+		variant, err = readVariant(ctx, tx, variantID)
+		return err
+	})
+	if err != nil {
+		return nil, variantError(err)
+	}
+	if err := setVariantStock(ctx, c.inventory, variant); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, variant.ProductId)
+	return &pb.UpdateVariantResponse{Variant: variant}, nil
+}
+
+// sameVariantPrice reports whether the stored price and currency of a
+// variant, NULL when it sells at the product's price, equal price.
+func sameVariantPrice(stored, currency *string, price *pb.Money) bool {
+	if stored == nil || currency == nil {
+		return false
+	}
+	amount, err := decimal.NewFromString(*stored)
+	return err == nil && amount.Equal(money.ToDecimal(price)) && *currency == price.GetCurrencyCode()
+}
+
+func (c *productController) RemoveVariant(ctx context.Context, req *pb.RemoveVariantRequest) (*pb.RemoveVariantResponse, error) {
+	if req.GetVariantId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "variant id is required")
+	}
+	if _, err := authorize(ctx, "removing a variant", c.roles.staff()); err != nil {
+		return nil, err
+	}
+
+	var productID int64
+	err := database.ExecuteTx(ctx, c.pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `SELECT product_id FROM product_variants WHERE id = $1 FOR UPDATE`, req.GetVariantId()).Scan(&productID)
+		if err != nil {
+			return err
+		}
+		if err := lockForEdit(ctx, tx, productID); err != nil {
+			return err
+		}
+		if err := inventory.RemoveVariant(ctx, tx, productID, req.GetVariantId()); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM product_prices WHERE variant_id = $1`, req.GetVariantId()); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM product_variants WHERE id = $1`, req.GetVariantId())
+		return err
+	})
+	if errors.Is(err, inventory.ErrStockReserved) {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	if err != nil {
+		return nil, variantError(err)
+	}
+
+	productChanged(ctx, c.cache, c.publisher, events.ProductUpdated, productID)
+	return &pb.RemoveVariantResponse{Removed: true}, nil
+}
+
+// variantError maps errors of variant writes to gRPC status errors.
+func variantError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return status.Errorf(codes.NotFound, "product or variant not found")
+	case database.IsUniqueViolation(err):
+		return status.Errorf(codes.AlreadyExists, "sku is already in use")
+	default:
+		return status.Errorf(codes.Internal, "failed to write variant: %v", err)
+	}
+}
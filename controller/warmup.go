@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+)
+
+// WarmUpOptions controls how much of the cache WarmUp pre-populates.
+type WarmUpOptions struct {
+	// Products is the number of most read products to load.
+	Products int
+	// ListQueries is the number of most common ListProducts queries to load.
+	ListQueries int
+	// Pages is how many pages of each list query to load.
+	Pages int
+	// Window limits the statistics to queries seen this recently.
+	Window time.Duration
+}
+
+type skipQueryStatsKey struct{}
+
+// withoutQueryStats marks requests made by the server itself, which must not
+// count towards the query statistics.
+func withoutQueryStats(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipQueryStatsKey{}, true)
+}
+
+func recordsQueryStats(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipQueryStatsKey{}).(bool)
+	return !skip
+}
+
+// recordProduct counts a read of a product that exists and is visible to the
+// caller, so that only real products are warmed.
+func (c *productController) recordProduct(ctx context.Context, id int64) {
+	if recordsQueryStats(ctx) {
+		c.queryStats.RecordProduct(id)
+	}
+}
+
+// WarmUp fills the cache with the products and product list pages that were
+// most popular in previous runs, by reading them through products.
+func WarmUp(ctx context.Context, products pb.ProductServiceServer, queryStats *database.QueryStats, opts WarmUpOptions) {
+	start := time.Now()
+	ctx = withoutQueryStats(ctx)
+	warmedProducts, warmedPages := 0, 0
+
+	productIDs, err := queryStats.TopProducts(ctx, opts.Products, opts.Window)
+	if err != nil {
+		slog.Warn("failed to load product statistics for warm-up", "error", err)
+	}
+	for _, id := range productIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		if _, err := products.GetProduct(ctx, &pb.GetProductRequest{Id: id}); err != nil {
+			slog.Warn("failed to warm product", "id", id, "error", err)
+			continue
+		}
+		warmedProducts++
+	}
+
+	listQueries, err := queryStats.TopListQueries(ctx, opts.ListQueries, opts.Window)
+	if err != nil {
+		slog.Warn("failed to load list statistics for warm-up", "error", err)
+	}
+	for _, query := range listQueries {
+		pageToken := ""
+		for page := 0; page < opts.Pages && ctx.Err() == nil; page++ {
+			res, err := products.ListProducts(ctx, &pb.ListProductsRequest{
+				PageSize:   query.PageSize,
+				PageToken:  pageToken,
+				SearchTerm: query.SearchTerm,
+			})
+			if err != nil {
+				slog.Warn("failed to warm product list", "searchTerm", query.SearchTerm, "page", page, "error", err)
+				break
+			}
+			warmedPages++
+			if res.NextPageToken == "" {
+				break
+			}
+			pageToken = res.NextPageToken
+		}
+	}
+
+	slog.Info("Cache warm-up finished", "products", warmedProducts, "listPages", warmedPages, "duration", time.Since(start))
+}
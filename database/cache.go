@@ -9,7 +9,8 @@ import (
 	"github.com/bradfitz/gomemcache/memcache"
 )
 
-// CacheMethods defines the interface for Memcached operations.
+// CacheMethods defines the interface for cache operations. Get returns a nil
+// value and a nil error on a miss.
 type CacheMethods interface {
 	Set(ctx context.Context, key string, value []byte, expiration int32) error
 	Get(ctx context.Context, key string) ([]byte, error)
@@ -17,24 +18,23 @@ type CacheMethods interface {
 	Ping(ctx context.Context, maxRetries int) error
 }
 
+// LocalInvalidator is implemented by caches that keep entries in process
+// memory and must be told about changes made by other replicas.
+type LocalInvalidator interface {
+	Invalidate(keys ...string)
+	InvalidatePrefix(prefix string)
+}
+
 // MemcachedClient holds the Memcached client instance.
 type MemcachedClient struct {
 	client *memcache.Client
 }
 
-// NewMemcachedClient initializes a new Memcached connection.
-func NewMemcachedClient(host string, port int) (*MemcachedClient, error) {
+// NewMemcachedClient initializes a new Memcached client. Connections are made
+// lazily, so an unreachable server is only reported by Ping or later calls.
+func NewMemcachedClient(host string, port int) *MemcachedClient {
 	address := fmt.Sprintf("%s:%d", host, port)
-	client := memcache.New(address)
-
-	// Simple ping to check if Memcached is available
-	err := client.Ping()
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Memcached: %w", err)
-	}
-
-	slog.Info("Successfully connected to Memcached")
-	return &MemcachedClient{client: client}, nil
+	return &MemcachedClient{client: memcache.New(address)}
 }
 
 // Set stores a key-value pair in Memcached with an expiration time.
@@ -51,7 +51,6 @@ func (mc *MemcachedClient) Get(ctx context.Context, key string) ([]byte, error)
 	item, err := mc.client.Get(key)
 	if err != nil {
 		if err == memcache.ErrCacheMiss {
-			slog.Warn("Cache miss for key", "key", key)
 			return nil, nil
 		}
 		return nil, err
@@ -59,9 +58,18 @@ func (mc *MemcachedClient) Get(ctx context.Context, key string) ([]byte, error)
 	return item.Value, nil
 }
 
-// Delete removes a key-value pair from Memcached.
+// Delete removes a key-value pair from Memcached. Deleting a missing key is not an error.
 func (mc *MemcachedClient) Delete(ctx context.Context, key string) error {
-	return mc.client.Delete(key)
+	err := mc.client.Delete(key)
+	if err == memcache.ErrCacheMiss {
+		return nil
+	}
+	return err
+}
+
+// Flush drops every entry on the server.
+func (mc *MemcachedClient) Flush(ctx context.Context) error {
+	return mc.client.FlushAll()
 }
 
 // Ping checks if the Memcached connection is alive with retries.
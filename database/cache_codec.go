@@ -0,0 +1,294 @@
+package database
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/proto"
+)
+
+// CacheSchemaVersion must be bumped whenever a cached message changes in a way
+// older replicas cannot read. Entries written with another version are ignored.
+const CacheSchemaVersion = 14
+
+// envelopeMagic marks values written by CacheCodec, so legacy entries are
+// recognised and discarded instead of misread.
+const envelopeMagic = 0xCE
+
+const envelopeHeaderSize = 4
+
+// maxCacheItemSize keeps each stored value safely under memcached's default
+// 1MB item limit, leaving room for the key and item overhead.
+const maxCacheItemSize = 1000 * 1024
+
+// Compression selects how envelope payloads are compressed.
+type Compression byte
+
+const (
+	CompressionNone   Compression = 0
+	CompressionSnappy Compression = 1
+	CompressionZstd   Compression = 2
+)
+
+// ParseCompression maps a config value to a Compression.
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "", "none":
+		return CompressionNone, nil
+	case "snappy":
+		return CompressionSnappy, nil
+	case "zstd":
+		return CompressionZstd, nil
+	default:
+		return CompressionNone, fmt.Errorf("unknown cache compression %q", name)
+	}
+}
+
+type payloadCodec byte
+
+const (
+	codecProtobuf payloadCodec = 1
+	// codecChunked payloads list the chunks holding a value too big for one item.
+	codecChunked payloadCodec = 2
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// CacheCodec stores proto messages in a cache inside versioned envelopes:
+// a header of magic, schema version, codec and compression followed by the
+// protobuf binary payload. Values over the item size limit are split into chunks.
+type CacheCodec struct {
+	cache       CacheMethods
+	compression Compression
+	// minCompressSize is the smallest payload worth compressing.
+	minCompressSize int
+}
+
+// NewCacheCodec wraps cache, compressing payloads with compression.
+func NewCacheCodec(cache CacheMethods, compression Compression) *CacheCodec {
+	return &CacheCodec{
+		cache:           cache,
+		compression:     compression,
+		minCompressSize: 512,
+	}
+}
+
+// Set marshals msg into an envelope and stores it under key.
+func (cc *CacheCodec) Set(ctx context.Context, key string, msg proto.Message, expiration int32) error {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", key, err)
+	}
+
+	compression := cc.compression
+	if len(payload) < cc.minCompressSize {
+		compression = CompressionNone
+	}
+	switch compression {
+	case CompressionSnappy:
+		payload = s2.EncodeSnappy(nil, payload)
+	case CompressionZstd:
+		payload = zstdEncoder.EncodeAll(payload, nil)
+	}
+
+	value := envelope(codecProtobuf, compression, payload)
+	if len(value) <= maxCacheItemSize {
+		return cc.cache.Set(ctx, key, value, expiration)
+	}
+	return cc.setChunked(ctx, key, value, expiration)
+}
+
+// setChunked stores value in chunks named after its checksum, then writes a
+// manifest under key. Readers therefore never mix chunks of different writes.
+func (cc *CacheCodec) setChunked(ctx context.Context, key string, value []byte, expiration int32) error {
+	checksum := crc32.ChecksumIEEE(value)
+	count := (len(value) + maxCacheItemSize - 1) / maxCacheItemSize
+
+	for i := 0; i < count; i++ {
+		end := min((i+1)*maxCacheItemSize, len(value))
+		if err := cc.cache.Set(ctx, chunkKey(key, checksum, i), value[i*maxCacheItemSize:end], expiration); err != nil {
+			return fmt.Errorf("failed to store chunk %d of %s: %w", i, key, err)
+		}
+	}
+
+	manifest := make([]byte, 12)
+	binary.BigEndian.PutUint32(manifest[0:4], checksum)
+	binary.BigEndian.PutUint32(manifest[4:8], uint32(count))
+	binary.BigEndian.PutUint32(manifest[8:12], uint32(len(value)))
+	return cc.cache.Set(ctx, key, envelope(codecChunked, CompressionNone, manifest), expiration)
+}
+
+// Get loads key into msg. It reports false on a miss, including entries
+// written with another schema version or that cannot be decoded.
+func (cc *CacheCodec) Get(ctx context.Context, key string, msg proto.Message) (bool, error) {
+	value, err := cc.cache.Get(ctx, key)
+	if err != nil || value == nil {
+		return false, err
+	}
+
+	codec, compression, payload, err := openEnvelope(value)
+	if err != nil {
+		slog.Warn("discarding cache entry", "key", key, "error", err)
+		return false, nil
+	}
+
+	if codec == codecChunked {
+		value, err = cc.getChunked(ctx, key, payload)
+		if err != nil || value == nil {
+			return false, err
+		}
+		codec, compression, payload, err = openEnvelope(value)
+		if err != nil {
+			slog.Warn("discarding chunked cache entry", "key", key, "error", err)
+			return false, nil
+		}
+	}
+
+	if codec != codecProtobuf {
+		slog.Warn("discarding cache entry", "key", key, "error", fmt.Sprintf("unknown codec %d", codec))
+		return false, nil
+	}
+
+	switch compression {
+	case CompressionNone:
+	case CompressionSnappy:
+		payload, err = s2.Decode(nil, payload)
+	case CompressionZstd:
+		payload, err = zstdDecoder.DecodeAll(payload, nil)
+	default:
+		err = fmt.Errorf("unknown compression %d", compression)
+	}
+	if err != nil {
+		slog.Warn("discarding cache entry", "key", key, "error", err)
+		return false, nil
+	}
+
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		slog.Warn("discarding cache entry", "key", key, "error", err)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (cc *CacheCodec) getChunked(ctx context.Context, key string, manifest []byte) ([]byte, error) {
+	if len(manifest) != 12 {
+		slog.Warn("discarding cache entry", "key", key, "error", "malformed chunk manifest")
+		return nil, nil
+	}
+	checksum := binary.BigEndian.Uint32(manifest[0:4])
+	count := int(binary.BigEndian.Uint32(manifest[4:8]))
+	size := int(binary.BigEndian.Uint32(manifest[8:12]))
+
+	value := make([]byte, 0, size)
+	for i := 0; i < count; i++ {
+		chunk, err := cc.cache.Get(ctx, chunkKey(key, checksum, i))
+		if err != nil || chunk == nil {
+			// A missing chunk makes the whole entry a miss.
+			return nil, err
+		}
+		value = append(value, chunk...)
+	}
+
+	if len(value) != size || crc32.ChecksumIEEE(value) != checksum {
+		slog.Warn("discarding cache entry", "key", key, "error", "chunk checksum mismatch")
+		return nil, nil
+	}
+	return value, nil
+}
+
+// EnvelopeInfo describes how a cached value is encoded.
+type EnvelopeInfo struct {
+	// Envelope is false for values not written by CacheCodec.
+	Envelope      bool
+	SchemaVersion int
+	Codec         string
+	Compression   string
+	// Chunks is the number of chunks of a chunked value.
+	Chunks int
+	// Size is the stored size in bytes, including all chunks.
+	Size int
+}
+
+// Inspect reports how the value stored under key is encoded without decoding it.
+func (cc *CacheCodec) Inspect(ctx context.Context, key string) (EnvelopeInfo, bool, error) {
+	value, err := cc.cache.Get(ctx, key)
+	if err != nil || value == nil {
+		return EnvelopeInfo{}, false, err
+	}
+
+	info := EnvelopeInfo{Size: len(value)}
+	if len(value) < envelopeHeaderSize || value[0] != envelopeMagic {
+		return info, true, nil
+	}
+	info.Envelope = true
+	info.SchemaVersion = int(value[1])
+	info.Codec = payloadCodec(value[2]).String()
+	info.Compression = Compression(value[3]).String()
+
+	if payloadCodec(value[2]) == codecChunked && len(value) == envelopeHeaderSize+12 {
+		info.Chunks = int(binary.BigEndian.Uint32(value[envelopeHeaderSize+4 : envelopeHeaderSize+8]))
+		info.Size += int(binary.BigEndian.Uint32(value[envelopeHeaderSize+8:]))
+	}
+	return info, true, nil
+}
+
+func (c payloadCodec) String() string {
+	switch c {
+	case codecProtobuf:
+		return "protobuf"
+	case codecChunked:
+		return "chunked"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(c))
+	}
+}
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(c))
+	}
+}
+
+// Delete removes key. Chunks of large entries are left to expire.
+func (cc *CacheCodec) Delete(ctx context.Context, key string) error {
+	return cc.cache.Delete(ctx, key)
+}
+
+func chunkKey(key string, checksum uint32, i int) string {
+	return fmt.Sprintf("%s#%08x:%d", key, checksum, i)
+}
+
+func envelope(codec payloadCodec, compression Compression, payload []byte) []byte {
+	value := make([]byte, envelopeHeaderSize, envelopeHeaderSize+len(payload))
+	value[0] = envelopeMagic
+	value[1] = CacheSchemaVersion
+	value[2] = byte(codec)
+	value[3] = byte(compression)
+	return append(value, payload...)
+}
+
+func openEnvelope(value []byte) (payloadCodec, Compression, []byte, error) {
+	if len(value) < envelopeHeaderSize || value[0] != envelopeMagic {
+		return 0, 0, nil, errors.New("not a cache envelope")
+	}
+	if value[1] != CacheSchemaVersion {
+		return 0, 0, nil, fmt.Errorf("unknown schema version %d", value[1])
+	}
+	return payloadCodec(value[2]), Compression(value[3]), value[envelopeHeaderSize:], nil
+}
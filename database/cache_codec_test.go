@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// randomText returns n letters that compress poorly, so values stay large.
+func randomText(n int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	r := rand.New(rand.NewSource(1))
+	var b strings.Builder
+	b.Grow(n)
+	for i := 0; i < n; i++ {
+		b.WriteByte(letters[r.Intn(len(letters))])
+	}
+	return b.String()
+}
+
+func TestCacheCodecRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	small := &pb.Product{Id: 1, Name: "Desk", Category: "furniture", Tags: []string{"oak"}}
+	medium := &pb.Product{Id: 2, Name: "Chair", Description: strings.Repeat("solid oak, hand finished. ", 200)}
+	large := &pb.Product{Id: 3, Name: "Catalogue", Description: randomText(3 << 20)}
+
+	tests := []struct {
+		name            string
+		compression     Compression
+		product         *pb.Product
+		wantCompression string
+		wantChunks      bool
+	}{
+		{"small uncompressed", CompressionNone, small, "none", false},
+		{"small below the compression threshold", CompressionZstd, small, "none", false},
+		{"snappy", CompressionSnappy, medium, "snappy", false},
+		{"zstd", CompressionZstd, medium, "zstd", false},
+		{"chunked uncompressed", CompressionNone, large, "none", true},
+		{"chunked zstd", CompressionZstd, large, "none", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := NewCacheCodec(NewLocalCache(1000, time.Hour), tt.compression)
+			if err := cc.Set(ctx, "product:1", tt.product, 0); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+
+			var got pb.Product
+			hit, err := cc.Get(ctx, "product:1", &got)
+			if err != nil || !hit {
+				t.Fatalf("Get = %v, %v; want a hit", hit, err)
+			}
+			if !proto.Equal(&got, tt.product) {
+				t.Error("Get returned another product than was stored")
+			}
+
+			info, ok, err := cc.Inspect(ctx, "product:1")
+			if err != nil || !ok {
+				t.Fatalf("Inspect = %v, %v", ok, err)
+			}
+			if !info.Envelope || info.SchemaVersion != CacheSchemaVersion {
+				t.Errorf("Inspect = %+v, want an envelope of schema version %d", info, CacheSchemaVersion)
+			}
+			if tt.wantChunks {
+				if info.Codec != "chunked" || info.Chunks < 2 || info.Size <= maxCacheItemSize {
+					t.Errorf("Inspect = %+v, want a chunked value over %d bytes", info, maxCacheItemSize)
+				}
+				return
+			}
+			if info.Codec != "protobuf" || info.Compression != tt.wantCompression || info.Chunks != 0 {
+				t.Errorf("Inspect = %+v, want protobuf compressed with %s", info, tt.wantCompression)
+			}
+		})
+	}
+}
+
+func TestCacheCodecChunksStayUnderTheItemLimit(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLocalCache(1000, time.Hour)
+	cc := NewCacheCodec(cache, CompressionNone)
+	if err := cc.Set(ctx, "product:1", &pb.Product{Description: randomText(3 << 20)}, 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	for _, key := range cache.lru.Keys() {
+		value, _ := cache.Get(ctx, key)
+		if len(value) > maxCacheItemSize {
+			t.Errorf("%s holds %d bytes, over the %d byte item limit", key, len(value), maxCacheItemSize)
+		}
+	}
+}
+
+func TestCacheCodecMisses(t *testing.T) {
+	ctx := context.Background()
+	product := &pb.Product{Id: 1, Name: "Catalogue", Description: randomText(3 << 20)}
+
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, cache *LocalCache)
+	}{
+		{"absent", func(t *testing.T, cache *LocalCache) {
+			cache.Delete(ctx, "product:1")
+		}},
+		{"missing chunk", func(t *testing.T, cache *LocalCache) {
+			cache.InvalidatePrefix("product:1#")
+		}},
+		{"corrupted chunk", func(t *testing.T, cache *LocalCache) {
+			for _, key := range cache.lru.Keys() {
+				if strings.HasSuffix(key, ":1") && strings.HasPrefix(key, "product:1#") {
+					value, _ := cache.Get(ctx, key)
+					corrupted := append([]byte(nil), value...)
+					corrupted[len(corrupted)/2] ^= 0xFF
+					cache.Set(ctx, key, corrupted, 0)
+				}
+			}
+		}},
+		{"another schema version", func(t *testing.T, cache *LocalCache) {
+			value, _ := cache.Get(ctx, "product:1")
+			stale := append([]byte(nil), value...)
+			stale[1] = CacheSchemaVersion - 1
+			cache.Set(ctx, "product:1", stale, 0)
+		}},
+		{"not an envelope", func(t *testing.T, cache *LocalCache) {
+			legacy, err := proto.Marshal(&pb.Product{Id: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cache.Set(ctx, "product:1", legacy, 0)
+		}},
+		{"unknown compression", func(t *testing.T, cache *LocalCache) {
+			cache.Set(ctx, "product:1", envelope(codecProtobuf, Compression(9), []byte{0x08, 0x01}), 0)
+		}},
+		{"undecodable payload", func(t *testing.T, cache *LocalCache) {
+			cache.Set(ctx, "product:1", envelope(codecProtobuf, CompressionZstd, []byte("not zstd")), 0)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewLocalCache(1000, time.Hour)
+			cc := NewCacheCodec(cache, CompressionNone)
+			if err := cc.Set(ctx, "product:1", product, 0); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			tt.corrupt(t, cache)
+
+			var got pb.Product
+			hit, err := cc.Get(ctx, "product:1", &got)
+			if err != nil || hit {
+				t.Errorf("Get = %v, %v; want a miss", hit, err)
+			}
+		})
+	}
+}
+
+func TestInspectLegacyValue(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLocalCache(10, time.Hour)
+	cache.Set(ctx, "product:1", []byte("legacy"), 0)
+
+	info, ok, err := NewCacheCodec(cache, CompressionNone).Inspect(ctx, "product:1")
+	if err != nil || !ok {
+		t.Fatalf("Inspect = %v, %v", ok, err)
+	}
+	if info.Envelope || info.Size != len("legacy") {
+		t.Errorf("Inspect = %+v, want a %d byte value without an envelope", info, len("legacy"))
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Compression
+		wantErr bool
+	}{
+		{"", CompressionNone, false},
+		{"none", CompressionNone, false},
+		{"snappy", CompressionSnappy, false},
+		{"zstd", CompressionZstd, false},
+		{"gzip", CompressionNone, true},
+		{"ZSTD", CompressionNone, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCompression(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseCompression(%q) = %v, %v; want %v, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTrackedKeys bounds the number of keys whose read counts CacheStats keeps.
+const maxTrackedKeys = 10000
+
+// PrefixStats holds the counters of every key sharing a prefix.
+type PrefixStats struct {
+	Hits         uint64
+	Misses       uint64
+	Errors       uint64
+	Sets         uint64
+	Deletes      uint64
+	Calls        uint64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+}
+
+// HitRatio returns hits over reads, or 0 before the first read.
+func (ps PrefixStats) HitRatio() float64 {
+	reads := ps.Hits + ps.Misses
+	if reads == 0 {
+		return 0
+	}
+	return float64(ps.Hits) / float64(reads)
+}
+
+// AvgLatency returns the mean latency of all calls.
+func (ps PrefixStats) AvgLatency() time.Duration {
+	if ps.Calls == 0 {
+		return 0
+	}
+	return ps.TotalLatency / time.Duration(ps.Calls)
+}
+
+// CacheStats collects hit, miss, error and latency counters per key prefix,
+// where the prefix is everything before the first ':' of a key.
+type CacheStats struct {
+	mu       sync.Mutex
+	prefixes map[string]*PrefixStats
+	reads    map[string]uint64
+}
+
+// NewCacheStats returns empty statistics.
+func NewCacheStats() *CacheStats {
+	return &CacheStats{
+		prefixes: make(map[string]*PrefixStats),
+		reads:    make(map[string]uint64),
+	}
+}
+
+func keyPrefix(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+func (cs *CacheStats) record(key string, latency time.Duration, update func(*PrefixStats)) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	prefix := keyPrefix(key)
+	ps, ok := cs.prefixes[prefix]
+	if !ok {
+		ps = &PrefixStats{}
+		cs.prefixes[prefix] = ps
+	}
+	update(ps)
+	ps.Calls++
+	ps.TotalLatency += latency
+	if latency > ps.MaxLatency {
+		ps.MaxLatency = latency
+	}
+}
+
+func (cs *CacheStats) recordRead(key string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if _, ok := cs.reads[key]; !ok && len(cs.reads) >= maxTrackedKeys {
+		// Halve every count and drop the coldest keys to make room.
+		for k, n := range cs.reads {
+			if n /= 2; n == 0 {
+				delete(cs.reads, k)
+			} else {
+				cs.reads[k] = n
+			}
+		}
+		if len(cs.reads) >= maxTrackedKeys {
+			return
+		}
+	}
+	cs.reads[key]++
+}
+
+// Snapshot returns a copy of the counters keyed by prefix.
+func (cs *CacheStats) Snapshot() map[string]PrefixStats {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	snapshot := make(map[string]PrefixStats, len(cs.prefixes))
+	for prefix, ps := range cs.prefixes {
+		snapshot[prefix] = *ps
+	}
+	return snapshot
+}
+
+// TopKeys returns up to n of the most read keys starting with prefix.
+func (cs *CacheStats) TopKeys(prefix string, n int) []string {
+	cs.mu.Lock()
+	type keyCount struct {
+		key   string
+		count uint64
+	}
+	var candidates []keyCount
+	for key, count := range cs.reads {
+		if strings.HasPrefix(key, prefix) {
+			candidates = append(candidates, keyCount{key, count})
+		}
+	}
+	cs.mu.Unlock()
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].count > candidates[j].count })
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	keys := make([]string, len(candidates))
+	for i, c := range candidates {
+		keys[i] = c.key
+	}
+	return keys
+}
+
+// InstrumentedCache records CacheStats for every call to the wrapped cache.
+type InstrumentedCache struct {
+	cache CacheMethods
+	stats *CacheStats
+}
+
+// NewInstrumentedCache wraps cache so that its calls are counted in stats.
+func NewInstrumentedCache(cache CacheMethods, stats *CacheStats) *InstrumentedCache {
+	return &InstrumentedCache{
+		cache: cache,
+		stats: stats,
+	}
+}
+
+// Set stores a value and counts the write.
+func (ic *InstrumentedCache) Set(ctx context.Context, key string, value []byte, expiration int32) error {
+	start := time.Now()
+	err := ic.cache.Set(ctx, key, value, expiration)
+	ic.stats.record(key, time.Since(start), func(ps *PrefixStats) {
+		ps.Sets++
+		if err != nil {
+			ps.Errors++
+		}
+	})
+	return err
+}
+
+// Get reads a value and counts it as a hit, miss or error.
+func (ic *InstrumentedCache) Get(ctx context.Context, key string) ([]byte, error) {
+	start := time.Now()
+	value, err := ic.cache.Get(ctx, key)
+	ic.stats.record(key, time.Since(start), func(ps *PrefixStats) {
+		switch {
+		case err != nil:
+			ps.Errors++
+		case value == nil:
+			ps.Misses++
+		default:
+			ps.Hits++
+		}
+	})
+	ic.stats.recordRead(key)
+	return value, err
+}
+
+// Delete removes a key and counts the delete.
+func (ic *InstrumentedCache) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := ic.cache.Delete(ctx, key)
+	ic.stats.record(key, time.Since(start), func(ps *PrefixStats) {
+		ps.Deletes++
+		if err != nil {
+			ps.Errors++
+		}
+	})
+	return err
+}
+
+// Ping checks the wrapped cache.
+func (ic *InstrumentedCache) Ping(ctx context.Context, maxRetries int) error {
+	return ic.cache.Ping(ctx, maxRetries)
+}
+
+// Invalidate forwards to the wrapped cache if it has an in-process tier.
+func (ic *InstrumentedCache) Invalidate(keys ...string) {
+	if local, ok := ic.cache.(LocalInvalidator); ok {
+		local.Invalidate(keys...)
+	}
+}
+
+// InvalidatePrefix forwards to the wrapped cache if it has an in-process tier.
+func (ic *InstrumentedCache) InvalidatePrefix(prefix string) {
+	if local, ok := ic.cache.(LocalInvalidator); ok {
+		local.InvalidatePrefix(prefix)
+	}
+}
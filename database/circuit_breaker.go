@@ -0,0 +1,243 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxMissedKeys bounds the keys a CircuitBreaker remembers failing to write.
+// Once more are missed, the whole cache is flushed on recovery instead.
+const maxMissedKeys = 10000
+
+// Flusher is implemented by caches that can drop every entry at once.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// CircuitBreaker wraps a remote cache and stops calling it after repeated
+// failures. While the circuit is open reads are treated as misses and writes
+// are dropped, so an outage costs nothing but cache hits. The keys of dropped
+// or failed writes are remembered and deleted before the circuit closes
+// again, so entries invalidated during an outage are not served stale after
+// recovery.
+type CircuitBreaker struct {
+	cache            CacheMethods
+	failureThreshold int
+
+	mu       sync.Mutex
+	open     bool
+	failures int
+	onChange func(healthy bool)
+	// missed holds the keys whose writes were dropped or failed; overflowed
+	// is set when there were more than maxMissedKeys of them.
+	missed     map[string]struct{}
+	overflowed bool
+}
+
+// NewCircuitBreaker opens the circuit after failureThreshold consecutive failures.
+func NewCircuitBreaker(cache CacheMethods, failureThreshold int) *CircuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = 5
+	}
+	return &CircuitBreaker{
+		cache:            cache,
+		failureThreshold: failureThreshold,
+		missed:           make(map[string]struct{}),
+	}
+}
+
+// OnStateChange registers a callback invoked whenever the circuit opens or closes.
+func (cb *CircuitBreaker) OnStateChange(fn func(healthy bool)) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.onChange = fn
+}
+
+// Healthy reports whether the circuit is closed.
+func (cb *CircuitBreaker) Healthy() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return !cb.open
+}
+
+func (cb *CircuitBreaker) record(err error) {
+	cb.mu.Lock()
+	if err == nil {
+		cb.failures = 0
+		cb.mu.Unlock()
+		return
+	}
+
+	cb.failures++
+	if cb.open || cb.failures < cb.failureThreshold {
+		cb.mu.Unlock()
+		return
+	}
+	cb.open = true
+	onChange := cb.onChange
+	cb.mu.Unlock()
+
+	slog.Warn("cache circuit opened, skipping cache calls", "failures", cb.failureThreshold, "error", err)
+	if onChange != nil {
+		onChange(false)
+	}
+}
+
+// miss remembers that a write of key did not reach the cache.
+func (cb *CircuitBreaker) miss(key string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if len(cb.missed) >= maxMissedKeys {
+		cb.overflowed = true
+		return
+	}
+	cb.missed[key] = struct{}{}
+}
+
+// repair deletes the keys whose writes were missed, or flushes the whole
+// cache if too many were. Keys it could not delete stay missed.
+func (cb *CircuitBreaker) repair(ctx context.Context) error {
+	cb.mu.Lock()
+	missed, overflowed := cb.missed, cb.overflowed
+	cb.missed, cb.overflowed = make(map[string]struct{}), false
+	cb.mu.Unlock()
+	if len(missed) == 0 && !overflowed {
+		return nil
+	}
+
+	if overflowed {
+		flusher, ok := cb.cache.(Flusher)
+		if !ok {
+			slog.Warn("cache cannot be flushed, entries changed during the outage may be stale until they expire")
+		} else if err := flusher.Flush(ctx); err != nil {
+			cb.mu.Lock()
+			cb.overflowed = true
+			cb.mu.Unlock()
+			return err
+		} else {
+			slog.Info("flushed the cache after missing too many writes during the outage")
+			return nil
+		}
+	}
+
+	for key := range missed {
+		if err := cb.cache.Delete(ctx, key); err != nil {
+			for key := range missed {
+				cb.miss(key)
+			}
+			return err
+		}
+		delete(missed, key)
+	}
+	slog.Info("deleted the cache entries written during the outage")
+	return nil
+}
+
+// close repairs the entries missed while the circuit was open and closes
+// it. Writes dropped while it repairs are repaired once more after closing,
+// when no more of them can be dropped.
+func (cb *CircuitBreaker) close(ctx context.Context) error {
+	if err := cb.repair(ctx); err != nil {
+		return err
+	}
+
+	cb.mu.Lock()
+	if !cb.open {
+		cb.mu.Unlock()
+		return nil
+	}
+	cb.open = false
+	cb.failures = 0
+	onChange := cb.onChange
+	cb.mu.Unlock()
+
+	if err := cb.repair(ctx); err != nil {
+		slog.Warn("failed to delete cache entries written during the outage", "error", err)
+	}
+	slog.Info("cache circuit closed, cache calls resumed")
+	if onChange != nil {
+		onChange(true)
+	}
+	return nil
+}
+
+// Set writes to the cache unless the circuit is open.
+func (cb *CircuitBreaker) Set(ctx context.Context, key string, value []byte, expiration int32) error {
+	if !cb.Healthy() {
+		cb.miss(key)
+		return nil
+	}
+	err := cb.cache.Set(ctx, key, value, expiration)
+	if err != nil {
+		cb.miss(key)
+	}
+	cb.record(err)
+	return err
+}
+
+// Get reads from the cache, reporting a miss while the circuit is open.
+func (cb *CircuitBreaker) Get(ctx context.Context, key string) ([]byte, error) {
+	if !cb.Healthy() {
+		return nil, nil
+	}
+	value, err := cb.cache.Get(ctx, key)
+	cb.record(err)
+	return value, err
+}
+
+// Delete removes a key unless the circuit is open.
+func (cb *CircuitBreaker) Delete(ctx context.Context, key string) error {
+	if !cb.Healthy() {
+		cb.miss(key)
+		return nil
+	}
+	err := cb.cache.Delete(ctx, key)
+	if err != nil {
+		cb.miss(key)
+	}
+	cb.record(err)
+	return err
+}
+
+// Ping checks the wrapped cache and opens or closes the circuit accordingly.
+func (cb *CircuitBreaker) Ping(ctx context.Context, maxRetries int) error {
+	err := cb.cache.Ping(ctx, maxRetries)
+	if err != nil {
+		cb.mu.Lock()
+		cb.failures = cb.failureThreshold - 1
+		cb.mu.Unlock()
+		cb.record(err)
+		return err
+	}
+	return cb.close(ctx)
+}
+
+// Probe pings the wrapped cache every interval while the circuit is open and
+// closes it once the cache answers again. It returns when ctx is cancelled.
+func (cb *CircuitBreaker) Probe(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if cb.Healthy() {
+			continue
+		}
+		if err := cb.cache.Ping(ctx, 1); err != nil {
+			continue
+		}
+		if err := cb.close(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("failed to repair the cache after an outage, keeping the circuit open", "error", err)
+		}
+	}
+}
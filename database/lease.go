@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrLeaseLost is returned by Lease.Check when another holder took the lease.
+var ErrLeaseLost = errors.New("lease lost")
+
+// Lease lets one replica at a time run a background job. It is a row of the
+// leases table naming its holder and when it expires; a holder that stops
+// renewing it loses it once it has expired.
+type Lease struct {
+	pool   *pgxpool.Pool
+	name   string
+	holder string
+	ttl    time.Duration
+}
+
+// NewLease returns a Lease on the job called name, identifying this process
+// as its holder.
+func NewLease(pool *pgxpool.Pool, name string, ttl time.Duration) *Lease {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return &Lease{
+		pool:   pool,
+		name:   name,
+		holder: fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix)),
+		ttl:    ttl,
+	}
+}
+
+// Acquire takes the lease if it is free or expired, or extends it if this
+// process already holds it, and reports whether this process holds it.
+func (l *Lease) Acquire(ctx context.Context) (bool, error) {
+	query := `
+	INSERT INTO leases (name, holder, expires_at)
+	VALUES ($1, $2, now() + $3::INT8 * INTERVAL '1 millisecond')
+	ON CONFLICT (name) DO UPDATE
+	SET holder = excluded.holder, expires_at = excluded.expires_at
+	WHERE leases.holder = excluded.holder OR leases.expires_at < now()
+	RETURNING holder`
+	var holder string
+	err := l.pool.QueryRow(ctx, query, l.name, l.holder, l.ttl.Milliseconds()).Scan(&holder)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease %s: %w", l.name, err)
+	}
+	return true, nil
+}
+
+// Check returns ErrLeaseLost unless this process holds the lease. Called in
+// a serializable transaction, it fences the transaction's writes: a holder
+// taking over concurrently makes one of the two transactions retry.
+func (l *Lease) Check(ctx context.Context, tx pgx.Tx) error {
+	var held bool
+	err := tx.QueryRow(ctx, `SELECT holder = $2 AND expires_at > now() FROM leases WHERE name = $1`, l.name, l.holder).Scan(&held)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !held) {
+		return ErrLeaseLost
+	}
+	return err
+}
+
+// Release gives the lease up so that another replica can take it over
+// without waiting for it to expire.
+func (l *Lease) Release(ctx context.Context) error {
+	if _, err := l.pool.Exec(ctx, `DELETE FROM leases WHERE name = $1 AND holder = $2`, l.name, l.holder); err != nil {
+		return fmt.Errorf("failed to release lease %s: %w", l.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// LocalCache is a size-bounded in-process LRU cache. Entries live for at most
+// the cache-wide TTL, or for their own expiration if that is shorter.
+type LocalCache struct {
+	lru *expirable.LRU[string, localEntry]
+}
+
+type localEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewLocalCache creates a LocalCache holding at most size entries, each living for ttl.
+func NewLocalCache(size int, ttl time.Duration) *LocalCache {
+	return &LocalCache{
+		lru: expirable.NewLRU[string, localEntry](size, nil, ttl),
+	}
+}
+
+// Set stores a value. An expiration of 0 means the entry only expires with the cache-wide TTL.
+func (lc *LocalCache) Set(ctx context.Context, key string, value []byte, expiration int32) error {
+	entry := localEntry{value: value}
+	if expiration > 0 {
+		entry.expiresAt = time.Now().Add(time.Duration(expiration) * time.Second)
+	}
+	lc.lru.Add(key, entry)
+	return nil
+}
+
+// Get returns the cached value, or nil on a miss.
+func (lc *LocalCache) Get(ctx context.Context, key string) ([]byte, error) {
+	entry, ok := lc.lru.Get(key)
+	if !ok {
+		return nil, nil
+	}
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		lc.lru.Remove(key)
+		return nil, nil
+	}
+	return entry.value, nil
+}
+
+// Delete removes a key from the cache.
+func (lc *LocalCache) Delete(ctx context.Context, key string) error {
+	lc.lru.Remove(key)
+	return nil
+}
+
+// Ping always succeeds for the in-process cache.
+func (lc *LocalCache) Ping(ctx context.Context, maxRetries int) error {
+	return nil
+}
+
+// Invalidate removes keys from the cache.
+func (lc *LocalCache) Invalidate(keys ...string) {
+	for _, key := range keys {
+		lc.lru.Remove(key)
+	}
+}
+
+// InvalidatePrefix removes every key starting with prefix.
+func (lc *LocalCache) InvalidatePrefix(prefix string) {
+	for _, key := range lc.lru.Keys() {
+		if strings.HasPrefix(key, prefix) {
+			lc.lru.Remove(key)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package database
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// ErrNoMemcachedNodes is returned when every node in a MemcachedCluster is ejected.
+var ErrNoMemcachedNodes = errors.New("no memcached nodes available")
+
+// ketamaPointsPerWeight is the number of ring points per unit of node weight,
+// each md5 digest yielding four of them.
+const ketamaPointsPerWeight = 160
+
+// MemcachedNode configures a single server of a MemcachedCluster.
+type MemcachedNode struct {
+	Address string
+	Timeout time.Duration
+	Weight  int
+}
+
+// MemcachedCluster spreads keys over several memcached servers using a
+// ketama-style consistent hash ring. Nodes that fail ejectAfter times in a row
+// are removed from the ring so their keys rebalance onto the remaining nodes,
+// and are given another chance after retryAfter.
+type MemcachedCluster struct {
+	ejectAfter int
+	retryAfter time.Duration
+
+	mu      sync.RWMutex
+	nodes   map[string]*clusterNode
+	ring    []ringPoint
+	recheck time.Time
+}
+
+type clusterNode struct {
+	config       MemcachedNode
+	client       *MemcachedClient
+	failures     int
+	ejectedUntil time.Time
+}
+
+type ringPoint struct {
+	hash uint32
+	node *clusterNode
+}
+
+// NewMemcachedCluster builds a cluster from nodes. A node is ejected after
+// ejectAfter consecutive failures and retried after retryAfter.
+func NewMemcachedCluster(nodes []MemcachedNode, ejectAfter int, retryAfter time.Duration) *MemcachedCluster {
+	if ejectAfter <= 0 {
+		ejectAfter = 3
+	}
+	if retryAfter <= 0 {
+		retryAfter = 30 * time.Second
+	}
+	mc := &MemcachedCluster{
+		ejectAfter: ejectAfter,
+		retryAfter: retryAfter,
+		nodes:      make(map[string]*clusterNode),
+	}
+	mc.SetServers(nodes)
+	return mc
+}
+
+// SetServers replaces the server list. Nodes that stay in the list keep their
+// connections and failure counts.
+func (mc *MemcachedCluster) SetServers(nodes []MemcachedNode) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	next := make(map[string]*clusterNode, len(nodes))
+	for _, config := range nodes {
+		if config.Weight <= 0 {
+			config.Weight = 1
+		}
+		if node, ok := mc.nodes[config.Address]; ok && node.config == config {
+			next[config.Address] = node
+			continue
+		}
+		client := memcache.New(config.Address)
+		if config.Timeout > 0 {
+			client.Timeout = config.Timeout
+		}
+		next[config.Address] = &clusterNode{config: config, client: &MemcachedClient{client: client}}
+	}
+	mc.nodes = next
+	mc.rebuild()
+
+	slog.Info("Memcached server list updated", "servers", len(next), "active", mc.activeCount())
+}
+
+// rebuild recomputes the ring from nodes that are not ejected. mc.mu must be held.
+func (mc *MemcachedCluster) rebuild() {
+	now := time.Now()
+	ring := make([]ringPoint, 0, len(mc.nodes)*ketamaPointsPerWeight)
+	mc.recheck = time.Time{}
+
+	for _, node := range mc.nodes {
+		if now.Before(node.ejectedUntil) {
+			if mc.recheck.IsZero() || node.ejectedUntil.Before(mc.recheck) {
+				mc.recheck = node.ejectedUntil
+			}
+			continue
+		}
+		for i := 0; i < node.config.Weight*ketamaPointsPerWeight/4; i++ {
+			digest := md5.Sum([]byte(node.config.Address + "-" + strconv.Itoa(i)))
+			for j := 0; j < 4; j++ {
+				ring = append(ring, ringPoint{
+					hash: binary.LittleEndian.Uint32(digest[j*4 : j*4+4]),
+					node: node,
+				})
+			}
+		}
+	}
+
+	sort.Slice(ring, func(a, b int) bool { return ring[a].hash < ring[b].hash })
+	mc.ring = ring
+}
+
+func (mc *MemcachedCluster) activeCount() int {
+	now := time.Now()
+	active := 0
+	for _, node := range mc.nodes {
+		if !now.Before(node.ejectedUntil) {
+			active++
+		}
+	}
+	return active
+}
+
+// pick returns the node owning key, readmitting ejected nodes whose retry time has passed.
+func (mc *MemcachedCluster) pick(key string) (*clusterNode, error) {
+	mc.mu.RLock()
+	if !mc.recheck.IsZero() && time.Now().After(mc.recheck) {
+		mc.mu.RUnlock()
+		mc.mu.Lock()
+		if !mc.recheck.IsZero() && time.Now().After(mc.recheck) {
+			mc.rebuild()
+		}
+		mc.mu.Unlock()
+		mc.mu.RLock()
+	}
+	defer mc.mu.RUnlock()
+
+	if len(mc.ring) == 0 {
+		return nil, ErrNoMemcachedNodes
+	}
+
+	digest := md5.Sum([]byte(key))
+	hash := binary.LittleEndian.Uint32(digest[:4])
+	i := sort.Search(len(mc.ring), func(i int) bool { return mc.ring[i].hash >= hash })
+	if i == len(mc.ring) {
+		i = 0
+	}
+	return mc.ring[i].node, nil
+}
+
+// record tracks the outcome of a call to node and ejects it after too many failures.
+func (mc *MemcachedCluster) record(node *clusterNode, err error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if !isNodeFailure(err) {
+		node.failures = 0
+		return
+	}
+
+	node.failures++
+	if node.failures < mc.ejectAfter || time.Now().Before(node.ejectedUntil) {
+		return
+	}
+
+	// A readmitted node is ejected again on its next failure.
+	node.failures = mc.ejectAfter - 1
+	node.ejectedUntil = time.Now().Add(mc.retryAfter)
+	mc.rebuild()
+
+	slog.Warn("Ejected memcached node", "address", node.config.Address, "retryAfter", mc.retryAfter, "active", mc.activeCount(), "error", err)
+}
+
+// isNodeFailure reports whether err means the node itself misbehaved, as
+// opposed to a miss or a problem with the request.
+func isNodeFailure(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, memcache.ErrCacheMiss),
+		errors.Is(err, memcache.ErrNotStored),
+		errors.Is(err, memcache.ErrCASConflict),
+		errors.Is(err, memcache.ErrMalformedKey):
+		return false
+	}
+	return true
+}
+
+// Set stores a key-value pair on the node owning key.
+func (mc *MemcachedCluster) Set(ctx context.Context, key string, value []byte, expiration int32) error {
+	node, err := mc.pick(key)
+	if err != nil {
+		return err
+	}
+	err = node.client.Set(ctx, key, value, expiration)
+	mc.record(node, err)
+	return err
+}
+
+// Get retrieves a value from the node owning key.
+func (mc *MemcachedCluster) Get(ctx context.Context, key string) ([]byte, error) {
+	node, err := mc.pick(key)
+	if err != nil {
+		return nil, err
+	}
+	value, err := node.client.Get(ctx, key)
+	mc.record(node, err)
+	return value, err
+}
+
+// Delete removes a key from the node owning it.
+func (mc *MemcachedCluster) Delete(ctx context.Context, key string) error {
+	node, err := mc.pick(key)
+	if err != nil {
+		return err
+	}
+	err = node.client.Delete(ctx, key)
+	mc.record(node, err)
+	return err
+}
+
+// Flush drops every entry on every node, including ejected ones.
+func (mc *MemcachedCluster) Flush(ctx context.Context) error {
+	mc.mu.RLock()
+	nodes := make([]*clusterNode, 0, len(mc.nodes))
+	for _, node := range mc.nodes {
+		nodes = append(nodes, node)
+	}
+	mc.mu.RUnlock()
+
+	var lastErr error
+	for _, node := range nodes {
+		if err := node.client.Flush(ctx); err != nil {
+			lastErr = fmt.Errorf("failed to flush %s: %w", node.config.Address, err)
+		}
+	}
+	return lastErr
+}
+
+// Ping pings every node, ejecting the ones that fail, and succeeds if at least one answers.
+func (mc *MemcachedCluster) Ping(ctx context.Context, maxRetries int) error {
+	mc.mu.RLock()
+	nodes := make([]*clusterNode, 0, len(mc.nodes))
+	for _, node := range mc.nodes {
+		nodes = append(nodes, node)
+	}
+	mc.mu.RUnlock()
+
+	if len(nodes) == 0 {
+		return ErrNoMemcachedNodes
+	}
+
+	var lastErr error
+	healthy := 0
+	for _, node := range nodes {
+		err := node.client.Ping(ctx, maxRetries)
+		if err == nil {
+			mc.mu.Lock()
+			if !node.ejectedUntil.IsZero() {
+				node.ejectedUntil = time.Time{}
+				mc.rebuild()
+			}
+			node.failures = 0
+			mc.mu.Unlock()
+			healthy++
+			continue
+		}
+
+		lastErr = err
+		mc.mu.Lock()
+		node.failures = mc.ejectAfter - 1
+		mc.mu.Unlock()
+		mc.record(node, err)
+	}
+
+	if healthy == 0 {
+		return fmt.Errorf("all %d memcached nodes are down: %w", len(nodes), lastErr)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// owners maps each of n keys to the address of the node owning it.
+func owners(t *testing.T, mc *MemcachedCluster, n int) map[string]string {
+	t.Helper()
+	owned := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("product:%d", i)
+		node, err := mc.pick(key)
+		if err != nil {
+			t.Fatalf("pick(%s): %v", key, err)
+		}
+		owned[key] = node.config.Address
+	}
+	return owned
+}
+
+func shares(owned map[string]string) map[string]float64 {
+	counts := make(map[string]float64)
+	for _, address := range owned {
+		counts[address]++
+	}
+	for address := range counts {
+		counts[address] /= float64(len(owned))
+	}
+	return counts
+}
+
+func TestRingDistribution(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []MemcachedNode
+		want  map[string]float64
+	}{
+		{
+			name:  "equal weights",
+			nodes: []MemcachedNode{{Address: "cache-a:11211"}, {Address: "cache-b:11211"}, {Address: "cache-c:11211"}},
+			want:  map[string]float64{"cache-a:11211": 1.0 / 3, "cache-b:11211": 1.0 / 3, "cache-c:11211": 1.0 / 3},
+		},
+		{
+			name:  "weighted",
+			nodes: []MemcachedNode{{Address: "cache-a:11211", Weight: 3}, {Address: "cache-b:11211", Weight: 1}},
+			want:  map[string]float64{"cache-a:11211": 0.75, "cache-b:11211": 0.25},
+		},
+		{
+			name:  "single node",
+			nodes: []MemcachedNode{{Address: "cache-a:11211"}},
+			want:  map[string]float64{"cache-a:11211": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := NewMemcachedCluster(tt.nodes, 0, 0)
+			got := shares(owners(t, mc, 20000))
+			for address, want := range tt.want {
+				if diff := got[address] - want; diff < -0.08 || diff > 0.08 {
+					t.Errorf("%s owns %.3f of the keys, want about %.3f", address, got[address], want)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("keys spread over %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRingIsConsistent(t *testing.T) {
+	nodes := []MemcachedNode{{Address: "cache-a:11211"}, {Address: "cache-b:11211"}, {Address: "cache-c:11211"}}
+	mc := NewMemcachedCluster(nodes, 0, 0)
+	before := owners(t, mc, 5000)
+
+	// The same servers in another order build the same ring.
+	mc.SetServers([]MemcachedNode{nodes[2], nodes[0], nodes[1]})
+	for key, address := range owners(t, mc, 5000) {
+		if before[key] != address {
+			t.Fatalf("%s moved from %s to %s after reordering the servers", key, before[key], address)
+		}
+	}
+
+	// Removing a server only moves its own keys.
+	mc.SetServers(nodes[:2])
+	for key, address := range owners(t, mc, 5000) {
+		if before[key] != "cache-c:11211" && before[key] != address {
+			t.Errorf("%s moved from %s to %s after removing cache-c", key, before[key], address)
+		}
+	}
+
+	// Adding a server only moves keys to it.
+	mc.SetServers(append(nodes, MemcachedNode{Address: "cache-d:11211"}))
+	moved := 0
+	for key, address := range owners(t, mc, 5000) {
+		if before[key] == address {
+			continue
+		}
+		moved++
+		if address != "cache-d:11211" {
+			t.Errorf("%s moved from %s to %s after adding cache-d", key, before[key], address)
+		}
+	}
+	if moved == 0 {
+		t.Error("no keys moved to the added server")
+	}
+}
+
+func TestSetServersKeepsNodes(t *testing.T) {
+	mc := NewMemcachedCluster([]MemcachedNode{{Address: "cache-a:11211"}, {Address: "cache-b:11211", Timeout: time.Second}}, 0, 0)
+	a, b := mc.nodes["cache-a:11211"], mc.nodes["cache-b:11211"]
+	a.failures = 2
+
+	mc.SetServers([]MemcachedNode{{Address: "cache-a:11211", Weight: 1}, {Address: "cache-b:11211", Timeout: 2 * time.Second}})
+	if mc.nodes["cache-a:11211"] != a || a.failures != 2 {
+		t.Error("an unchanged server lost its connection or failure count")
+	}
+	if mc.nodes["cache-b:11211"] == b {
+		t.Error("a server with a new timeout kept its old client")
+	}
+}
+
+func TestEjection(t *testing.T) {
+	mc := NewMemcachedCluster([]MemcachedNode{{Address: "cache-a:11211"}, {Address: "cache-b:11211"}}, 2, time.Hour)
+	before := owners(t, mc, 2000)
+	a := mc.nodes["cache-a:11211"]
+	failure := errors.New("connection refused")
+
+	// Misses and failures below the threshold keep the node.
+	mc.record(a, failure)
+	mc.record(a, memcache.ErrCacheMiss)
+	mc.record(a, failure)
+	if got := shares(owners(t, mc, 2000)); got["cache-a:11211"] == 0 {
+		t.Fatal("cache-a was ejected although a success reset its failures")
+	}
+
+	mc.record(a, failure)
+	after := owners(t, mc, 2000)
+	for key, address := range after {
+		if address != "cache-b:11211" {
+			t.Fatalf("%s is still owned by %s after ejecting cache-a", key, address)
+		}
+		if before[key] == "cache-b:11211" && address != before[key] {
+			t.Errorf("%s moved off the healthy node", key)
+		}
+	}
+
+	mc.record(mc.nodes["cache-b:11211"], failure)
+	mc.record(mc.nodes["cache-b:11211"], failure)
+	if _, err := mc.pick("product:1"); !errors.Is(err, ErrNoMemcachedNodes) {
+		t.Errorf("pick with every node ejected: err = %v, want ErrNoMemcachedNodes", err)
+	}
+}
+
+func TestEjectedNodeReadmitted(t *testing.T) {
+	mc := NewMemcachedCluster([]MemcachedNode{{Address: "cache-a:11211"}, {Address: "cache-b:11211"}}, 1, time.Hour)
+	before := owners(t, mc, 2000)
+	a := mc.nodes["cache-a:11211"]
+
+	mc.record(a, errors.New("i/o timeout"))
+	if shares(owners(t, mc, 2000))["cache-a:11211"] != 0 {
+		t.Fatal("cache-a was not ejected")
+	}
+
+	// Once its retry time has passed, the next pick rebuilds the ring.
+	mc.mu.Lock()
+	a.ejectedUntil = time.Now().Add(-time.Second)
+	mc.recheck = a.ejectedUntil
+	mc.mu.Unlock()
+	for key, address := range owners(t, mc, 2000) {
+		if before[key] != address {
+			t.Fatalf("%s is owned by %s after readmission, want %s", key, address, before[key])
+		}
+	}
+}
+
+func TestIsNodeFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{memcache.ErrCacheMiss, false},
+		{memcache.ErrNotStored, false},
+		{memcache.ErrCASConflict, false},
+		{memcache.ErrMalformedKey, false},
+		{fmt.Errorf("get: %w", memcache.ErrCacheMiss), false},
+		{memcache.ErrServerError, true},
+		{errors.New("dial tcp: connection refused"), true},
+	}
+	for _, tt := range tests {
+		if got := isNodeFailure(tt.err); got != tt.want {
+			t.Errorf("isNodeFailure(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
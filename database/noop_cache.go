@@ -0,0 +1,27 @@
+package database
+
+import "context"
+
+// NoopCache disables caching: every read is a miss and every write is dropped.
+type NoopCache struct{}
+
+// NewNoopCache returns a cache that stores nothing.
+func NewNoopCache() *NoopCache {
+	return &NoopCache{}
+}
+
+func (NoopCache) Set(ctx context.Context, key string, value []byte, expiration int32) error {
+	return nil
+}
+
+func (NoopCache) Get(ctx context.Context, key string) ([]byte, error) {
+	return nil, nil
+}
+
+func (NoopCache) Delete(ctx context.Context, key string) error {
+	return nil
+}
+
+func (NoopCache) Ping(ctx context.Context, maxRetries int) error {
+	return nil
+}
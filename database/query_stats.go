@@ -0,0 +1,208 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	queryKindProduct     = "product"
+	queryKindProductList = "product-list"
+
+	// maxRecordedSearchTermLength is the longest search term recorded, in
+	// characters. Longer terms are rarely repeated and more likely to hold
+	// personal data, so they are not stored at all.
+	maxRecordedSearchTermLength = 64
+
+	// purgeInterval is how often statistics past their retention are deleted.
+	purgeInterval = time.Hour
+)
+
+// ListQuery identifies a ListProducts query independently of its page.
+type ListQuery struct {
+	PageSize   int32
+	SearchTerm string
+}
+
+// QueryStats counts product reads and list queries in memory and periodically
+// adds them to the query_stats table, so that later runs know what is popular.
+// Statistics not seen for longer than the retention are deleted.
+type QueryStats struct {
+	pool      *pgxpool.Pool
+	retention time.Duration
+
+	mu       sync.Mutex
+	products map[int64]int64
+	lists    map[ListQuery]int64
+}
+
+// NewQueryStats returns a recorder backed by the query_stats table that keeps
+// statistics for retention after they were last seen.
+func NewQueryStats(pool *pgxpool.Pool, retention time.Duration) *QueryStats {
+	if retention <= 0 {
+		retention = 30 * 24 * time.Hour
+	}
+	return &QueryStats{
+		pool:      pool,
+		retention: retention,
+		products:  make(map[int64]int64),
+		lists:     make(map[ListQuery]int64),
+	}
+}
+
+// RecordProduct counts a read of a single product.
+func (qs *QueryStats) RecordProduct(id int64) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	qs.products[id]++
+}
+
+// RecordList counts a ListProducts query. Queries with search terms longer
+// than maxRecordedSearchTermLength are not counted.
+func (qs *QueryStats) RecordList(query ListQuery) {
+	if utf8.RuneCountInString(query.SearchTerm) > maxRecordedSearchTermLength {
+		return
+	}
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	qs.lists[query]++
+}
+
+// Flush adds the counts gathered since the last flush to the database.
+func (qs *QueryStats) Flush(ctx context.Context) error {
+	qs.mu.Lock()
+	products, lists := qs.products, qs.lists
+	qs.products = make(map[int64]int64)
+	qs.lists = make(map[ListQuery]int64)
+	qs.mu.Unlock()
+
+	if len(products) == 0 && len(lists) == 0 {
+		return nil
+	}
+
+	query := `
+	INSERT INTO query_stats (kind, query_key, page_size, hits, last_seen)
+	VALUES ($1, $2, $3, $4, now())
+	ON CONFLICT (kind, query_key, page_size)
+	DO UPDATE SET hits = query_stats.hits + excluded.hits, last_seen = excluded.last_seen
+	`
+	batch := &pgx.Batch{}
+	for id, hits := range products {
+		batch.Queue(query, queryKindProduct, strconv.FormatInt(id, 10), 0, hits)
+	}
+	for list, hits := range lists {
+		batch.Queue(query, queryKindProductList, list.SearchTerm, list.PageSize, hits)
+	}
+
+	if err := qs.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to flush query stats: %w", err)
+	}
+	return nil
+}
+
+// Purge deletes the statistics last seen longer than the retention ago.
+func (qs *QueryStats) Purge(ctx context.Context) error {
+	tag, err := qs.pool.Exec(ctx, `DELETE FROM query_stats WHERE last_seen < $1`, time.Now().Add(-qs.retention))
+	if err != nil {
+		return fmt.Errorf("failed to purge query stats: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		slog.Info("purged expired query stats", "rows", tag.RowsAffected())
+	}
+	return nil
+}
+
+// Run flushes every interval and purges expired statistics every
+// purgeInterval until ctx is cancelled, then flushes once more.
+func (qs *QueryStats) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastPurge time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := qs.Flush(flushCtx); err != nil {
+				slog.Warn("failed to flush query stats on shutdown", "error", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := qs.Flush(ctx); err != nil {
+				slog.Warn("failed to flush query stats", "error", err)
+			}
+			if time.Since(lastPurge) >= purgeInterval {
+				if err := qs.Purge(ctx); err != nil {
+					slog.Warn("failed to purge query stats", "error", err)
+				}
+				lastPurge = time.Now()
+			}
+		}
+	}
+}
+
+// TopProducts returns the ids of the n most read products seen within window.
+func (qs *QueryStats) TopProducts(ctx context.Context, n int, window time.Duration) ([]int64, error) {
+	query := `
+	SELECT query_key
+	FROM query_stats
+	WHERE kind = $1 AND last_seen > $2
+	ORDER BY hits DESC
+	LIMIT $3
+	`
+	rows, err := qs.pool.Query(ctx, query, queryKindProduct, time.Now().Add(-window), n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		if id, err := strconv.ParseInt(key, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// TopListQueries returns the n most common ListProducts queries seen within window.
+func (qs *QueryStats) TopListQueries(ctx context.Context, n int, window time.Duration) ([]ListQuery, error) {
+	query := `
+	SELECT query_key, page_size
+	FROM query_stats
+	WHERE kind = $1 AND last_seen > $2
+	ORDER BY hits DESC
+	LIMIT $3
+	`
+	rows, err := qs.pool.Query(ctx, query, queryKindProductList, time.Now().Add(-window), n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queries []ListQuery
+	for rows.Next() {
+		var list ListQuery
+		if err := rows.Scan(&list.SearchTerm, &list.PageSize); err != nil {
+			return nil, err
+		}
+		queries = append(queries, list)
+	}
+	return queries, rows.Err()
+}
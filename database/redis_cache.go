@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisClient implements CacheMethods on top of any server speaking the Redis protocol.
+type RedisClient struct {
+	client *redis.Client
+}
+
+// NewRedisClient creates a client for the Redis-compatible server at address.
+// Connections are made lazily, so an unreachable server is only reported by
+// Ping or later calls.
+func NewRedisClient(address, password string, db int) *RedisClient {
+	client := redis.NewClient(&redis.Options{
+		Addr:     address,
+		Password: password,
+		DB:       db,
+	})
+	return &RedisClient{client: client}
+}
+
+// Set stores a key-value pair with an expiration time in seconds (0 = never expires).
+func (rc *RedisClient) Set(ctx context.Context, key string, value []byte, expiration int32) error {
+	return rc.client.Set(ctx, key, value, time.Duration(expiration)*time.Second).Err()
+}
+
+// Get retrieves a value by key, returning nil on a miss.
+func (rc *RedisClient) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := rc.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+// Delete removes a key-value pair.
+func (rc *RedisClient) Delete(ctx context.Context, key string) error {
+	return rc.client.Del(ctx, key).Err()
+}
+
+// Flush drops every entry of the selected database.
+func (rc *RedisClient) Flush(ctx context.Context) error {
+	return rc.client.FlushDB(ctx).Err()
+}
+
+// Ping checks if the Redis connection is alive with retries.
+func (rc *RedisClient) Ping(ctx context.Context, maxRetries int) error {
+	var err error
+	for i := 0; i < maxRetries; i++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err = rc.client.Ping(ctx).Err()
+		if err == nil {
+			slog.Info("Successfully pinged Redis")
+			return nil
+		}
+
+		slog.Warn(
+			"Redis ping failed, retrying...",
+			"attempt", i+1,
+			"remainingRetries", maxRetries-i-1,
+			"error", err,
+		)
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return fmt.Errorf("failed to ping Redis after %d retries: %w", maxRetries, err)
+}
+
+// Close releases the underlying connections.
+func (rc *RedisClient) Close() error {
+	return rc.client.Close()
+}
@@ -0,0 +1,298 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a single-process server speaking enough RESP2 for RedisClient:
+// AUTH, SELECT, CLIENT, PING, GET, SET with EX or PX, DEL and FLUSHDB. HELLO is
+// refused like on servers that predate RESP3.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu  sync.Mutex
+	dbs map[int]map[string]fakeEntry
+}
+
+type fakeEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{listener: listener, password: password, dbs: make(map[int]map[string]fakeEntry)}
+	go f.serve()
+	t.Cleanup(func() { listener.Close() })
+	return f
+}
+
+func (f *fakeRedis) Addr() string { return f.listener.Addr().String() }
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	db, authenticated := 0, f.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		name := strings.ToUpper(string(args[0]))
+		switch {
+		case name == "AUTH":
+			if len(args) == 2 && string(args[1]) == f.password {
+				authenticated = true
+				w.WriteString("+OK\r\n")
+			} else {
+				w.WriteString("-WRONGPASS invalid password\r\n")
+			}
+		case !authenticated:
+			w.WriteString("-NOAUTH Authentication required.\r\n")
+		case name == "SELECT":
+			db, _ = strconv.Atoi(string(args[1]))
+			w.WriteString("+OK\r\n")
+		case name == "CLIENT":
+			w.WriteString("+OK\r\n")
+		case name == "PING":
+			w.WriteString("+PONG\r\n")
+		case name == "GET":
+			if value, ok := f.get(db, string(args[1])); ok {
+				fmt.Fprintf(w, "$%d\r\n%s\r\n", len(value), value)
+			} else {
+				w.WriteString("$-1\r\n")
+			}
+		case name == "SET":
+			if err := f.set(db, args[1:]); err != nil {
+				fmt.Fprintf(w, "-ERR %v\r\n", err)
+			} else {
+				w.WriteString("+OK\r\n")
+			}
+		case name == "DEL":
+			fmt.Fprintf(w, ":%d\r\n", f.del(db, args[1:]))
+		case name == "FLUSHDB":
+			f.mu.Lock()
+			delete(f.dbs, db)
+			f.mu.Unlock()
+			w.WriteString("+OK\r\n")
+		default:
+			fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads one command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("malformed array header %q", line)
+	}
+	args := make([][]byte, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("malformed bulk header %q", line)
+		}
+		args[i] = make([]byte, size+2)
+		if _, err := io.ReadFull(r, args[i]); err != nil {
+			return nil, err
+		}
+		args[i] = args[i][:size]
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) get(db int, key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entry, ok := f.dbs[db][key]
+	if !ok || (!entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt)) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (f *fakeRedis) set(db int, args [][]byte) error {
+	if len(args) != 2 && len(args) != 4 {
+		return fmt.Errorf("wrong number of arguments for 'set' command")
+	}
+	entry := fakeEntry{value: bytes.Clone(args[1])}
+	if len(args) == 4 {
+		n, err := strconv.Atoi(string(args[3]))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid expire time in 'set' command")
+		}
+		switch strings.ToUpper(string(args[2])) {
+		case "EX":
+			entry.expiresAt = time.Now().Add(time.Duration(n) * time.Second)
+		case "PX":
+			entry.expiresAt = time.Now().Add(time.Duration(n) * time.Millisecond)
+		default:
+			return fmt.Errorf("syntax error")
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dbs[db] == nil {
+		f.dbs[db] = make(map[string]fakeEntry)
+	}
+	f.dbs[db][string(args[0])] = entry
+	return nil
+}
+
+func (f *fakeRedis) del(db int, keys [][]byte) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	deleted := 0
+	for _, key := range keys {
+		if _, ok := f.dbs[db][string(key)]; ok {
+			delete(f.dbs[db], string(key))
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// expiry returns when key in db expires, or the zero time if it never does.
+func (f *fakeRedis) expiry(db int, key string) (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entry, ok := f.dbs[db][key]
+	return entry.expiresAt, ok
+}
+
+func TestRedisClient(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeRedis(t, "")
+	rc := NewRedisClient(server.Addr(), "", 0)
+	t.Cleanup(func() { rc.Close() })
+
+	if err := rc.Ping(ctx, 1); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	value, err := rc.Get(ctx, "product:1")
+	if value != nil || err != nil {
+		t.Errorf("Get of an absent key = %q, %v; want nil, nil", value, err)
+	}
+
+	if err := rc.Set(ctx, "product:1", []byte("\xce\x0e\x01\x00binary"), 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if value, err := rc.Get(ctx, "product:1"); err != nil || string(value) != "\xce\x0e\x01\x00binary" {
+		t.Errorf("Get = %q, %v; want the stored bytes", value, err)
+	}
+	if expiresAt, _ := server.expiry(0, "product:1"); !expiresAt.IsZero() {
+		t.Errorf("an expiration of 0 stored the key until %v, want no expiry", expiresAt)
+	}
+
+	if err := rc.Set(ctx, "product:2", []byte("expiring"), 30); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	expiresAt, _ := server.expiry(0, "product:2")
+	if ttl := time.Until(expiresAt); ttl < 25*time.Second || ttl > 30*time.Second {
+		t.Errorf("an expiration of 30 stored the key for %v", ttl)
+	}
+
+	if err := rc.Delete(ctx, "product:1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if value, err := rc.Get(ctx, "product:1"); value != nil || err != nil {
+		t.Errorf("Get after Delete = %q, %v; want nil, nil", value, err)
+	}
+	if err := rc.Delete(ctx, "product:1"); err != nil {
+		t.Errorf("Delete of an absent key: %v", err)
+	}
+
+	if err := rc.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if value, err := rc.Get(ctx, "product:2"); value != nil || err != nil {
+		t.Errorf("Get after Flush = %q, %v; want nil, nil", value, err)
+	}
+}
+
+func TestRedisClientAuthAndDatabase(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeRedis(t, "secret")
+
+	rc := NewRedisClient(server.Addr(), "secret", 3)
+	t.Cleanup(func() { rc.Close() })
+	if err := rc.Set(ctx, "product:1", []byte("in db 3"), 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, ok := server.expiry(3, "product:1"); !ok {
+		t.Error("the key was not stored in the selected database")
+	}
+	if _, ok := server.expiry(0, "product:1"); ok {
+		t.Error("the key was stored in the default database")
+	}
+
+	wrong := NewRedisClient(server.Addr(), "guess", 0)
+	t.Cleanup(func() { wrong.Close() })
+	if _, err := wrong.Get(ctx, "product:1"); err == nil {
+		t.Error("Get with a wrong password succeeded")
+	}
+}
+
+func TestRedisClientPingUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	rc := NewRedisClient(address, "", 0)
+	t.Cleanup(func() { rc.Close() })
+	if err := rc.Ping(context.Background(), 2); err == nil {
+		t.Error("Ping of a closed port succeeded")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := rc.Ping(ctx, 5); !errors.Is(err, context.Canceled) {
+		t.Errorf("Ping with a cancelled context = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+)
+
+// TieredCache serves reads from an in-process LocalCache and falls back to a
+// remote cache such as memcached.
+type TieredCache struct {
+	local  *LocalCache
+	remote CacheMethods
+}
+
+// NewTieredCache puts local in front of remote.
+func NewTieredCache(local *LocalCache, remote CacheMethods) *TieredCache {
+	return &TieredCache{
+		local:  local,
+		remote: remote,
+	}
+}
+
+// Set writes through to the remote cache and then the local tier.
+func (tc *TieredCache) Set(ctx context.Context, key string, value []byte, expiration int32) error {
+	if err := tc.remote.Set(ctx, key, value, expiration); err != nil {
+		return err
+	}
+	return tc.local.Set(ctx, key, value, expiration)
+}
+
+// Get checks the local tier first and populates it on a remote hit.
+func (tc *TieredCache) Get(ctx context.Context, key string) ([]byte, error) {
+	if value, _ := tc.local.Get(ctx, key); value != nil {
+		return value, nil
+	}
+
+	value, err := tc.remote.Get(ctx, key)
+	if err != nil || value == nil {
+		return value, err
+	}
+
+	_ = tc.local.Set(ctx, key, value, 0)
+	return value, nil
+}
+
+// Delete removes the key from both tiers.
+func (tc *TieredCache) Delete(ctx context.Context, key string) error {
+	_ = tc.local.Delete(ctx, key)
+	return tc.remote.Delete(ctx, key)
+}
+
+// Ping checks the remote tier.
+func (tc *TieredCache) Ping(ctx context.Context, maxRetries int) error {
+	return tc.remote.Ping(ctx, maxRetries)
+}
+
+// Invalidate drops keys from the local tier only. It is used when another
+// replica has already updated the remote tier.
+func (tc *TieredCache) Invalidate(keys ...string) {
+	tc.local.Invalidate(keys...)
+}
+
+// InvalidatePrefix drops every local entry whose key starts with prefix.
+func (tc *TieredCache) InvalidatePrefix(prefix string) {
+	tc.local.InvalidatePrefix(prefix)
+}
@@ -0,0 +1,187 @@
+// Package duplicates scores how likely two products are the same product
+// entered twice, e.g. "Levi's 501 Jeans" and "levis 501 jeans ".
+package duplicates
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Weights of the signals in a score. They add up to 1.
+const (
+	nameWeight        = 0.55
+	categoryWeight    = 0.2
+	typeWeight        = 0.1
+	attributesWeight  = 0.15
+	unknownSimilarity = 0.5 // for signals missing on either side
+)
+
+// Product holds what duplicates are recognized by.
+type Product struct {
+	ID          int64
+	Name        string
+	CategoryID  int64
+	Category    string
+	ProductType string
+	// Attributes of the variation, formatted as text.
+	Attributes map[string]string
+}
+
+// Match is a candidate scored against a product.
+type Match struct {
+	Product Product
+	// Score is between 0 and 1, 1 meaning certainly the same product.
+	Score   float64
+	Reasons []string
+}
+
+// NormalizeName folds a product name for comparison: compatibility
+// normalized, without accents or punctuation, lower case and with single
+// spaces between words.
+func NormalizeName(name string) string {
+	folded, _, err := transform.String(transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), name)
+	if err != nil {
+		folded = name
+	}
+	// Apostrophes join words, so "Levi's" and "Levis" compare equal.
+	apostrophes := strings.NewReplacer("'", "", "\u2019", "")
+	words := strings.FieldsFunc(apostrophes.Replace(strings.ToLower(folded)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// trigrams returns the set of trigrams of s the way pg_trgm builds them:
+// each word padded with two spaces in front and one behind.
+func trigrams(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(s) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// Similarity returns the trigram similarity of two normalized names: the
+// number of shared trigrams over the number of distinct trigrams, as
+// pg_trgm's similarity().
+func Similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	shared := 0
+	for trigram := range ta {
+		if tb[trigram] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+// Score rates how likely candidate duplicates product.
+func Score(product, candidate Product) Match {
+	var (
+		score   float64
+		reasons []string
+	)
+
+	name, candidateName := NormalizeName(product.Name), NormalizeName(candidate.Name)
+	if name == candidateName {
+		score += nameWeight
+		reasons = append(reasons, "same name")
+	} else {
+		similarity := Similarity(name, candidateName)
+		score += nameWeight * similarity
+		reasons = append(reasons, "similar name ("+strconv.FormatFloat(similarity, 'f', 2, 64)+")")
+	}
+
+	switch {
+	case product.CategoryID != 0 && candidate.CategoryID != 0:
+		if product.CategoryID == candidate.CategoryID {
+			score += categoryWeight
+			reasons = append(reasons, "same category")
+		}
+	case product.Category != "" && candidate.Category != "":
+		if strings.EqualFold(product.Category, candidate.Category) {
+			score += categoryWeight
+			reasons = append(reasons, "same category")
+		}
+	default:
+		score += categoryWeight * unknownSimilarity
+	}
+
+	switch {
+	case product.ProductType != "" && candidate.ProductType != "":
+		if product.ProductType == candidate.ProductType {
+			score += typeWeight
+			reasons = append(reasons, "same product type")
+		}
+	default:
+		score += typeWeight * unknownSimilarity
+	}
+
+	if len(product.Attributes) > 0 && len(candidate.Attributes) > 0 {
+		same, keys := 0, make(map[string]bool)
+		for key, value := range product.Attributes {
+			keys[key] = true
+			if other, ok := candidate.Attributes[key]; ok && strings.EqualFold(other, value) {
+				same++
+			}
+		}
+		for key := range candidate.Attributes {
+			keys[key] = true
+		}
+		overlap := float64(same) / float64(len(keys))
+		score += attributesWeight * overlap
+		if same > 0 {
+			reasons = append(reasons, strconv.Itoa(same)+" of "+strconv.Itoa(len(keys))+" attributes equal")
+		}
+	} else {
+		score += attributesWeight * unknownSimilarity
+	}
+
+	return Match{Product: candidate, Score: math.Round(score*1000) / 1000, Reasons: reasons}
+}
+
+// Rank scores candidates against product and returns those scoring at least
+// minScore, best first.
+func Rank(product Product, candidates []Product, minScore float64) []Match {
+	var matches []Match
+	for _, candidate := range candidates {
+		if match := Score(product, candidate); match.Score >= minScore {
+			matches = append(matches, match)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches
+}
+
+// Attributes formats the attributes of a variation as text, leaving out
+// null and empty values.
+func Attributes(attributes *structpb.Struct) map[string]string {
+	text := make(map[string]string, len(attributes.GetFields()))
+	for key, value := range attributes.GetFields() {
+		switch v := value.GetKind().(type) {
+		case *structpb.Value_StringValue:
+			if v.StringValue != "" {
+				text[key] = v.StringValue
+			}
+		case *structpb.Value_NumberValue:
+			text[key] = strconv.FormatFloat(v.NumberValue, 'f', -1, 64)
+		case *structpb.Value_BoolValue:
+			text[key] = strconv.FormatBool(v.BoolValue)
+		}
+	}
+	return text
+}
@@ -0,0 +1,181 @@
+package duplicates
+
+import (
+	"maps"
+	"math"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Levi's 501 Jeans", "levis 501 jeans"},
+		{"levis 501 jeans ", "levis 501 jeans"},
+		{"Levi’s", "levis"},
+		{"Crème Brûlée!", "creme brulee"},
+		{"  Foo--Bar  ", "foo bar"},
+		{"ＵＳＢ-C Cable", "usb c cable"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeName(tt.name); got != tt.want {
+			t.Errorf("NormalizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"abc", "abc", 1},
+		{"levis 501 jeans", "levis 501 jeans", 1},
+		// "  c", " ca" are shared out of "cat", "at ", "car", "art", "rt ".
+		{"cat", "cart", 2.0 / 7},
+		{"cat", "dog", 0},
+		{"", "cat", 0},
+		{"", "", 0},
+		// Word order does not matter.
+		{"blue shirt", "shirt blue", 1},
+	}
+	for _, tt := range tests {
+		got := Similarity(tt.a, tt.b)
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if reverse := Similarity(tt.b, tt.a); math.Abs(reverse-got) > 1e-9 {
+			t.Errorf("Similarity(%q, %q) = %v, not symmetric with %v", tt.b, tt.a, reverse, got)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	jeans := Product{
+		Name:        "Levi's 501 Jeans",
+		CategoryID:  1,
+		ProductType: "clothing",
+		Attributes:  map[string]string{"size": "32", "color": "blue"},
+	}
+	tests := []struct {
+		name      string
+		product   Product
+		candidate Product
+		want      float64
+	}{
+		{
+			name:    "same product spelled differently",
+			product: jeans,
+			candidate: Product{
+				Name:        "levis 501 jeans ",
+				CategoryID:  1,
+				ProductType: "clothing",
+				Attributes:  map[string]string{"size": "32", "color": "Blue"},
+			},
+			want: 1,
+		},
+		{
+			name:      "other category",
+			product:   jeans,
+			candidate: Product{Name: "Levi's 501 Jeans", CategoryID: 2, ProductType: "clothing", Attributes: jeans.Attributes},
+			want:      0.8,
+		},
+		{
+			name:      "nothing but the name known",
+			product:   Product{Name: "Desk Lamp"},
+			candidate: Product{Name: "desk lamp"},
+			want:      0.55 + 0.2*0.5 + 0.1*0.5 + 0.15*0.5,
+		},
+		{
+			name:      "category names compared without ids",
+			product:   Product{Name: "Desk Lamp", Category: "Lighting"},
+			candidate: Product{Name: "desk lamp", Category: "lighting"},
+			want:      0.55 + 0.2 + 0.1*0.5 + 0.15*0.5,
+		},
+		{
+			name:      "one of three attributes equal",
+			product:   Product{Name: "Tee", CategoryID: 3, ProductType: "clothing", Attributes: map[string]string{"size": "M", "color": "red"}},
+			candidate: Product{Name: "Tee", CategoryID: 3, ProductType: "clothing", Attributes: map[string]string{"size": "M", "color": "blue", "material": "cotton"}},
+			want:      0.55 + 0.2 + 0.1 + 0.15/3,
+		},
+		{
+			name:      "other type",
+			product:   Product{Name: "Tee", CategoryID: 3, ProductType: "clothing"},
+			candidate: Product{Name: "Tee", CategoryID: 3, ProductType: "food"},
+			want:      0.55 + 0.2 + 0.15*0.5,
+		},
+		{
+			name:      "similar name",
+			product:   Product{Name: "cat", CategoryID: 3, ProductType: "food"},
+			candidate: Product{Name: "cart", CategoryID: 3, ProductType: "food"},
+			want:      0.55*2/7 + 0.2 + 0.1 + 0.15*0.5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := Score(tt.product, tt.candidate)
+			if want := math.Round(tt.want*1000) / 1000; match.Score != want {
+				t.Errorf("Score = %v, want %v (reasons %q)", match.Score, want, match.Reasons)
+			}
+			if match.Product.Name != tt.candidate.Name {
+				t.Errorf("Match.Product = %+v, want the candidate", match.Product)
+			}
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	product := Product{Name: "Desk Lamp", CategoryID: 1, ProductType: "lighting"}
+	candidates := []Product{
+		{ID: 1, Name: "Floor Lamp", CategoryID: 1, ProductType: "lighting"},
+		{ID: 2, Name: "desk lamp", CategoryID: 1, ProductType: "lighting"},
+		{ID: 3, Name: "Garden Hose", CategoryID: 2, ProductType: "garden"},
+		{ID: 4, Name: "Desk-Lamp", CategoryID: 1, ProductType: "lighting"},
+	}
+
+	matches := Rank(product, candidates, 0.75)
+	var ids []int64
+	for i, match := range matches {
+		ids = append(ids, match.Product.ID)
+		if match.Score < 0.75 {
+			t.Errorf("match %d scores %v, below the minimum", match.Product.ID, match.Score)
+		}
+		if i > 0 && match.Score > matches[i-1].Score {
+			t.Errorf("matches are not sorted by score: %v before %v", matches[i-1].Score, match.Score)
+		}
+	}
+	// Equal scores keep the order of the candidates.
+	if len(ids) != 2 || ids[0] != 2 || ids[1] != 4 {
+		t.Errorf("Rank returned products %v, want [2 4]", ids)
+	}
+
+	if matches := Rank(product, candidates, 0); len(matches) != len(candidates) {
+		t.Errorf("Rank with no minimum returned %d matches, want %d", len(matches), len(candidates))
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	attributes, err := structpb.NewStruct(map[string]interface{}{
+		"color":    "blue",
+		"empty":    "",
+		"size":     32,
+		"weight":   1.5,
+		"vegan":    true,
+		"missing":  nil,
+		"features": []interface{}{"a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"color": "blue", "size": "32", "weight": "1.5", "vegan": "true"}
+	if got := Attributes(attributes); !maps.Equal(got, want) {
+		t.Errorf("Attributes = %v, want %v", got, want)
+	}
+	if got := Attributes(nil); len(got) != 0 {
+		t.Errorf("Attributes(nil) = %v, want none", got)
+	}
+}
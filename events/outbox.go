@@ -0,0 +1,225 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Kind identifies what happened to a product.
+type Kind string
+
+const (
+	ProductCreated Kind = "PRODUCT_CREATED"
+	ProductUpdated Kind = "PRODUCT_UPDATED"
+	ProductDeleted Kind = "PRODUCT_DELETED"
+	// CacheEvicted is published by cache administration. A ProductID of 0
+	// means every product list was evicted.
+	CacheEvicted Kind = "CACHE_EVICTED"
+	// ExchangeRatesUpdated is published when an exchange rate changes so
+	// every replica reloads its rates. ProductID is always 0.
+	ExchangeRatesUpdated Kind = "EXCHANGE_RATES_UPDATED"
+	// PriceChanged is published when a scheduled price change of a product
+	// starts or ends.
+	PriceChanged Kind = "PRICE_CHANGED"
+	// PromotionsUpdated is published when a promotion is created, changed or
+	// deleted so every replica reloads them. ProductID is always 0.
+	PromotionsUpdated Kind = "PROMOTIONS_UPDATED"
+	// CategoriesUpdated is published when the category tree changes shape,
+	// which changes the products of category filters, or when a category is
+	// renamed, which changes its products. ProductID is always 0.
+	CategoriesUpdated Kind = "CATEGORIES_UPDATED"
+	// TagsMerged is published for every batch of products whose tags a tag
+	// merge rewrote. ProductID is always 0.
+	TagsMerged Kind = "TAGS_MERGED"
+	// ProductPublished and ProductUnpublished are published when a product
+	// enters or leaves the PUBLISHED lifecycle state, by hand or on schedule.
+	// Payload is the ProductTransition in protojson.
+	ProductPublished   Kind = "PRODUCT_PUBLISHED"
+	ProductUnpublished Kind = "PRODUCT_UNPUBLISHED"
+)
+
+// Event is a single product mutation recorded in the product_events table.
+type Event struct {
+	ID        int64
+	Kind      Kind
+	ProductID int64
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// Handler is called for every event observed by Subscribe.
+type Handler func(Event)
+
+// Chain returns a Handler that passes every event to each handler in order.
+func Chain(handlers ...Handler) Handler {
+	return func(event Event) {
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+}
+
+// Publisher records product mutation events.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+	PublishTx(ctx context.Context, tx pgx.Tx, event Event) error
+}
+
+// Outbox stores events in CockroachDB so that every replica can observe them.
+type Outbox struct {
+	pool *pgxpool.Pool
+	// skew is how far behind the cursor each poll looks, so that rows
+	// committed with an older transaction timestamp are not missed.
+	skew time.Duration
+	// retention is how long events are kept before being purged.
+	retention time.Duration
+}
+
+// NewOutbox returns an Outbox backed by the product_events table.
+func NewOutbox(pool *pgxpool.Pool) *Outbox {
+	return &Outbox{
+		pool:      pool,
+		skew:      5 * time.Second,
+		retention: 24 * time.Hour,
+	}
+}
+
+const insertEventQuery = `INSERT INTO product_events (kind, product_id, payload) VALUES ($1, $2, $3)`
+
+// Publish records an event outside of any transaction.
+func (o *Outbox) Publish(ctx context.Context, event Event) error {
+	if _, err := o.pool.Exec(ctx, insertEventQuery, string(event.Kind), event.ProductID, event.Payload); err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", event.Kind, err)
+	}
+	return nil
+}
+
+// PublishTx records an event as part of the caller's transaction.
+func (o *Outbox) PublishTx(ctx context.Context, tx pgx.Tx, event Event) error {
+	if _, err := tx.Exec(ctx, insertEventQuery, string(event.Kind), event.ProductID, event.Payload); err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", event.Kind, err)
+	}
+	return nil
+}
+
+// Subscribe polls for events created after the call and passes them to handler
+// until ctx is cancelled. Events inside the skew window may be seen again after
+// a restart, so handlers must be idempotent.
+func (o *Outbox) Subscribe(ctx context.Context, interval time.Duration, handler Handler) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	cursor := time.Now()
+	seen := make(map[int64]time.Time)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastPurge := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		events, err := o.since(ctx, cursor.Add(-o.skew))
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("failed to poll product events", "error", err)
+			}
+			continue
+		}
+
+		for _, event := range events {
+			if _, ok := seen[event.ID]; ok {
+				continue
+			}
+			seen[event.ID] = event.CreatedAt
+			if event.CreatedAt.After(cursor) {
+				cursor = event.CreatedAt
+			}
+			handler(event)
+		}
+
+		// Forget ids that have fallen out of the skew window.
+		for id, createdAt := range seen {
+			if createdAt.Before(cursor.Add(-o.skew)) {
+				delete(seen, id)
+			}
+		}
+
+		if time.Since(lastPurge) > time.Hour {
+			lastPurge = time.Now()
+			if err := o.purge(ctx); err != nil {
+				slog.Warn("failed to purge product events", "error", err)
+			}
+		}
+	}
+}
+
+// eventPageSize bounds how many events one query of a poll reads.
+const eventPageSize = 1000
+
+// since returns every event created after after. Events are read in pages
+// keyed by (created_at, id) until a page comes back short, so a burst larger
+// than a page inside the skew window cannot stall the cursor.
+func (o *Outbox) since(ctx context.Context, after time.Time) ([]Event, error) {
+	var (
+		events []Event
+		lastAt = after
+		lastID int64
+	)
+	for {
+		page, err := o.page(ctx, lastAt, lastID)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if len(page) < eventPageSize {
+			return events, nil
+		}
+		last := page[len(page)-1]
+		lastAt, lastID = last.CreatedAt, last.ID
+	}
+}
+
+// page returns up to eventPageSize events ordered after (afterAt, afterID).
+func (o *Outbox) page(ctx context.Context, afterAt time.Time, afterID int64) ([]Event, error) {
+	query := `
+	SELECT id, kind, product_id, payload, created_at
+	FROM product_events
+	WHERE (created_at, id) > ($1, $2)
+	ORDER BY created_at ASC, id ASC
+	LIMIT $3
+	`
+	rows, err := o.pool.Query(ctx, query, afterAt, afterID, eventPageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var (
+			event Event
+			kind  string
+		)
+		if err := rows.Scan(&event.ID, &kind, &event.ProductID, &event.Payload, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.Kind = Kind(kind)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (o *Outbox) purge(ctx context.Context) error {
+	_, err := o.pool.Exec(ctx, `DELETE FROM product_events WHERE created_at < $1`, time.Now().Add(-o.retention))
+	return err
+}
@@ -0,0 +1,58 @@
+// Package gtin validates GS1 Global Trade Item Numbers: the GTIN-8, UPC-A
+// (GTIN-12), EAN-13 (GTIN-13) and GTIN-14 barcodes printed on products.
+package gtin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalid is returned for codes that are not a valid GTIN.
+var ErrInvalid = errors.New("invalid GTIN")
+
+// Length is the length of the canonical form returned by Normalize.
+const Length = 14
+
+// Normalize validates code and returns it as a 14 digit GTIN, zero padded
+// on the left, which is the form GS1 recommends storing. Spaces and hyphens
+// are ignored, so "4006381-333931" and "04006381333931" are the same code.
+func Normalize(code string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, code)
+
+	switch len(digits) {
+	case 8, 12, 13, 14:
+	default:
+		return "", fmt.Errorf("%w: must have 8, 12, 13 or 14 digits", ErrInvalid)
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("%w: must only contain digits", ErrInvalid)
+		}
+	}
+
+	padded := strings.Repeat("0", Length-len(digits)) + digits
+	if CheckDigit(padded[:Length-1]) != padded[Length-1] {
+		return "", fmt.Errorf("%w: wrong check digit", ErrInvalid)
+	}
+	return padded, nil
+}
+
+// CheckDigit returns the GS1 mod 10 check digit of the digits preceding it.
+// Weights alternate 3 and 1 starting with 3 from the rightmost digit.
+func CheckDigit(digits string) byte {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
@@ -0,0 +1,67 @@
+package gtin
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		want    string
+		wantErr bool
+	}{
+		{"EAN-13", "4006381333931", "04006381333931", false},
+		{"EAN-13 with hyphen", "4006381-333931", "04006381333931", false},
+		{"EAN-13 with spaces", "5 901234 123457", "05901234123457", false},
+		{"UPC-A", "036000291452", "00036000291452", false},
+		{"GTIN-8", "96385074", "00000096385074", false},
+		{"GTIN-14", "10012345678902", "10012345678902", false},
+		{"already padded", "04006381333931", "04006381333931", false},
+		{"wrong check digit", "4006381333932", "", true},
+		{"letters", "40063813339A1", "", true},
+		{"too short", "1234567", "", true},
+		{"eleven digits", "12345678901", "", true},
+		{"too long", "123456789012345", "", true},
+		{"empty", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.code)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalid) {
+					t.Fatalf("Normalize(%q) error = %v, want ErrInvalid", tt.code, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Normalize(%q): %v", tt.code, err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   byte
+	}{
+		{"400638133393", '1'},
+		{"03600029145", '2'},
+		{"9638507", '4'},
+		{"1001234567890", '2'},
+		{"590123412345", '7'},
+		// Leading zeros do not change the check digit.
+		{"000000009638507", '4'},
+		{"", '0'},
+	}
+	for _, tt := range tests {
+		if got := CheckDigit(tt.digits); got != tt.want {
+			t.Errorf("CheckDigit(%q) = %c, want %c", tt.digits, got, tt.want)
+		}
+	}
+}
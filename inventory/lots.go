@@ -0,0 +1,320 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidLot is returned when an adjustment lacks the lot a perishable
+// product needs, or names a lot for a product that does not track lots.
+var ErrInvalidLot = errors.New("invalid lot")
+
+// availableExpr is the quantity of the inventory_levels row aliased l that
+// can be sold: stock that is neither reserved nor in an expired lot. Stock
+// not covered by any lot never expires.
+const availableExpr = `GREATEST(l.on_hand - l.reserved - COALESCE((
+	SELECT sum(s.quantity) FROM stock_lots AS s
+	WHERE s.product_id = l.product_id AND s.variant_id = l.variant_id AND s.warehouse_id = l.warehouse_id
+	AND s.best_before <= now()
+), 0), 0)`
+
+// Lot is a batch of a perishable product, or of its variant VariantID,
+// received together.
+type Lot struct {
+	ID          int64
+	ProductID   int64
+	VariantID   int64
+	WarehouseID string
+	Code        string
+	Quantity    int64
+	ReceivedAt  time.Time
+	BestBefore  time.Time
+	Expired     bool
+}
+
+const lotColumns = `id, product_id, variant_id, warehouse_id, lot_code, quantity, received_at, best_before, best_before <= now()`
+
+func scanLot(row pgx.CollectableRow) (Lot, error) {
+	var lot Lot
+	err := row.Scan(&lot.ID, &lot.ProductID, &lot.VariantID, &lot.WarehouseID, &lot.Code, &lot.Quantity, &lot.ReceivedAt, &lot.BestBefore, &lot.Expired)
+	return lot, err
+}
+
+// isPerishable reports whether a product tracks lots.
+func isPerishable(ctx context.Context, tx pgx.Tx, productID int64) (bool, error) {
+	var state string
+	if err := tx.QueryRow(ctx, `SELECT product_state FROM products WHERE id = $1`, productID).Scan(&state); err != nil {
+		return false, fmt.Errorf("failed to read product state: %w", err)
+	}
+	return state == "PERISHABLE", nil
+}
+
+// addToLot adds quantity to a lot, creating it on first receipt. Receiving
+// more of an existing lot keeps its original dates.
+func addToLot(ctx context.Context, tx pgx.Tx, productID, variantID int64, warehouseID string, lot Lot, quantity int64) error {
+	if lot.Code == "" || lot.BestBefore.IsZero() {
+		return fmt.Errorf("%w: lot_code and best_before are required to add stock of a perishable product", ErrInvalidLot)
+	}
+	receivedAt := lot.ReceivedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
+
+	_, err := tx.Exec(ctx, `
+	INSERT INTO stock_lots (product_id, variant_id, warehouse_id, lot_code, quantity, received_at, best_before)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (product_id, variant_id, warehouse_id, lot_code)
+	DO UPDATE SET quantity = stock_lots.quantity + excluded.quantity`,
+		productID, variantID, warehouseID, lot.Code, quantity, receivedAt, lot.BestBefore)
+	if err != nil {
+		return fmt.Errorf("failed to add to lot: %w", err)
+	}
+	return nil
+}
+
+// consumeLots takes quantity out of the lots of a product or variant in a
+// warehouse, first-expiry-first-out, or out of the lot named code only.
+// Whatever the lots cannot cover comes from stock not covered by any lot. With
+// expiredFirst, expired lots are written off before the others; without it
+// they are used last, after untracked stock, so that stock held by a
+// reservation can still be sold after its lot expired. The caller updates
+// on_hand.
+func consumeLots(ctx context.Context, tx pgx.Tx, productID, variantID int64, warehouseID string, quantity int64, code string, expiredFirst bool) error {
+	selection := lotsAll
+	if !expiredFirst {
+		selection = lotsFresh
+	}
+	remaining, err := takeFromLots(ctx, tx, productID, variantID, warehouseID, quantity, code, selection)
+	if err != nil {
+		return err
+	}
+	if remaining == 0 {
+		return nil
+	}
+
+	var untracked int64
+	if code == "" {
+		err = tx.QueryRow(ctx, `
+		SELECT l.on_hand - COALESCE((
+			SELECT sum(s.quantity) FROM stock_lots AS s
+			WHERE s.product_id = l.product_id AND s.variant_id = l.variant_id AND s.warehouse_id = l.warehouse_id
+		), 0)
+		FROM inventory_levels AS l
+		WHERE l.product_id = $1 AND l.variant_id = $2 AND l.warehouse_id = $3`, productID, variantID, warehouseID).Scan(&untracked)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to read stock level: %w", err)
+		}
+		// on_hand is not reduced until the caller updates it, so what was
+		// just taken from lots is not untracked stock.
+		untracked = max(untracked-(quantity-remaining), 0)
+		if untracked >= remaining {
+			return nil
+		}
+		remaining -= untracked
+	}
+	if !expiredFirst {
+		if remaining, err = takeFromLots(ctx, tx, productID, variantID, warehouseID, remaining, code, lotsExpired); err != nil {
+			return err
+		}
+		if remaining == 0 {
+			return nil
+		}
+	}
+	if code != "" {
+		return fmt.Errorf("%w: lot %s is %d short", ErrInsufficientStock, code, remaining)
+	}
+	return fmt.Errorf("%w: product %d is %d short in warehouse %s", ErrInsufficientStock, productID, remaining, warehouseID)
+}
+
+// lotSelection narrows the lots takeFromLots consumes by their best-before date.
+type lotSelection int
+
+const (
+	lotsAll lotSelection = iota
+	lotsFresh
+	lotsExpired
+)
+
+// takeFromLots takes up to quantity out of the selected lots,
+// first-expiry-first-out, and returns what they could not cover.
+func takeFromLots(ctx context.Context, tx pgx.Tx, productID, variantID int64, warehouseID string, quantity int64, code string, selection lotSelection) (int64, error) {
+	query := `
+	SELECT id, quantity FROM stock_lots
+	WHERE product_id = $1 AND variant_id = $2 AND warehouse_id = $3 AND quantity > 0`
+	args := []interface{}{productID, variantID, warehouseID}
+	if code != "" {
+		query += ` AND lot_code = $4`
+		args = append(args, code)
+	}
+	switch selection {
+	case lotsFresh:
+		query += ` AND best_before > now()`
+	case lotsExpired:
+		query += ` AND best_before <= now()`
+	}
+	query += ` ORDER BY best_before, received_at, id FOR UPDATE`
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read lots: %w", err)
+	}
+	type lotQuantity struct{ id, quantity int64 }
+	lots, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (lotQuantity, error) {
+		var lot lotQuantity
+		err := row.Scan(&lot.id, &lot.quantity)
+		return lot, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read lots: %w", err)
+	}
+
+	remaining := quantity
+	for _, lot := range lots {
+		if remaining == 0 {
+			break
+		}
+		take := min(lot.quantity, remaining)
+		if _, err := tx.Exec(ctx, `UPDATE stock_lots SET quantity = quantity - $2 WHERE id = $1`, lot.id, take); err != nil {
+			return 0, fmt.Errorf("failed to consume lot: %w", err)
+		}
+		remaining -= take
+	}
+	return remaining, nil
+}
+
+// Lots returns the lots of a product that still hold stock, earliest
+// best-before first.
+func (s *Store) Lots(ctx context.Context, productID int64) ([]Lot, error) {
+	rows, err := s.pool.Query(ctx, `
+	SELECT `+lotColumns+`
+	FROM stock_lots
+	WHERE product_id = $1 AND quantity > 0
+	ORDER BY best_before, variant_id, warehouse_id, id`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lots: %w", err)
+	}
+	lots, err := pgx.CollectRows(rows, scanLot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lots: %w", err)
+	}
+	return lots, nil
+}
+
+// LotFilter narrows ExpiringLots.
+type LotFilter struct {
+	Within      time.Duration
+	ProductID   int64
+	WarehouseID string
+	Limit       int
+	Offset      int
+}
+
+// ExpiringLots returns the lots with stock left whose best-before date is
+// within filter.Within from now, including expired ones, earliest first.
+func (s *Store) ExpiringLots(ctx context.Context, filter LotFilter) ([]Lot, error) {
+	query := `
+	SELECT ` + lotColumns + `
+	FROM stock_lots
+	WHERE quantity > 0 AND best_before <= now() + $1::INT8 * INTERVAL '1 second'`
+	args := []interface{}{int64(filter.Within / time.Second)}
+	if filter.ProductID != 0 {
+		args = append(args, filter.ProductID)
+		query += fmt.Sprintf(" AND product_id = $%d", len(args))
+	}
+	if filter.WarehouseID != "" {
+		args = append(args, filter.WarehouseID)
+		query += fmt.Sprintf(" AND warehouse_id = $%d", len(args))
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY best_before, id LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lots: %w", err)
+	}
+	lots, err := pgx.CollectRows(rows, scanLot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lots: %w", err)
+	}
+	return lots, nil
+}
+
+// ExpireLots marks lots whose best-before date passed and re-derives the
+// status of their products, returning the products whose status changed or
+// whose variants lost stock.
+// Lots are claimed with a single UPDATE, so concurrent replicas never handle
+// the same lot twice.
+func (s *Store) ExpireLots(ctx context.Context) ([]int64, error) {
+	rows, err := s.pool.Query(ctx, `
+	UPDATE stock_lots SET expired_at = now()
+	WHERE expired_at IS NULL AND best_before <= now()
+	RETURNING product_id, variant_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire lots: %w", err)
+	}
+	type expiredLot struct{ productID, variantID int64 }
+	expired, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (expiredLot, error) {
+		var lot expiredLot
+		err := row.Scan(&lot.productID, &lot.variantID)
+		return lot, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire lots: %w", err)
+	}
+
+	var productIDs []int64
+	variantsChanged := make(map[int64]bool)
+	for _, lot := range expired {
+		if _, seen := variantsChanged[lot.productID]; !seen {
+			productIDs = append(productIDs, lot.productID)
+		}
+		variantsChanged[lot.productID] = variantsChanged[lot.productID] || lot.variantID != 0
+	}
+
+	var changed []int64
+	for _, productID := range productIDs {
+		stock, err := s.SyncStatus(ctx, productID)
+		if errors.Is(err, ErrProductNotFound) {
+			continue
+		}
+		if err != nil {
+			return changed, err
+		}
+		if stock.StatusChanged || variantsChanged[productID] {
+			changed = append(changed, productID)
+		}
+	}
+	return changed, nil
+}
+
+// WatchExpiry runs ExpireLots every interval until ctx is cancelled and calls
+// onChange for every product it changed.
+func (s *Store) WatchExpiry(ctx context.Context, interval time.Duration, onChange func(productID int64)) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := s.ExpireLots(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("failed to expire lots", "error", err)
+		}
+		for _, productID := range changed {
+			slog.Info("product stock changed after lots expired", "product_id", productID)
+			onChange(productID)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+)
+
+var (
+	// ErrReservationNotFound is returned for unknown reservation ids.
+	ErrReservationNotFound = errors.New("reservation not found")
+	// ErrReservationClosed is returned when committing or releasing a
+	// reservation that is no longer pending.
+	ErrReservationClosed = errors.New("reservation is no longer pending")
+	// ErrReservationExpired is returned when committing a reservation whose
+	// TTL has passed.
+	ErrReservationExpired = errors.New("reservation has expired")
+)
+
+// Reservation statuses, stored by name.
+const (
+	ReservationPending   = "RESERVATION_PENDING"
+	ReservationCommitted = "RESERVATION_COMMITTED"
+	ReservationReleased  = "RESERVATION_RELEASED"
+	ReservationExpired   = "RESERVATION_EXPIRED"
+)
+
+// soldReason is recorded in stock_movements when a reservation is committed.
+const soldReason = "STOCK_SOLD"
+
+// ReservationItem is a quantity of a product, or of its variant VariantID.
+// In a request WarehouseID may be empty to reserve from any warehouse.
+type ReservationItem struct {
+	ProductID   int64
+	VariantID   int64
+	WarehouseID string
+	Quantity    int64
+}
+
+// Reservation holds stock for a checkout until it is committed, released or
+// expires.
+type Reservation struct {
+	ID        int64
+	Status    string
+	Items     []ReservationItem
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	// ChangedProducts lists the products whose status or variant stock the
+	// operation changed.
+	ChangedProducts []int64
+}
+
+// Reserve holds every item or none. Items without a warehouse are taken from
+// the warehouses with the most available stock first. Products are locked in
+// id order, so concurrent reservations over the same products queue behind
+// each other instead of deadlocking or overselling.
+func (s *Store) Reserve(ctx context.Context, items []ReservationItem, ttl time.Duration) (Reservation, error) {
+	requested := mergeItems(items)
+
+	var reservation Reservation
+	err := database.ExecuteTx(ctx, s.pool, func(tx pgx.Tx) error {
+		reservation = Reservation{Status: ReservationPending}
+		err := tx.QueryRow(ctx, `
+		INSERT INTO reservations (status, expires_at)
+		VALUES ($1, now() + $2::INT8 * INTERVAL '1 second')
+		RETURNING id, expires_at, created_at`, ReservationPending, int64(ttl/time.Second)).Scan(&reservation.ID, &reservation.ExpiresAt, &reservation.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create reservation: %w", err)
+		}
+
+		statuses := make(map[int64]string)
+		for _, item := range requested {
+			if _, locked := statuses[item.ProductID]; !locked {
+				if statuses[item.ProductID], err = lockProduct(ctx, tx, item.ProductID); err != nil {
+					return err
+				}
+			}
+			if err := checkVariant(ctx, tx, item.ProductID, item.VariantID); err != nil {
+				return err
+			}
+		}
+
+		for _, item := range requested {
+			allocated, err := allocate(ctx, tx, item)
+			if err != nil {
+				return err
+			}
+			for _, allocation := range allocated {
+				_, err := tx.Exec(ctx, `
+				UPDATE inventory_levels SET reserved = reserved + $4, updated_at = now()
+				WHERE product_id = $1 AND variant_id = $2 AND warehouse_id = $3`, allocation.ProductID, allocation.VariantID, allocation.WarehouseID, allocation.Quantity)
+				if err != nil {
+					return fmt.Errorf("failed to reserve stock: %w", err)
+				}
+				_, err = tx.Exec(ctx, `
+				UPSERT INTO reservation_items (reservation_id, product_id, variant_id, warehouse_id, quantity)
+				VALUES ($1, $2, $3, $4, $5 + COALESCE((
+					SELECT quantity FROM reservation_items
+					WHERE reservation_id = $1 AND product_id = $2 AND variant_id = $3 AND warehouse_id = $4
+				), 0))`, reservation.ID, allocation.ProductID, allocation.VariantID, allocation.WarehouseID, allocation.Quantity)
+				if err != nil {
+					return fmt.Errorf("failed to record reservation item: %w", err)
+				}
+				reservation.Items = append(reservation.Items, allocation)
+			}
+		}
+
+		return deriveStatuses(ctx, tx, statuses, &reservation)
+	})
+	return reservation, err
+}
+
+// deriveStatuses derives the status of every product in statuses, which maps
+// locked products to their status, and notes the ones that changed. Products
+// with variants among the reservation items always changed, since variants
+// carry their stock.
+func deriveStatuses(ctx context.Context, tx pgx.Tx, statuses map[int64]string, reservation *Reservation) error {
+	variantsChanged := make(map[int64]bool)
+	for _, item := range reservation.Items {
+		if item.VariantID != 0 {
+			variantsChanged[item.ProductID] = true
+		}
+	}
+	for _, productID := range sortedKeys(statuses) {
+		stock, err := deriveStatus(ctx, tx, productID, statuses[productID])
+		if err != nil {
+			return err
+		}
+		if stock.StatusChanged || variantsChanged[productID] {
+			reservation.ChangedProducts = append(reservation.ChangedProducts, productID)
+		}
+	}
+	return nil
+}
+
+// Commit removes the reserved stock from the warehouses for good.
+func (s *Store) Commit(ctx context.Context, id int64) (Reservation, error) {
+	return s.close(ctx, id, ReservationCommitted)
+}
+
+// Release returns the reserved stock to available.
+func (s *Store) Release(ctx context.Context, id int64) (Reservation, error) {
+	return s.close(ctx, id, ReservationReleased)
+}
+
+// ReleaseExpired releases up to limit pending reservations whose TTL has
+// passed, each in its own transaction, and returns them.
+func (s *Store) ReleaseExpired(ctx context.Context, limit int) ([]Reservation, error) {
+	rows, err := s.pool.Query(ctx, `
+	SELECT id FROM reservations
+	WHERE status = $1 AND expires_at <= now()
+	ORDER BY expires_at
+	LIMIT $2`, ReservationPending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find expired reservations: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, fmt.Errorf("failed to find expired reservations: %w", err)
+	}
+
+	var released []Reservation
+	for _, id := range ids {
+		reservation, err := s.close(ctx, id, ReservationExpired)
+		if errors.Is(err, ErrReservationClosed) {
+			// Committed, released or swept by another replica meanwhile.
+			continue
+		}
+		if err != nil {
+			return released, err
+		}
+		released = append(released, reservation)
+	}
+	return released, nil
+}
+
+// Sweep releases expired reservations every interval until ctx is cancelled.
+// onRelease is called for every reservation released.
+func (s *Store) Sweep(ctx context.Context, interval time.Duration, onRelease func(Reservation)) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		released, err := s.ReleaseExpired(ctx, 100)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("failed to release expired reservations", "error", err)
+		}
+		for _, reservation := range released {
+			slog.Info("reservation expired", "reservation_id", reservation.ID)
+			onRelease(reservation)
+		}
+	}
+}
+
+// close moves a pending reservation to status and settles its items:
+// committed stock leaves on_hand, anything else only stops being reserved.
+func (s *Store) close(ctx context.Context, id int64, status string) (Reservation, error) {
+	var reservation Reservation
+	err := database.ExecuteTx(ctx, s.pool, func(tx pgx.Tx) error {
+		reservation = Reservation{ID: id}
+		var expired bool
+		err := tx.QueryRow(ctx, `
+		SELECT status, expires_at, created_at, expires_at <= now()
+		FROM reservations WHERE id = $1
+		FOR UPDATE`, id).Scan(&reservation.Status, &reservation.ExpiresAt, &reservation.CreatedAt, &expired)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrReservationNotFound
+			}
+			return fmt.Errorf("failed to lock reservation: %w", err)
+		}
+		if reservation.Status != ReservationPending {
+			return fmt.Errorf("%w: %s", ErrReservationClosed, reservation.Status)
+		}
+		if status == ReservationCommitted && expired {
+			return ErrReservationExpired
+		}
+
+		rows, err := tx.Query(ctx, `
+		SELECT product_id, variant_id, warehouse_id, quantity
+		FROM reservation_items
+		WHERE reservation_id = $1
+		ORDER BY product_id, variant_id, warehouse_id`, id)
+		if err != nil {
+			return fmt.Errorf("failed to read reservation items: %w", err)
+		}
+		reservation.Items, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (ReservationItem, error) {
+			var item ReservationItem
+			err := row.Scan(&item.ProductID, &item.VariantID, &item.WarehouseID, &item.Quantity)
+			return item, err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read reservation items: %w", err)
+		}
+
+		statuses := make(map[int64]string)
+		for _, item := range reservation.Items {
+			if _, locked := statuses[item.ProductID]; !locked {
+				if statuses[item.ProductID], err = lockProduct(ctx, tx, item.ProductID); err != nil {
+					return err
+				}
+			}
+
+			if status == ReservationCommitted {
+				// Sold stock leaves fresh lots first-expiry-first-out; a lot
+				// that expired while the stock was reserved is used last.
+				if err := consumeLots(ctx, tx, item.ProductID, item.VariantID, item.WarehouseID, item.Quantity, "", false); err != nil {
+					return err
+				}
+				var onHand int64
+				err = tx.QueryRow(ctx, `
+				UPDATE inventory_levels
+				SET on_hand = on_hand - $4, reserved = reserved - $4, updated_at = now()
+				WHERE product_id = $1 AND variant_id = $2 AND warehouse_id = $3
+				RETURNING on_hand`, item.ProductID, item.VariantID, item.WarehouseID, item.Quantity).Scan(&onHand)
+				if err != nil {
+					return fmt.Errorf("failed to commit reserved stock: %w", err)
+				}
+				_, err = tx.Exec(ctx, `
+				INSERT INTO stock_movements (product_id, variant_id, warehouse_id, delta, on_hand_after, reason, note)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`, item.ProductID, item.VariantID, item.WarehouseID, -item.Quantity, onHand, soldReason, fmt.Sprintf("reservation %d", id))
+				if err != nil {
+					return fmt.Errorf("failed to record stock movement: %w", err)
+				}
+			} else {
+				_, err = tx.Exec(ctx, `
+				UPDATE inventory_levels SET reserved = reserved - $4, updated_at = now()
+				WHERE product_id = $1 AND variant_id = $2 AND warehouse_id = $3`, item.ProductID, item.VariantID, item.WarehouseID, item.Quantity)
+				if err != nil {
+					return fmt.Errorf("failed to release reserved stock: %w", err)
+				}
+			}
+		}
+
+		if err := deriveStatuses(ctx, tx, statuses, &reservation); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE reservations SET status = $2, updated_at = now() WHERE id = $1`, id, status); err != nil {
+			return fmt.Errorf("failed to update reservation: %w", err)
+		}
+		reservation.Status = status
+		return nil
+	})
+	return reservation, err
+}
+
+// allocate splits item over the warehouses holding the product or variant,
+// locking the levels it reads.
+func allocate(ctx context.Context, tx pgx.Tx, item ReservationItem) ([]ReservationItem, error) {
+	query := `
+	SELECT l.warehouse_id, ` + availableExpr + ` AS available
+	FROM inventory_levels AS l
+	WHERE l.product_id = $1 AND l.variant_id = $2 AND l.on_hand > l.reserved`
+	args := []interface{}{item.ProductID, item.VariantID}
+	if item.WarehouseID != "" {
+		query += ` AND l.warehouse_id = $3`
+		args = append(args, item.WarehouseID)
+	}
+	query += ` ORDER BY available DESC, l.warehouse_id FOR UPDATE OF l`
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stock levels: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		allocated []ReservationItem
+		remaining = item.Quantity
+	)
+	for rows.Next() && remaining > 0 {
+		var (
+			warehouseID string
+			available   int64
+		)
+		if err := rows.Scan(&warehouseID, &available); err != nil {
+			return nil, fmt.Errorf("failed to scan stock level: %w", err)
+		}
+		if available <= 0 {
+			// Everything left in this warehouse has expired.
+			continue
+		}
+		quantity := min(available, remaining)
+		allocated = append(allocated, ReservationItem{ProductID: item.ProductID, VariantID: item.VariantID, WarehouseID: warehouseID, Quantity: quantity})
+		remaining -= quantity
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stock levels: %w", err)
+	}
+	if remaining > 0 {
+		if item.VariantID != 0 {
+			return nil, fmt.Errorf("%w: variant %d of product %d is %d short", ErrInsufficientStock, item.VariantID, item.ProductID, remaining)
+		}
+		return nil, fmt.Errorf("%w: product %d is %d short", ErrInsufficientStock, item.ProductID, remaining)
+	}
+	return allocated, nil
+}
+
+// mergeItems sums the quantities of duplicate items and orders them by
+// product id, which is the order Reserve locks products in.
+func mergeItems(items []ReservationItem) []ReservationItem {
+	type key struct {
+		productID   int64
+		variantID   int64
+		warehouseID string
+	}
+	quantities := make(map[key]int64)
+	var keys []key
+	for _, item := range items {
+		k := key{item.ProductID, item.VariantID, item.WarehouseID}
+		if _, ok := quantities[k]; !ok {
+			keys = append(keys, k)
+		}
+		quantities[k] += item.Quantity
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].productID != keys[j].productID {
+			return keys[i].productID < keys[j].productID
+		}
+		if keys[i].variantID != keys[j].variantID {
+			return keys[i].variantID < keys[j].variantID
+		}
+		return keys[i].warehouseID < keys[j].warehouseID
+	})
+
+	merged := make([]ReservationItem, 0, len(keys))
+	for _, k := range keys {
+		merged = append(merged, ReservationItem{ProductID: k.productID, VariantID: k.variantID, WarehouseID: k.warehouseID, Quantity: quantities[k]})
+	}
+	return merged
+}
+
+func sortedKeys(m map[int64]string) []int64 {
+	keys := make([]int64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
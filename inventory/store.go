@@ -0,0 +1,333 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+)
+
+var (
+	// ErrProductNotFound is returned for stock operations on unknown products.
+	ErrProductNotFound = errors.New("product not found")
+	// ErrVariantNotFound is returned for stock operations on variants that
+	// do not exist or belong to another product.
+	ErrVariantNotFound = errors.New("variant not found")
+	// ErrInsufficientStock is returned when an operation needs more stock
+	// than is available.
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrStockReserved is returned when removing a variant whose stock is
+	// held by pending reservations.
+	ErrStockReserved = errors.New("stock is reserved")
+)
+
+// Product statuses derived from stock. DISCONTINUED is only ever set by hand
+// and is never changed by inventory.
+const (
+	StatusInStock      = "IN_STOCK"
+	StatusOutOfStock   = "OUT_OF_STOCK"
+	StatusDiscontinued = "DISCONTINUED"
+)
+
+// Level is the stock of a product, or of one of its variants, in one warehouse.
+type Level struct {
+	// VariantID is 0 for stock of the product itself.
+	VariantID   int64
+	WarehouseID string
+	OnHand      int64
+	Reserved    int64
+	Available   int64
+	UpdatedAt   time.Time
+}
+
+// Adjustment changes the stock of a product, or of the variant VariantID of
+// it, in a warehouse by Delta.
+type Adjustment struct {
+	ProductID   int64
+	VariantID   int64
+	WarehouseID string
+	Delta       int64
+	Reason      string
+	Note        string
+	// Lot receives added stock of perishable products and, when its Code
+	// is set, is the lot removed stock is taken from.
+	Lot *Lot
+}
+
+// Stock is the stock of a product after an operation.
+type Stock struct {
+	Levels    []Level
+	Lots      []Lot
+	Available int64
+	Status    string
+	// StatusChanged reports whether the operation changed the product status.
+	StatusChanged bool
+}
+
+// Store keeps per-warehouse stock in the inventory_levels table and records
+// every adjustment in stock_movements. Variants of a product have stock of
+// their own, which counts towards the status of the product.
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+// NewStore returns a Store.
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+// Adjust applies adj and derives the product status from the resulting
+// available quantity, in one transaction. Stock.Levels holds only the
+// adjusted warehouse.
+func (s *Store) Adjust(ctx context.Context, adj Adjustment) (Stock, error) {
+	var stock Stock
+	err := database.ExecuteTx(ctx, s.pool, func(tx pgx.Tx) error {
+		status, err := lockProduct(ctx, tx, adj.ProductID)
+		if err != nil {
+			return err
+		}
+		if err := checkVariant(ctx, tx, adj.ProductID, adj.VariantID); err != nil {
+			return err
+		}
+
+		var onHand, reserved int64
+		err = tx.QueryRow(ctx, `
+		SELECT on_hand, reserved FROM inventory_levels
+		WHERE product_id = $1 AND variant_id = $2 AND warehouse_id = $3
+		FOR UPDATE`, adj.ProductID, adj.VariantID, adj.WarehouseID).Scan(&onHand, &reserved)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to read stock level: %w", err)
+		}
+		// Reserved stock cannot be removed until its reservation ends.
+		if onHand+adj.Delta < reserved {
+			return fmt.Errorf("%w: %d available in warehouse %s", ErrInsufficientStock, onHand-reserved, adj.WarehouseID)
+		}
+
+		perishable, err := isPerishable(ctx, tx, adj.ProductID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case adj.Lot != nil && !perishable:
+			return fmt.Errorf("%w: lots are only tracked for perishable products", ErrInvalidLot)
+		case adj.Delta > 0 && perishable:
+			if adj.Lot == nil {
+				return fmt.Errorf("%w: a lot is required to add stock of a perishable product", ErrInvalidLot)
+			}
+			if err := addToLot(ctx, tx, adj.ProductID, adj.VariantID, adj.WarehouseID, *adj.Lot, adj.Delta); err != nil {
+				return err
+			}
+		case adj.Delta < 0 && perishable:
+			var code string
+			if adj.Lot != nil {
+				code = adj.Lot.Code
+			}
+			// Removals write off expired lots first.
+			if err := consumeLots(ctx, tx, adj.ProductID, adj.VariantID, adj.WarehouseID, -adj.Delta, code, true); err != nil {
+				return err
+			}
+		}
+
+		level := Level{VariantID: adj.VariantID, WarehouseID: adj.WarehouseID}
+		err = tx.QueryRow(ctx, `
+		UPSERT INTO inventory_levels (product_id, variant_id, warehouse_id, on_hand, updated_at)
+		VALUES ($1, $2, $3, $4, now())
+		RETURNING on_hand, reserved, updated_at`, adj.ProductID, adj.VariantID, adj.WarehouseID, onHand+adj.Delta).Scan(&level.OnHand, &level.Reserved, &level.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to update stock level: %w", err)
+		}
+		err = tx.QueryRow(ctx, `
+		SELECT `+availableExpr+`
+		FROM inventory_levels AS l
+		WHERE l.product_id = $1 AND l.variant_id = $2 AND l.warehouse_id = $3`, adj.ProductID, adj.VariantID, adj.WarehouseID).Scan(&level.Available)
+		if err != nil {
+			return fmt.Errorf("failed to read available stock: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, `
+		INSERT INTO stock_movements (product_id, variant_id, warehouse_id, delta, on_hand_after, reason, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`, adj.ProductID, adj.VariantID, adj.WarehouseID, adj.Delta, level.OnHand, adj.Reason, adj.Note)
+		if err != nil {
+			return fmt.Errorf("failed to record stock movement: %w", err)
+		}
+
+		stock, err = deriveStatus(ctx, tx, adj.ProductID, status)
+		if err != nil {
+			return err
+		}
+		stock.Levels = []Level{level}
+		return nil
+	})
+	return stock, err
+}
+
+// Get returns the stock of a product and its variants in every warehouse.
+func (s *Store) Get(ctx context.Context, productID int64) (Stock, error) {
+	var stock Stock
+	err := s.pool.QueryRow(ctx, `SELECT product_status FROM products WHERE id = $1`, productID).Scan(&stock.Status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Stock{}, ErrProductNotFound
+		}
+		return Stock{}, fmt.Errorf("failed to read product: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, `
+	SELECT l.variant_id, l.warehouse_id, l.on_hand, l.reserved, `+availableExpr+`, l.updated_at
+	FROM inventory_levels AS l
+	WHERE l.product_id = $1
+	ORDER BY l.variant_id, l.warehouse_id`, productID)
+	if err != nil {
+		return Stock{}, fmt.Errorf("failed to read stock levels: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var level Level
+		if err := rows.Scan(&level.VariantID, &level.WarehouseID, &level.OnHand, &level.Reserved, &level.Available, &level.UpdatedAt); err != nil {
+			return Stock{}, fmt.Errorf("failed to scan stock level: %w", err)
+		}
+		stock.Available += level.Available
+		stock.Levels = append(stock.Levels, level)
+	}
+	if err := rows.Err(); err != nil {
+		return Stock{}, fmt.Errorf("failed to read stock levels: %w", err)
+	}
+
+	stock.Lots, err = s.Lots(ctx, productID)
+	return stock, err
+}
+
+// VariantsAvailable returns the available quantity over all warehouses of
+// each of the given variants that has stock levels.
+func (s *Store) VariantsAvailable(ctx context.Context, variantIDs []int64) (map[int64]int64, error) {
+	available := make(map[int64]int64, len(variantIDs))
+	if len(variantIDs) == 0 {
+		return available, nil
+	}
+	rows, err := s.pool.Query(ctx, `
+	SELECT l.variant_id, sum(`+availableExpr+`)::INT8
+	FROM inventory_levels AS l
+	WHERE l.variant_id = ANY($1)
+	GROUP BY l.variant_id`, variantIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read variant stock: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var variantID, quantity int64
+		if err := rows.Scan(&variantID, &quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan variant stock: %w", err)
+		}
+		available[variantID] = quantity
+	}
+	return available, rows.Err()
+}
+
+// RemoveVariant deletes the stock of a variant in the transaction removing
+// it. Variants with reserved stock cannot be removed.
+func RemoveVariant(ctx context.Context, tx pgx.Tx, productID, variantID int64) error {
+	var reserved int64
+	err := tx.QueryRow(ctx, `
+	SELECT COALESCE(sum(reserved), 0)::INT8 FROM inventory_levels
+	WHERE product_id = $1 AND variant_id = $2`, productID, variantID).Scan(&reserved)
+	if err != nil {
+		return fmt.Errorf("failed to read variant stock: %w", err)
+	}
+	if reserved > 0 {
+		return fmt.Errorf("%w: %d units of the variant are held by pending reservations", ErrStockReserved, reserved)
+	}
+	for _, table := range []string{"inventory_levels", "stock_lots"} {
+		if _, err := tx.Exec(ctx, `DELETE FROM `+table+` WHERE product_id = $1 AND variant_id = $2`, productID, variantID); err != nil {
+			return fmt.Errorf("failed to delete variant stock: %w", err)
+		}
+	}
+	return nil
+}
+
+// SyncStatus derives the status of a product from its stock. Products
+// without any stock levels are not tracked and keep their status.
+func (s *Store) SyncStatus(ctx context.Context, productID int64) (Stock, error) {
+	var stock Stock
+	err := database.ExecuteTx(ctx, s.pool, func(tx pgx.Tx) error {
+		status, err := lockProduct(ctx, tx, productID)
+		if err != nil {
+			return err
+		}
+		stock, err = deriveStatus(ctx, tx, productID, status)
+		return err
+	})
+	return stock, err
+}
+
+// lockProduct returns the status of a product and locks its row until the
+// transaction ends, serializing stock operations on the same product.
+func lockProduct(ctx context.Context, tx pgx.Tx, productID int64) (string, error) {
+	var status string
+	err := tx.QueryRow(ctx, `SELECT product_status FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrProductNotFound
+		}
+		return "", fmt.Errorf("failed to lock product: %w", err)
+	}
+	return status, nil
+}
+
+// checkVariant ensures that variantID, unless it is 0, is a variant of productID.
+func checkVariant(ctx context.Context, tx pgx.Tx, productID, variantID int64) error {
+	if variantID == 0 {
+		return nil
+	}
+	var exists bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM product_variants WHERE id = $1 AND product_id = $2)`, variantID, productID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to read variant: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("%w: product %d has no variant %d", ErrVariantNotFound, productID, variantID)
+	}
+	return nil
+}
+
+// deriveStatus sets the product to IN_STOCK or OUT_OF_STOCK when its
+// available quantity, including that of its variants, crossed zero, which
+// includes all of its lots expiring.
+func deriveStatus(ctx context.Context, tx pgx.Tx, productID int64, status string) (Stock, error) {
+	var (
+		levels    int64
+		available int64
+	)
+	err := tx.QueryRow(ctx, `
+	SELECT count(*), COALESCE(sum(`+availableExpr+`), 0)
+	FROM inventory_levels AS l
+	WHERE l.product_id = $1`, productID).Scan(&levels, &available)
+	if err != nil {
+		return Stock{}, fmt.Errorf("failed to sum stock levels: %w", err)
+	}
+
+	stock := Stock{Available: available, Status: status}
+	if levels == 0 || status == StatusDiscontinued {
+		return stock, nil
+	}
+
+	derived := StatusOutOfStock
+	if available > 0 {
+		derived = StatusInStock
+	}
+	if derived == status {
+		return stock, nil
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE products SET product_status = $2, updated_at = now() WHERE id = $1`, productID, derived); err != nil {
+		return Stock{}, fmt.Errorf("failed to update product status: %w", err)
+	}
+	stock.Status = derived
+	stock.StatusChanged = true
+	return stock, nil
+}
@@ -0,0 +1,116 @@
+// Package locales picks the locale product content is served in from what a
+// client asks for, and the chain of locales to fall back along when a
+// translation is missing.
+package locales
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/text/language"
+)
+
+// ErrUnsupported is returned for locales that are not configured.
+var ErrUnsupported = errors.New("unsupported locale")
+
+// Resolver matches requested locales against the configured ones.
+type Resolver struct {
+	defaultLocale string
+	supported     []string
+	matcher       language.Matcher
+	fallbacks     map[string][]string
+}
+
+// NewResolver returns a Resolver serving the supported locales, with
+// defaultLocale being the language the base product content is written in.
+// fallbacks lists, per locale, the locales tried before the default one.
+func NewResolver(defaultLocale string, supported []string, fallbacks map[string][]string) (*Resolver, error) {
+	def, err := language.Parse(defaultLocale)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default locale %q: %w", defaultLocale, err)
+	}
+
+	// The default locale comes first so that it is what the matcher falls
+	// back to when nothing else matches.
+	r := &Resolver{defaultLocale: def.String(), fallbacks: make(map[string][]string, len(fallbacks))}
+	tags := []language.Tag{def}
+	r.supported = append(r.supported, def.String())
+	for _, locale := range supported {
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return nil, fmt.Errorf("invalid locale %q: %w", locale, err)
+		}
+		if tag == def {
+			continue
+		}
+		tags = append(tags, tag)
+		r.supported = append(r.supported, tag.String())
+	}
+	r.matcher = language.NewMatcher(tags)
+
+	for locale, chain := range fallbacks {
+		from, err := r.Canonical(locale)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fallbacks: %w", err)
+		}
+		for _, locale := range chain {
+			to, err := r.Canonical(locale)
+			if err != nil {
+				return nil, fmt.Errorf("invalid fallbacks of %s: %w", from, err)
+			}
+			r.fallbacks[from] = append(r.fallbacks[from], to)
+		}
+	}
+	return r, nil
+}
+
+// Default returns the locale of the base product content.
+func (r *Resolver) Default() string {
+	return r.defaultLocale
+}
+
+// Canonical returns the configured spelling of locale, or ErrUnsupported.
+func (r *Resolver) Canonical(locale string) (string, error) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrUnsupported, locale)
+	}
+	for _, supported := range r.supported {
+		if supported == tag.String() {
+			return supported, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnsupported, locale)
+}
+
+// Match returns the supported locale closest to preferred, which is either a
+// single BCP 47 tag or an Accept-Language header value. Anything that does
+// not match resolves to the default locale.
+func (r *Resolver) Match(preferred string) string {
+	if preferred == "" {
+		return r.defaultLocale
+	}
+	tags, _, err := language.ParseAcceptLanguage(preferred)
+	if err != nil || len(tags) == 0 {
+		return r.defaultLocale
+	}
+	_, index, confidence := r.matcher.Match(tags...)
+	if confidence == language.No {
+		return r.defaultLocale
+	}
+	return r.supported[index]
+}
+
+// Chain returns the locales to look content up in for locale, most preferred
+// first: the locale itself, its configured fallbacks and the default locale.
+func (r *Resolver) Chain(locale string) []string {
+	chain := []string{locale}
+	seen := map[string]bool{locale: true}
+	for _, fallback := range append(r.fallbacks[locale], r.defaultLocale) {
+		if !seen[fallback] {
+			seen[fallback] = true
+			chain = append(chain, fallback)
+		}
+	}
+	return chain
+}
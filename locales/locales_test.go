@@ -0,0 +1,114 @@
+package locales
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func newTestResolver(t *testing.T) *Resolver {
+	t.Helper()
+	r, err := NewResolver("en", []string{"en", "de", "de-CH", "fr", "pt-BR"}, map[string][]string{
+		"de-CH": {"de"},
+		"pt-BR": {"fr", "pt-BR"},
+	})
+	if err != nil {
+		t.Fatalf("NewResolver: %v", err)
+	}
+	return r
+}
+
+func TestNewResolver(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultLocale string
+		supported     []string
+		fallbacks     map[string][]string
+	}{
+		{"invalid default", "not a locale", nil, nil},
+		{"invalid supported locale", "en", []string{"de", "xx-invalid-tag-!"}, nil},
+		{"fallbacks of an unsupported locale", "en", []string{"de"}, map[string][]string{"fr": {"de"}}},
+		{"fallback to an unsupported locale", "en", []string{"de"}, map[string][]string{"de": {"fr"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewResolver(tt.defaultLocale, tt.supported, tt.fallbacks); err == nil {
+				t.Fatal("NewResolver succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	r := newTestResolver(t)
+	tests := []struct {
+		locale  string
+		want    string
+		wantErr bool
+	}{
+		{"en", "en", false},
+		{"de-ch", "de-CH", false},
+		{"DE_ch", "de-CH", false},
+		{"pt-br", "pt-BR", false},
+		{"es", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := r.Canonical(tt.locale)
+		if tt.wantErr {
+			if !errors.Is(err, ErrUnsupported) {
+				t.Errorf("Canonical(%q) error = %v, want ErrUnsupported", tt.locale, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Canonical(%q) = %q, %v; want %q", tt.locale, got, err, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	r := newTestResolver(t)
+	tests := []struct {
+		name      string
+		preferred string
+		want      string
+	}{
+		{"empty", "", "en"},
+		{"exact", "de", "de"},
+		{"exact region", "de-CH", "de-CH"},
+		{"case insensitive", "DE-ch", "de-CH"},
+		{"region falls back to language", "de-AT", "de"},
+		{"regional variant of a supported region", "pt-PT", "pt-BR"},
+		{"accept-language", "es-ES, fr;q=0.9, en;q=0.5", "fr"},
+		{"accept-language weights", "en;q=0.1, de;q=0.8", "de"},
+		{"unsupported", "ja", "en"},
+		{"malformed", ";;;q=x", "en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Match(tt.preferred); got != tt.want {
+				t.Errorf("Match(%q) = %q, want %q", tt.preferred, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	r := newTestResolver(t)
+	tests := []struct {
+		locale string
+		want   []string
+	}{
+		{"en", []string{"en"}},
+		{"de", []string{"de", "en"}},
+		{"de-CH", []string{"de-CH", "de", "en"}},
+		// A locale listed among its own fallbacks appears once.
+		{"pt-BR", []string{"pt-BR", "fr", "en"}},
+	}
+	for _, tt := range tests {
+		if got := r.Chain(tt.locale); !slices.Equal(got, tt.want) {
+			t.Errorf("Chain(%q) = %q, want %q", tt.locale, got, tt.want)
+		}
+	}
+}
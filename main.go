@@ -10,14 +10,25 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"github.com/yaninyzwitty/grpc-cocroach-microservice/controller"
 	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/events"
 	"github.com/yaninyzwitty/grpc-cocroach-microservice/helpers"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/inventory"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/locales"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/media"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/money"
 	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
 	"github.com/yaninyzwitty/grpc-cocroach-microservice/pkg"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pricing"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/producttypes"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/promotions"
 	"github.com/yaninyzwitty/grpc-cocroach-microservice/sonyflake"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -71,13 +82,59 @@ func main() {
 		os.Exit(1)
 	}
 
-	// initalize memcached client
-	memcachedClient, err := database.NewMemcachedClient(cfg.Memcache.Host, cfg.Memcache.Port)
+	// initialize the configured cache driver
+	cache, breaker, cluster, err := newCache(cfg)
 	if err != nil {
-		slog.Error("failed to create memcached client", "error", err)
+		slog.Error("failed to create cache", "driver", cfg.Cache.Driver, "error", err)
 		os.Exit(1)
 	}
 
+	// count hits, misses, errors and latency per key prefix
+	cacheStats := database.NewCacheStats()
+	cache = database.NewInstrumentedCache(cache, cacheStats)
+
+	// background work lives until shutdown, unlike the startup context above
+	runCtx, stopRun := context.WithCancel(context.Background())
+	defer stopRun()
+
+	// report cache health and keep serving without it while it is down
+	healthServer := health.NewServer()
+	if breaker != nil {
+		breaker.OnStateChange(func(healthy bool) {
+			healthServer.SetServingStatus(cacheHealthService, servingStatus(healthy))
+		})
+		if err := breaker.Ping(ctx, 3); err != nil {
+			slog.Warn("cache unavailable, starting without it", "driver", cfg.Cache.Driver, "error", err)
+		}
+		healthServer.SetServingStatus(cacheHealthService, servingStatus(breaker.Healthy()))
+		go breaker.Probe(runCtx, cfg.Cache.Breaker.ProbeInterval)
+	}
+	if cluster != nil {
+		go reloadMemcachedServers(runCtx, cluster)
+	}
+
+	// exchange rates are kept in memory and reloaded periodically and on change
+	converter := newConverter(cfg.Pricing, pool)
+	if err := converter.Refresh(ctx); err != nil {
+		slog.Warn("failed to load exchange rates", "error", err)
+	}
+	go converter.Run(runCtx, cfg.Pricing.RefreshInterval)
+
+	// running promotions are evaluated in memory against every product read
+	promotionEngine := promotions.NewEngine(pool, converter)
+	if err := promotionEngine.Refresh(ctx); err != nil {
+		slog.Warn("failed to load promotions", "error", err)
+	}
+	go promotionEngine.Run(runCtx, cfg.Promotions.RefreshInterval)
+
+	// product mutations are recorded in the outbox so every replica can drop stale local entries
+	outbox := events.NewOutbox(pool)
+	go outbox.Subscribe(runCtx, cfg.Events.PollInterval, events.Chain(
+		controller.CacheInvalidator(cache),
+		controller.ExchangeRateRefresher(runCtx, converter),
+		controller.PromotionRefresher(runCtx, promotionEngine),
+	))
+
 	// initialize sonyflake
 	err = sonyflake.InitSonyFlake()
 	if err != nil {
@@ -91,12 +148,93 @@ func main() {
 		os.Exit(1)
 	}
 
-	productController := controller.NewProductController(pool, memcachedClient)
+	compression, err := database.ParseCompression(cfg.Cache.Compression)
+	if err != nil {
+		slog.Error("invalid cache compression", "error", err)
+		os.Exit(1)
+	}
+
+	// popular queries are persisted so the next start knows what to warm
+	queryStats := database.NewQueryStats(pool, cfg.Cache.Warmup.Retention)
+	go queryStats.Run(runCtx, cfg.Cache.Warmup.FlushInterval)
+
+	inventoryStore := inventory.NewStore(pool)
+	productTypes := producttypes.NewRegistry(pool)
+	localeResolver, err := locales.NewResolver(cfg.Localization.DefaultLocale, cfg.Localization.Locales, cfg.Localization.Fallbacks)
+	if err != nil {
+		slog.Error("invalid localization settings", "error", err)
+		os.Exit(1)
+	}
+	blobStore, err := newBlobStore(cfg.Media)
+	if err != nil {
+		slog.Error("failed to set up the media blob store", "error", err)
+		os.Exit(1)
+	}
+
+	if err := cfg.Duplicates.Validate(); err != nil {
+		slog.Error("invalid duplicate detection settings", "error", err)
+		os.Exit(1)
+	}
+
+	lifecycleRoles := controller.LifecycleRoles{
+		Editors:   cfg.Lifecycle.EditorRoles,
+		Approvers: cfg.Lifecycle.ApproverRoles,
+	}
+	productController := controller.NewProductController(pool, cache, compression, outbox, queryStats, converter, promotionEngine, inventoryStore, productTypes, blobStore, cfg.Media.PublicURL, localeResolver, lifecycleRoles, controller.DuplicateCheck{
+		Threshold: cfg.Duplicates.Threshold,
+		Strict:    cfg.Duplicates.Strict,
+	})
+	cacheAdminController := controller.NewCacheAdminController(pool, cache, cacheStats, productController, outbox, cfg.Cache.AdminRoles)
+	pricingController := controller.NewPricingController(pool, cache, outbox, converter, cfg.Catalog.AdminRoles)
+	promotionController := controller.NewPromotionController(pool, outbox, converter, promotionEngine, cfg.Catalog.AdminRoles)
+	productTypeController := controller.NewProductTypeController(productTypes, cfg.Catalog.AdminRoles)
+	categoryController := controller.NewCategoryController(pool, cache, outbox, cfg.Catalog.AdminRoles)
+	tagController := controller.NewTagController(pool, cache, outbox, cfg.Catalog.AdminRoles)
+	translationController := controller.NewTranslationController(pool, cache, outbox, localeResolver, lifecycleRoles)
+	mediaController := controller.NewMediaController(pool, cache, outbox, blobStore, cfg.Media.PublicURL, cfg.Media.MaxUploadBytes, cfg.Media.ThumbnailSize, cfg.Media.MaxImagePixels, lifecycleRoles)
+	inventoryController := controller.NewInventoryController(inventoryStore, cache, outbox, cfg.Inventory.ReservationTTL, cfg.Inventory.MaxReservationTTL)
+	go controller.ReleaseExpiredReservations(runCtx, inventoryStore, cache, outbox, cfg.Inventory.SweepInterval)
+	go controller.ExpireLots(runCtx, inventoryStore, cache, outbox, cfg.Inventory.LotExpiryInterval)
+	go controller.ApplyScheduledPrices(runCtx, pool, cache, outbox, cfg.Pricing.ScheduleInterval)
+	publicationLease := database.NewLease(pool, "product-publication", cfg.Lifecycle.LeaseTTL)
+	go controller.PublishScheduledProducts(runCtx, pool, cache, outbox, publicationLease, cfg.Lifecycle.ScheduleInterval)
 
 	server := grpc.NewServer()
 	reflection.Register(server) // This line enables reflection
 
 	pb.RegisterProductServiceServer(server, productController)
+	pb.RegisterCacheAdminServiceServer(server, cacheAdminController)
+	pb.RegisterPricingServiceServer(server, pricingController)
+	pb.RegisterPromotionServiceServer(server, promotionController)
+	pb.RegisterInventoryServiceServer(server, inventoryController)
+	pb.RegisterProductTypeServiceServer(server, productTypeController)
+	pb.RegisterCategoryServiceServer(server, categoryController)
+	pb.RegisterTagServiceServer(server, tagController)
+	pb.RegisterMediaServiceServer(server, mediaController)
+	pb.RegisterTranslationServiceServer(server, translationController)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	// report not ready until the cache has been warmed
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthServer.SetServingStatus(pb.ProductService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	go func() {
+		if cfg.Cache.Warmup.Enabled {
+			timeout := cfg.Cache.Warmup.Timeout
+			if timeout <= 0 {
+				timeout = time.Minute
+			}
+			warmCtx, cancelWarm := context.WithTimeout(runCtx, timeout)
+			controller.WarmUp(warmCtx, productController, queryStats, controller.WarmUpOptions{
+				Products:    cfg.Cache.Warmup.Products,
+				ListQueries: cfg.Cache.Warmup.ListQueries,
+				Pages:       cfg.Cache.Warmup.Pages,
+				Window:      cfg.Cache.Warmup.Window,
+			})
+			cancelWarm()
+		}
+		healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		healthServer.SetServingStatus(pb.ProductService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	}()
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	go func() {
@@ -105,8 +243,10 @@ func main() {
 		slog.Info("Shutting down gRPC server...")
 
 		// Gracefully stop the gRPC server
+		healthServer.Shutdown()
 		server.GracefulStop()
 		cancel()
+		stopRun()
 
 		slog.Info("gRPC server has been stopped gracefully")
 	}()
@@ -118,3 +258,129 @@ func main() {
 	}
 
 }
+
+// cacheHealthService is the health check service name reporting cache availability.
+const cacheHealthService = "cache"
+
+func servingStatus(healthy bool) healthpb.HealthCheckResponse_ServingStatus {
+	if healthy {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
+
+// newCache builds the cache selected by cache.driver. Remote drivers are
+// wrapped in a circuit breaker, which is returned so its health can be
+// reported, and get a short-lived in-process tier in front of them. The
+// memcached cluster is returned so its server list can be reloaded.
+func newCache(cfg pkg.Config) (database.CacheMethods, *database.CircuitBreaker, *database.MemcachedCluster, error) {
+	var (
+		remote  database.CacheMethods
+		cluster *database.MemcachedCluster
+	)
+
+	switch cfg.Cache.Driver {
+	case "", "memcached":
+		cluster = database.NewMemcachedCluster(memcachedNodes(cfg.Memcache), cfg.Memcache.EjectAfter, cfg.Memcache.RetryEjectedAfter)
+		remote = cluster
+	case "redis":
+		remote = database.NewRedisClient(cfg.Cache.Redis.Address, helpers.GetEnvOrDefault("REDIS_PASSWORD", ""), cfg.Cache.Redis.DB)
+	case "memory":
+		return database.NewLocalCache(cfg.Cache.Memory.Size, cfg.Cache.Memory.TTL), nil, nil, nil
+	case "none":
+		return database.NewNoopCache(), nil, nil, nil
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown cache driver %q", cfg.Cache.Driver)
+	}
+
+	breaker := database.NewCircuitBreaker(remote, cfg.Cache.Breaker.FailureThreshold)
+	local := database.NewLocalCache(cfg.Cache.Local.Size, cfg.Cache.Local.TTL)
+	return database.NewTieredCache(local, breaker), breaker, cluster, nil
+}
+
+// newBlobStore builds the blob store selected by media.driver.
+func newBlobStore(cfg pkg.Media) (media.BlobStore, error) {
+	switch cfg.Driver {
+	case "", "local":
+		dir := cfg.LocalDir
+		if dir == "" {
+			dir = "media-data"
+		}
+		return media.NewLocalStore(dir)
+	case "s3":
+		return media.NewS3Store(media.S3Config{
+			Endpoint:        cfg.S3.Endpoint,
+			Bucket:          cfg.S3.Bucket,
+			Region:          cfg.S3.Region,
+			AccessKeyID:     helpers.GetEnvOrDefault("S3_ACCESS_KEY_ID", ""),
+			SecretAccessKey: helpers.GetEnvOrDefault("S3_SECRET_ACCESS_KEY", ""),
+		})
+	default:
+		return nil, fmt.Errorf("unknown media driver %q", cfg.Driver)
+	}
+}
+
+// newConverter builds the currency converter from the pricing settings.
+func newConverter(cfg pkg.Pricing, pool *pgxpool.Pool) *pricing.Converter {
+	rules := make(map[string]pricing.RoundingRule, len(cfg.Rounding.Currencies))
+	for currency, rule := range cfg.Rounding.Currencies {
+		rules[currency] = roundingRule(rule)
+	}
+	return pricing.NewConverter(pool, cfg.Currencies, rules, roundingRule(cfg.Rounding.Default))
+}
+
+func roundingRule(rule pkg.RoundingRule) pricing.RoundingRule {
+	scale := rule.Scale
+	if rule.Mode == "" && scale == 0 {
+		scale = money.Scale
+	}
+	return pricing.RoundingRule{Scale: scale, Mode: pricing.RoundingMode(rule.Mode)}
+}
+
+// memcachedNodes returns the configured memcached servers, falling back to
+// the single host and port settings.
+func memcachedNodes(cfg pkg.Memcache) []database.MemcachedNode {
+	if len(cfg.Servers) == 0 {
+		return []database.MemcachedNode{{Address: fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)}}
+	}
+
+	nodes := make([]database.MemcachedNode, 0, len(cfg.Servers))
+	for _, server := range cfg.Servers {
+		nodes = append(nodes, database.MemcachedNode{
+			Address: server.Address,
+			Timeout: server.Timeout,
+			Weight:  server.Weight,
+		})
+	}
+	return nodes
+}
+
+// reloadMemcachedServers re-reads config.yaml on SIGHUP and applies its memcached server list.
+func reloadMemcachedServers(ctx context.Context, cluster *database.MemcachedCluster) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		file, err := os.Open("config.yaml")
+		if err != nil {
+			slog.Error("failed to open config.yaml for reload", "error", err)
+			continue
+		}
+		var cfg pkg.Config
+		err = cfg.LoadFile(file)
+		file.Close()
+		if err != nil {
+			slog.Error("failed to reload config.yaml", "error", err)
+			continue
+		}
+
+		cluster.SetServers(memcachedNodes(cfg.Memcache))
+	}
+}
@@ -0,0 +1,37 @@
+// Package media stores product images and attachments in a BlobStore and
+// derives what the catalog needs from them: the sniffed content type and,
+// for images, a thumbnail.
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrNotFound is returned by BlobStore.Get for keys that hold no blob.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps blobs under slash-separated keys such as
+// "products/42/7.jpg".
+type BlobStore interface {
+	// Put stores the size bytes read from r under key, replacing any blob
+	// already there.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns the blob stored under key, or ErrNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is
+	// not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// validateKey rejects keys that could escape the store's namespace.
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
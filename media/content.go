@@ -0,0 +1,100 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for thumbnails
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	// ErrUnsupportedType is returned for uploads whose content is not an
+	// allowed image or attachment type.
+	ErrUnsupportedType = errors.New("unsupported media type")
+	// ErrImageTooLarge is returned for images with more pixels than allowed,
+	// which would take too much memory to decode.
+	ErrImageTooLarge = errors.New("image too large")
+)
+
+// Kind tells images, which get thumbnails, from other attachments.
+type Kind string
+
+const (
+	KindImage      Kind = "IMAGE"
+	KindAttachment Kind = "ATTACHMENT"
+)
+
+// allowedTypes maps the content types accepted for upload to their kind and
+// file extension.
+var allowedTypes = map[string]struct {
+	kind      Kind
+	extension string
+}{
+	"image/jpeg":      {KindImage, ".jpg"},
+	"image/png":       {KindImage, ".png"},
+	"image/gif":       {KindImage, ".gif"},
+	"image/webp":      {KindImage, ".webp"},
+	"application/pdf": {KindAttachment, ".pdf"},
+	"text/plain":      {KindAttachment, ".txt"},
+}
+
+// Sniff determines the content type of data from its content, ignoring
+// whatever the client claims, and returns it with its kind and extension.
+func Sniff(data []byte) (contentType string, kind Kind, extension string, err error) {
+	contentType = http.DetectContentType(data)
+	// DetectContentType appends parameters such as "; charset=utf-8".
+	if i := bytes.IndexByte([]byte(contentType), ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	allowed, ok := allowedTypes[contentType]
+	if !ok {
+		return "", "", "", fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+	return contentType, allowed.kind, allowed.extension, nil
+}
+
+// Thumbnail decodes an image and returns a JPEG scaled down to fit in a
+// size by size square. Images that already fit are only re-encoded. The
+// dimensions are read from the header first, and images of more than
+// maxPixels pixels are rejected before decoding them.
+func Thumbnail(data []byte, size int, maxPixels int64) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if pixels := int64(config.Width) * int64(config.Height); pixels > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d is over %d pixels", ErrImageTooLarge, config.Width, config.Height, maxPixels)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	// JPEG has no alpha, so transparent images are flattened onto white.
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,196 @@
+package media
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKeyID     = "AKIDEXAMPLE"
+	testSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// fakeS3 serves the path-style object API of one bucket from memory and
+// rejects requests without SigV4 headers.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+testAccessKeyID+"/") ||
+		r.Header.Get("X-Amz-Date") == "" || r.Header.Get("X-Amz-Content-Sha256") != unsignedPayload {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := r.URL.EscapedPath()
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = body
+		f.types[key] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[key])
+		w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestS3Store(t *testing.T) (*S3Store, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{objects: make(map[string][]byte), types: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3Store(S3Config{
+		Endpoint:        server.URL,
+		Bucket:          "products-media",
+		Region:          "eu-central-1",
+		AccessKeyID:     testAccessKeyID,
+		SecretAccessKey: testSecretAccessKey,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	return store, fake
+}
+
+func TestS3StorePutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	store, fake := newTestS3Store(t)
+
+	tests := []struct {
+		name    string
+		key     string
+		path    string
+		content string
+	}{
+		{"plain key", "products/42/7.jpg", "/products-media/products/42/7.jpg", "jpeg bytes"},
+		{"escaped key", "products/42/photo 1+2.jpg", "/products-media/products/42/photo%201%2B2.jpg", "more bytes"},
+		{"empty blob", "products/42/empty.txt", "/products-media/products/42/empty.txt", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.Put(ctx, tt.key, strings.NewReader(tt.content), int64(len(tt.content)), "image/jpeg"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			fake.mu.Lock()
+			stored, ok := fake.objects[tt.path]
+			contentType := fake.types[tt.path]
+			fake.mu.Unlock()
+			if !ok || string(stored) != tt.content {
+				t.Fatalf("object at %s = %q, %v; want %q", tt.path, stored, ok, tt.content)
+			}
+			if contentType != "image/jpeg" {
+				t.Errorf("Content-Type = %q, want image/jpeg", contentType)
+			}
+
+			body, err := store.Get(ctx, tt.key)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			got, err := io.ReadAll(body)
+			body.Close()
+			if err != nil || string(got) != tt.content {
+				t.Fatalf("Get read %q, %v; want %q", got, err, tt.content)
+			}
+
+			if err := store.Delete(ctx, tt.key); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := store.Get(ctx, tt.key); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get after Delete: err = %v, want ErrNotFound", err)
+			}
+			// Deleting a missing blob is not an error.
+			if err := store.Delete(ctx, tt.key); err != nil {
+				t.Fatalf("second Delete: %v", err)
+			}
+		})
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestS3Store(t)
+
+	if _, err := store.Get(ctx, "products/1/missing.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get missing: err = %v, want ErrNotFound", err)
+	}
+
+	for _, key := range []string{"", "/products/1.jpg", "../secret", "products/../../secret", "products//1.jpg"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded, want an invalid key error", key)
+		}
+	}
+
+	store.cfg.AccessKeyID = "WRONG"
+	err := store.Put(ctx, "products/1/a.txt", strings.NewReader("x"), 1, "text/plain")
+	if err == nil || !strings.Contains(err.Error(), "status 403") {
+		t.Errorf("Put with a rejected signature: err = %v, want status 403", err)
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	// Example from the AWS Signature Version 4 documentation.
+	got := hex.EncodeToString(signingKey(testSecretAccessKey, "20120215", "us-east-1", "iam"))
+	want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if got != want {
+		t.Errorf("signingKey = %s, want %s", got, want)
+	}
+}
+
+func TestSign(t *testing.T) {
+	store, err := NewS3Store(S3Config{
+		Endpoint:        "http://localhost:9000",
+		Bucket:          "products-media",
+		Region:          "eu-central-1",
+		AccessKeyID:     testAccessKeyID,
+		SecretAccessKey: testSecretAccessKey,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	req, err := store.newRequest(context.Background(), http.MethodPut, "products/42/photo 1.jpg", nil)
+	if err != nil {
+		t.Fatalf("newRequest: %v", err)
+	}
+	store.sign(req, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	if got, want := req.URL.EscapedPath(), "/products-media/products/42/photo%201.jpg"; got != want {
+		t.Errorf("path = %s, want %s", got, want)
+	}
+	if got, want := req.Header.Get("X-Amz-Date"), "20240501T120000Z"; got != want {
+		t.Errorf("X-Amz-Date = %s, want %s", got, want)
+	}
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20240501/eu-central-1/s3/aws4_request, " +
+		"SignedHeaders=host;x-amz-content-sha256;x-amz-date, " +
+		"Signature=ec308ca23c5f6991afafe7285ac3d53870f9616200c7acac907f11756a81302a"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,111 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"golang.org/x/text/currency"
+)
+
+// DefaultCurrency is used for prices that do not name a currency.
+const DefaultCurrency = "USD"
+
+// Scale is the number of decimal places stored for prices, matching DECIMAL(10, 2).
+const Scale = 2
+
+// Precision is the number of digits stored for prices, matching DECIMAL(10, 2).
+const Precision = 10
+
+const nanosPerUnit = 1_000_000_000
+
+var nanosDecimal = decimal.NewFromInt(nanosPerUnit)
+
+// maxUnits is the largest whole amount a DECIMAL(Precision, Scale) column holds.
+var maxUnits = decimal.New(1, Precision-Scale).IntPart() - 1
+
+// FromDecimal converts an exact decimal amount to a pb.Money.
+func FromDecimal(amount decimal.Decimal, currency string) *pb.Money {
+	units := amount.Truncate(0)
+	nanos := amount.Sub(units).Mul(nanosDecimal).Truncate(0)
+	return &pb.Money{
+		CurrencyCode: currency,
+		Units:        units.IntPart(),
+		Nanos:        int32(nanos.IntPart()),
+	}
+}
+
+// ToDecimal converts a pb.Money to an exact decimal amount.
+func ToDecimal(m *pb.Money) decimal.Decimal {
+	return decimal.NewFromInt(m.GetUnits()).Add(decimal.New(int64(m.GetNanos()), -9))
+}
+
+// FromFloat converts a legacy float price, rounding it to the stored scale so
+// that 19.99 does not become 19.9899997. price must be finite.
+func FromFloat(price float32) decimal.Decimal {
+	return decimal.NewFromFloat32(price).Round(Scale)
+}
+
+// ToFloat approximates an amount for the deprecated float price fields.
+func ToFloat(amount decimal.Decimal) float32 {
+	f, _ := amount.Float64()
+	return float32(f)
+}
+
+// ValidateCurrency checks that code, in any case, is an ISO 4217 currency code.
+func ValidateCurrency(code string) error {
+	if len(code) != 3 {
+		return fmt.Errorf("invalid currency code %q", code)
+	}
+	if _, err := currency.ParseISO(strings.ToUpper(code)); err != nil {
+		return fmt.Errorf("unknown currency code %q", code)
+	}
+	return nil
+}
+
+// Validate checks that m is a well-formed, non-negative amount in an ISO 4217
+// currency that fits the stored precision and scale.
+func Validate(m *pb.Money) error {
+	if err := ValidateCurrency(m.GetCurrencyCode()); err != nil {
+		return err
+	}
+	if m.GetNanos() <= -nanosPerUnit || m.GetNanos() >= nanosPerUnit {
+		return errors.New("nanos must be within (-1e9, 1e9)")
+	}
+	if (m.GetUnits() > 0 && m.GetNanos() < 0) || (m.GetUnits() < 0 && m.GetNanos() > 0) {
+		return errors.New("units and nanos must have the same sign")
+	}
+	if m.GetUnits() < 0 || m.GetNanos() < 0 {
+		return errors.New("amount must not be negative")
+	}
+	if m.GetUnits() > maxUnits {
+		return fmt.Errorf("amount must be less than %d", maxUnits+1)
+	}
+	if !ToDecimal(m).Equal(ToDecimal(m).Truncate(Scale)) {
+		return fmt.Errorf("amount must have at most %d decimal places", Scale)
+	}
+	return nil
+}
+
+// Resolve returns the amount and currency of a request that may carry either
+// a pb.Money or only the deprecated float price. Legacy prices are rounded
+// to the stored scale.
+func Resolve(m *pb.Money, legacy float32) (decimal.Decimal, string, error) {
+	if m == nil {
+		if math.IsNaN(float64(legacy)) || math.IsInf(float64(legacy), 0) {
+			return decimal.Zero, "", errors.New("amount must be a finite number")
+		}
+		amount := FromFloat(legacy)
+		if amount.IsNegative() || amount.IntPart() > maxUnits {
+			return decimal.Zero, "", fmt.Errorf("amount must be within [0, %d)", maxUnits+1)
+		}
+		return amount, DefaultCurrency, nil
+	}
+	if err := Validate(m); err != nil {
+		return decimal.Zero, "", err
+	}
+	return ToDecimal(m), m.GetCurrencyCode(), nil
+}
@@ -0,0 +1,144 @@
+package money
+
+import (
+	"math"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+)
+
+func TestFromDecimal(t *testing.T) {
+	tests := []struct {
+		amount string
+		units  int64
+		nanos  int32
+		// lossy amounts have digits below a nano, which are dropped.
+		lossy bool
+	}{
+		{"0", 0, 0, false},
+		{"19.99", 19, 990_000_000, false},
+		{"0.01", 0, 10_000_000, false},
+		{"99999999.99", 99_999_999, 990_000_000, false},
+		{"1.000000001", 1, 1, false},
+		{"1.0000000019", 1, 1, true},
+		{"-2.5", -2, -500_000_000, false},
+	}
+	for _, tt := range tests {
+		m := FromDecimal(decimal.RequireFromString(tt.amount), "EUR")
+		if m.GetUnits() != tt.units || m.GetNanos() != tt.nanos || m.GetCurrencyCode() != "EUR" {
+			t.Errorf("FromDecimal(%s) = %v, want %d units %d nanos EUR", tt.amount, m, tt.units, tt.nanos)
+		}
+		if back := ToDecimal(m); !tt.lossy && !back.Equal(decimal.RequireFromString(tt.amount)) {
+			t.Errorf("ToDecimal(FromDecimal(%s)) = %s", tt.amount, back)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		price float32
+		want  string
+	}{
+		{19.99, "19.99"},
+		{0.1, "0.1"},
+		{2.675, "2.68"},
+		// The shortest decimal of the float is rounded, not its binary value.
+		{1.005, "1.01"},
+		{100, "100"},
+		{0, "0"},
+	}
+	for _, tt := range tests {
+		if got := FromFloat(tt.price); !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("FromFloat(%v) = %s, want %s", tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCurrency(t *testing.T) {
+	tests := []struct {
+		code  string
+		valid bool
+	}{
+		{"USD", true},
+		{"eur", true},
+		{"JPY", true},
+		{"XXX", true},
+		{"ABC", false},
+		{"US", false},
+		{"USDT", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateCurrency(tt.code); (err == nil) != tt.valid {
+			t.Errorf("ValidateCurrency(%q) error = %v, want valid %v", tt.code, err, tt.valid)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		money *pb.Money
+		valid bool
+	}{
+		{"whole amount", &pb.Money{CurrencyCode: "USD", Units: 10}, true},
+		{"cents", &pb.Money{CurrencyCode: "USD", Units: 19, Nanos: 990_000_000}, true},
+		{"zero", &pb.Money{CurrencyCode: "USD"}, true},
+		{"largest amount", &pb.Money{CurrencyCode: "USD", Units: 99_999_999, Nanos: 990_000_000}, true},
+		{"too large", &pb.Money{CurrencyCode: "USD", Units: 100_000_000}, false},
+		{"below a cent", &pb.Money{CurrencyCode: "USD", Units: 1, Nanos: 5_000_000}, false},
+		{"negative", &pb.Money{CurrencyCode: "USD", Units: -1}, false},
+		{"negative nanos", &pb.Money{CurrencyCode: "USD", Nanos: -10_000_000}, false},
+		{"mixed signs", &pb.Money{CurrencyCode: "USD", Units: 1, Nanos: -10_000_000}, false},
+		{"nanos out of range", &pb.Money{CurrencyCode: "USD", Nanos: 1_000_000_000}, false},
+		{"unknown currency", &pb.Money{CurrencyCode: "ABC", Units: 1}, false},
+		{"no currency", &pb.Money{Units: 1}, false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.money); (err == nil) != tt.valid {
+				t.Errorf("Validate(%v) error = %v, want valid %v", tt.money, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name         string
+		money        *pb.Money
+		legacy       float32
+		wantAmount   string
+		wantCurrency string
+		wantErr      bool
+	}{
+		{"money", &pb.Money{CurrencyCode: "EUR", Units: 5, Nanos: 500_000_000}, 0, "5.5", "EUR", false},
+		{"money wins over the legacy price", &pb.Money{CurrencyCode: "EUR", Units: 5}, 7, "5", "EUR", false},
+		{"legacy price", nil, 19.99, "19.99", DefaultCurrency, false},
+		{"negative legacy price", nil, -1, "", "", true},
+		{"legacy price too large", nil, 1e9, "", "", true},
+		{"legacy price NaN", nil, float32(math.NaN()), "", "", true},
+		{"legacy price infinite", nil, float32(math.Inf(1)), "", "", true},
+		{"legacy price negative infinite", nil, float32(math.Inf(-1)), "", "", true},
+		{"invalid money", &pb.Money{CurrencyCode: "EUR", Units: -5}, 0, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, currency, err := Resolve(tt.money, tt.legacy)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Resolve = %s %s, want an error", amount, currency)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if !amount.Equal(decimal.RequireFromString(tt.wantAmount)) || currency != tt.wantCurrency {
+				t.Errorf("Resolve = %s %s, want %s %s", amount, currency, tt.wantAmount, tt.wantCurrency)
+			}
+		})
+	}
+}
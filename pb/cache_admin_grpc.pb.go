@@ -0,0 +1,273 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.0--rc3
+// source: cache_admin.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CacheAdminService_GetCacheStats_FullMethodName     = "/products.CacheAdminService/GetCacheStats"
+	CacheAdminService_InspectCacheKey_FullMethodName   = "/products.CacheAdminService/InspectCacheKey"
+	CacheAdminService_EvictProduct_FullMethodName      = "/products.CacheAdminService/EvictProduct"
+	CacheAdminService_EvictProductLists_FullMethodName = "/products.CacheAdminService/EvictProductLists"
+	CacheAdminService_WarmCache_FullMethodName         = "/products.CacheAdminService/WarmCache"
+)
+
+// CacheAdminServiceClient is the client API for CacheAdminService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CacheAdminServiceClient interface {
+	GetCacheStats(ctx context.Context, in *GetCacheStatsRequest, opts ...grpc.CallOption) (*GetCacheStatsResponse, error)
+	InspectCacheKey(ctx context.Context, in *InspectCacheKeyRequest, opts ...grpc.CallOption) (*InspectCacheKeyResponse, error)
+	EvictProduct(ctx context.Context, in *EvictProductRequest, opts ...grpc.CallOption) (*EvictProductResponse, error)
+	EvictProductLists(ctx context.Context, in *EvictProductListsRequest, opts ...grpc.CallOption) (*EvictProductListsResponse, error)
+	WarmCache(ctx context.Context, in *WarmCacheRequest, opts ...grpc.CallOption) (*WarmCacheResponse, error)
+}
+
+type cacheAdminServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCacheAdminServiceClient(cc grpc.ClientConnInterface) CacheAdminServiceClient {
+	return &cacheAdminServiceClient{cc}
+}
+
+func (c *cacheAdminServiceClient) GetCacheStats(ctx context.Context, in *GetCacheStatsRequest, opts ...grpc.CallOption) (*GetCacheStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetCacheStatsResponse)
+	err := c.cc.Invoke(ctx, CacheAdminService_GetCacheStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheAdminServiceClient) InspectCacheKey(ctx context.Context, in *InspectCacheKeyRequest, opts ...grpc.CallOption) (*InspectCacheKeyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(InspectCacheKeyResponse)
+	err := c.cc.Invoke(ctx, CacheAdminService_InspectCacheKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheAdminServiceClient) EvictProduct(ctx context.Context, in *EvictProductRequest, opts ...grpc.CallOption) (*EvictProductResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EvictProductResponse)
+	err := c.cc.Invoke(ctx, CacheAdminService_EvictProduct_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheAdminServiceClient) EvictProductLists(ctx context.Context, in *EvictProductListsRequest, opts ...grpc.CallOption) (*EvictProductListsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EvictProductListsResponse)
+	err := c.cc.Invoke(ctx, CacheAdminService_EvictProductLists_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheAdminServiceClient) WarmCache(ctx context.Context, in *WarmCacheRequest, opts ...grpc.CallOption) (*WarmCacheResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WarmCacheResponse)
+	err := c.cc.Invoke(ctx, CacheAdminService_WarmCache_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CacheAdminServiceServer is the server API for CacheAdminService service.
+// All implementations must embed UnimplementedCacheAdminServiceServer
+// for forward compatibility.
+type CacheAdminServiceServer interface {
+	GetCacheStats(context.Context, *GetCacheStatsRequest) (*GetCacheStatsResponse, error)
+	InspectCacheKey(context.Context, *InspectCacheKeyRequest) (*InspectCacheKeyResponse, error)
+	EvictProduct(context.Context, *EvictProductRequest) (*EvictProductResponse, error)
+	EvictProductLists(context.Context, *EvictProductListsRequest) (*EvictProductListsResponse, error)
+	WarmCache(context.Context, *WarmCacheRequest) (*WarmCacheResponse, error)
+	mustEmbedUnimplementedCacheAdminServiceServer()
+}
+
+// UnimplementedCacheAdminServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCacheAdminServiceServer struct{}
+
+func (UnimplementedCacheAdminServiceServer) GetCacheStats(context.Context, *GetCacheStatsRequest) (*GetCacheStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCacheStats not implemented")
+}
+func (UnimplementedCacheAdminServiceServer) InspectCacheKey(context.Context, *InspectCacheKeyRequest) (*InspectCacheKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InspectCacheKey not implemented")
+}
+func (UnimplementedCacheAdminServiceServer) EvictProduct(context.Context, *EvictProductRequest) (*EvictProductResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EvictProduct not implemented")
+}
+func (UnimplementedCacheAdminServiceServer) EvictProductLists(context.Context, *EvictProductListsRequest) (*EvictProductListsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EvictProductLists not implemented")
+}
+func (UnimplementedCacheAdminServiceServer) WarmCache(context.Context, *WarmCacheRequest) (*WarmCacheResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WarmCache not implemented")
+}
+func (UnimplementedCacheAdminServiceServer) mustEmbedUnimplementedCacheAdminServiceServer() {}
+func (UnimplementedCacheAdminServiceServer) testEmbeddedByValue()                           {}
+
+// UnsafeCacheAdminServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CacheAdminServiceServer will
+// result in compilation errors.
+type UnsafeCacheAdminServiceServer interface {
+	mustEmbedUnimplementedCacheAdminServiceServer()
+}
+
+func RegisterCacheAdminServiceServer(s grpc.ServiceRegistrar, srv CacheAdminServiceServer) {
+	// If the following call pancis, it indicates UnimplementedCacheAdminServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CacheAdminService_ServiceDesc, srv)
+}
+
+func _CacheAdminService_GetCacheStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCacheStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheAdminServiceServer).GetCacheStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheAdminService_GetCacheStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheAdminServiceServer).GetCacheStats(ctx, req.(*GetCacheStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheAdminService_InspectCacheKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InspectCacheKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheAdminServiceServer).InspectCacheKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheAdminService_InspectCacheKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheAdminServiceServer).InspectCacheKey(ctx, req.(*InspectCacheKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheAdminService_EvictProduct_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EvictProductRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheAdminServiceServer).EvictProduct(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheAdminService_EvictProduct_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheAdminServiceServer).EvictProduct(ctx, req.(*EvictProductRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheAdminService_EvictProductLists_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EvictProductListsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheAdminServiceServer).EvictProductLists(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheAdminService_EvictProductLists_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheAdminServiceServer).EvictProductLists(ctx, req.(*EvictProductListsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheAdminService_WarmCache_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WarmCacheRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheAdminServiceServer).WarmCache(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheAdminService_WarmCache_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheAdminServiceServer).WarmCache(ctx, req.(*WarmCacheRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CacheAdminService_ServiceDesc is the grpc.ServiceDesc for CacheAdminService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CacheAdminService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "products.CacheAdminService",
+	HandlerType: (*CacheAdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCacheStats",
+			Handler:    _CacheAdminService_GetCacheStats_Handler,
+		},
+		{
+			MethodName: "InspectCacheKey",
+			Handler:    _CacheAdminService_InspectCacheKey_Handler,
+		},
+		{
+			MethodName: "EvictProduct",
+			Handler:    _CacheAdminService_EvictProduct_Handler,
+		},
+		{
+			MethodName: "EvictProductLists",
+			Handler:    _CacheAdminService_EvictProductLists_Handler,
+		},
+		{
+			MethodName: "WarmCache",
+			Handler:    _CacheAdminService_WarmCache_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "cache_admin.proto",
+}
@@ -0,0 +1,244 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.0--rc3
+// source: media.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	MediaService_UploadProductMedia_FullMethodName   = "/products.MediaService/UploadProductMedia"
+	MediaService_DownloadProductMedia_FullMethodName = "/products.MediaService/DownloadProductMedia"
+	MediaService_ReorderProductMedia_FullMethodName  = "/products.MediaService/ReorderProductMedia"
+	MediaService_DeleteProductMedia_FullMethodName   = "/products.MediaService/DeleteProductMedia"
+)
+
+// MediaServiceClient is the client API for MediaService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// MediaService stores images and attachments of products.
+type MediaServiceClient interface {
+	// The first message carries the metadata, every following one a chunk of
+	// the content. The content type is sniffed from the content.
+	UploadProductMedia(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadProductMediaRequest, UploadProductMediaResponse], error)
+	// The first message carries the media, every following one a chunk of the
+	// content.
+	DownloadProductMedia(ctx context.Context, in *DownloadProductMediaRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadProductMediaResponse], error)
+	ReorderProductMedia(ctx context.Context, in *ReorderProductMediaRequest, opts ...grpc.CallOption) (*ReorderProductMediaResponse, error)
+	DeleteProductMedia(ctx context.Context, in *DeleteProductMediaRequest, opts ...grpc.CallOption) (*DeleteProductMediaResponse, error)
+}
+
+type mediaServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMediaServiceClient(cc grpc.ClientConnInterface) MediaServiceClient {
+	return &mediaServiceClient{cc}
+}
+
+func (c *mediaServiceClient) UploadProductMedia(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadProductMediaRequest, UploadProductMediaResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MediaService_ServiceDesc.Streams[0], MediaService_UploadProductMedia_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UploadProductMediaRequest, UploadProductMediaResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MediaService_UploadProductMediaClient = grpc.ClientStreamingClient[UploadProductMediaRequest, UploadProductMediaResponse]
+
+func (c *mediaServiceClient) DownloadProductMedia(ctx context.Context, in *DownloadProductMediaRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadProductMediaResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MediaService_ServiceDesc.Streams[1], MediaService_DownloadProductMedia_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DownloadProductMediaRequest, DownloadProductMediaResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MediaService_DownloadProductMediaClient = grpc.ServerStreamingClient[DownloadProductMediaResponse]
+
+func (c *mediaServiceClient) ReorderProductMedia(ctx context.Context, in *ReorderProductMediaRequest, opts ...grpc.CallOption) (*ReorderProductMediaResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReorderProductMediaResponse)
+	err := c.cc.Invoke(ctx, MediaService_ReorderProductMedia_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mediaServiceClient) DeleteProductMedia(ctx context.Context, in *DeleteProductMediaRequest, opts ...grpc.CallOption) (*DeleteProductMediaResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteProductMediaResponse)
+	err := c.cc.Invoke(ctx, MediaService_DeleteProductMedia_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MediaServiceServer is the server API for MediaService service.
+// All implementations must embed UnimplementedMediaServiceServer
+// for forward compatibility.
+//
+// MediaService stores images and attachments of products.
+type MediaServiceServer interface {
+	// The first message carries the metadata, every following one a chunk of
+	// the content. The content type is sniffed from the content.
+	UploadProductMedia(grpc.ClientStreamingServer[UploadProductMediaRequest, UploadProductMediaResponse]) error
+	// The first message carries the media, every following one a chunk of the
+	// content.
+	DownloadProductMedia(*DownloadProductMediaRequest, grpc.ServerStreamingServer[DownloadProductMediaResponse]) error
+	ReorderProductMedia(context.Context, *ReorderProductMediaRequest) (*ReorderProductMediaResponse, error)
+	DeleteProductMedia(context.Context, *DeleteProductMediaRequest) (*DeleteProductMediaResponse, error)
+	mustEmbedUnimplementedMediaServiceServer()
+}
+
+// UnimplementedMediaServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMediaServiceServer struct{}
+
+func (UnimplementedMediaServiceServer) UploadProductMedia(grpc.ClientStreamingServer[UploadProductMediaRequest, UploadProductMediaResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method UploadProductMedia not implemented")
+}
+func (UnimplementedMediaServiceServer) DownloadProductMedia(*DownloadProductMediaRequest, grpc.ServerStreamingServer[DownloadProductMediaResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadProductMedia not implemented")
+}
+func (UnimplementedMediaServiceServer) ReorderProductMedia(context.Context, *ReorderProductMediaRequest) (*ReorderProductMediaResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReorderProductMedia not implemented")
+}
+func (UnimplementedMediaServiceServer) DeleteProductMedia(context.Context, *DeleteProductMediaRequest) (*DeleteProductMediaResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteProductMedia not implemented")
+}
+func (UnimplementedMediaServiceServer) mustEmbedUnimplementedMediaServiceServer() {}
+func (UnimplementedMediaServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeMediaServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MediaServiceServer will
+// result in compilation errors.
+type UnsafeMediaServiceServer interface {
+	mustEmbedUnimplementedMediaServiceServer()
+}
+
+func RegisterMediaServiceServer(s grpc.ServiceRegistrar, srv MediaServiceServer) {
+	// If the following call pancis, it indicates UnimplementedMediaServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&MediaService_ServiceDesc, srv)
+}
+
+func _MediaService_UploadProductMedia_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MediaServiceServer).UploadProductMedia(&grpc.GenericServerStream[UploadProductMediaRequest, UploadProductMediaResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MediaService_UploadProductMediaServer = grpc.ClientStreamingServer[UploadProductMediaRequest, UploadProductMediaResponse]
+
+func _MediaService_DownloadProductMedia_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadProductMediaRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MediaServiceServer).DownloadProductMedia(m, &grpc.GenericServerStream[DownloadProductMediaRequest, DownloadProductMediaResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MediaService_DownloadProductMediaServer = grpc.ServerStreamingServer[DownloadProductMediaResponse]
+
+func _MediaService_ReorderProductMedia_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReorderProductMediaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MediaServiceServer).ReorderProductMedia(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MediaService_ReorderProductMedia_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MediaServiceServer).ReorderProductMedia(ctx, req.(*ReorderProductMediaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MediaService_DeleteProductMedia_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteProductMediaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MediaServiceServer).DeleteProductMedia(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MediaService_DeleteProductMedia_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MediaServiceServer).DeleteProductMedia(ctx, req.(*DeleteProductMediaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MediaService_ServiceDesc is the grpc.ServiceDesc for MediaService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MediaService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "products.MediaService",
+	HandlerType: (*MediaServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ReorderProductMedia",
+			Handler:    _MediaService_ReorderProductMedia_Handler,
+		},
+		{
+			MethodName: "DeleteProductMedia",
+			Handler:    _MediaService_DeleteProductMedia_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "UploadProductMedia",
+			Handler:       _MediaService_UploadProductMedia_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadProductMedia",
+			Handler:       _MediaService_DownloadProductMedia_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "media.proto",
+}
@@ -0,0 +1,203 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.0--rc3
+// source: product_types.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ProductTypeService_DefineProductType_FullMethodName = "/products.ProductTypeService/DefineProductType"
+	ProductTypeService_GetProductType_FullMethodName    = "/products.ProductTypeService/GetProductType"
+	ProductTypeService_ListProductTypes_FullMethodName  = "/products.ProductTypeService/ListProductTypes"
+)
+
+// ProductTypeServiceClient is the client API for ProductTypeService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ProductTypeService manages the registry of product types. Each type
+// declares the attributes a product of that type carries.
+type ProductTypeServiceClient interface {
+	DefineProductType(ctx context.Context, in *DefineProductTypeRequest, opts ...grpc.CallOption) (*DefineProductTypeResponse, error)
+	GetProductType(ctx context.Context, in *GetProductTypeRequest, opts ...grpc.CallOption) (*GetProductTypeResponse, error)
+	ListProductTypes(ctx context.Context, in *ListProductTypesRequest, opts ...grpc.CallOption) (*ListProductTypesResponse, error)
+}
+
+type productTypeServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewProductTypeServiceClient(cc grpc.ClientConnInterface) ProductTypeServiceClient {
+	return &productTypeServiceClient{cc}
+}
+
+func (c *productTypeServiceClient) DefineProductType(ctx context.Context, in *DefineProductTypeRequest, opts ...grpc.CallOption) (*DefineProductTypeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DefineProductTypeResponse)
+	err := c.cc.Invoke(ctx, ProductTypeService_DefineProductType_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *productTypeServiceClient) GetProductType(ctx context.Context, in *GetProductTypeRequest, opts ...grpc.CallOption) (*GetProductTypeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetProductTypeResponse)
+	err := c.cc.Invoke(ctx, ProductTypeService_GetProductType_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *productTypeServiceClient) ListProductTypes(ctx context.Context, in *ListProductTypesRequest, opts ...grpc.CallOption) (*ListProductTypesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListProductTypesResponse)
+	err := c.cc.Invoke(ctx, ProductTypeService_ListProductTypes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ProductTypeServiceServer is the server API for ProductTypeService service.
+// All implementations must embed UnimplementedProductTypeServiceServer
+// for forward compatibility.
+//
+// ProductTypeService manages the registry of product types. Each type
+// declares the attributes a product of that type carries.
+type ProductTypeServiceServer interface {
+	DefineProductType(context.Context, *DefineProductTypeRequest) (*DefineProductTypeResponse, error)
+	GetProductType(context.Context, *GetProductTypeRequest) (*GetProductTypeResponse, error)
+	ListProductTypes(context.Context, *ListProductTypesRequest) (*ListProductTypesResponse, error)
+	mustEmbedUnimplementedProductTypeServiceServer()
+}
+
+// UnimplementedProductTypeServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedProductTypeServiceServer struct{}
+
+func (UnimplementedProductTypeServiceServer) DefineProductType(context.Context, *DefineProductTypeRequest) (*DefineProductTypeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DefineProductType not implemented")
+}
+func (UnimplementedProductTypeServiceServer) GetProductType(context.Context, *GetProductTypeRequest) (*GetProductTypeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetProductType not implemented")
+}
+func (UnimplementedProductTypeServiceServer) ListProductTypes(context.Context, *ListProductTypesRequest) (*ListProductTypesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListProductTypes not implemented")
+}
+func (UnimplementedProductTypeServiceServer) mustEmbedUnimplementedProductTypeServiceServer() {}
+func (UnimplementedProductTypeServiceServer) testEmbeddedByValue()                            {}
+
+// UnsafeProductTypeServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ProductTypeServiceServer will
+// result in compilation errors.
+type UnsafeProductTypeServiceServer interface {
+	mustEmbedUnimplementedProductTypeServiceServer()
+}
+
+func RegisterProductTypeServiceServer(s grpc.ServiceRegistrar, srv ProductTypeServiceServer) {
+	// If the following call pancis, it indicates UnimplementedProductTypeServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ProductTypeService_ServiceDesc, srv)
+}
+
+func _ProductTypeService_DefineProductType_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DefineProductTypeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductTypeServiceServer).DefineProductType(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProductTypeService_DefineProductType_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductTypeServiceServer).DefineProductType(ctx, req.(*DefineProductTypeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProductTypeService_GetProductType_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetProductTypeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductTypeServiceServer).GetProductType(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProductTypeService_GetProductType_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductTypeServiceServer).GetProductType(ctx, req.(*GetProductTypeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProductTypeService_ListProductTypes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListProductTypesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductTypeServiceServer).ListProductTypes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProductTypeService_ListProductTypes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductTypeServiceServer).ListProductTypes(ctx, req.(*ListProductTypesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ProductTypeService_ServiceDesc is the grpc.ServiceDesc for ProductTypeService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ProductTypeService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "products.ProductTypeService",
+	HandlerType: (*ProductTypeServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "DefineProductType",
+			Handler:    _ProductTypeService_DefineProductType_Handler,
+		},
+		{
+			MethodName: "GetProductType",
+			Handler:    _ProductTypeService_GetProductType_Handler,
+		},
+		{
+			MethodName: "ListProductTypes",
+			Handler:    _ProductTypeService_ListProductTypes_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "product_types.proto",
+}
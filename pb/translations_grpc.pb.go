@@ -0,0 +1,205 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.0--rc3
+// source: translations.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	TranslationService_SetProductTranslation_FullMethodName    = "/products.TranslationService/SetProductTranslation"
+	TranslationService_ListProductTranslations_FullMethodName  = "/products.TranslationService/ListProductTranslations"
+	TranslationService_DeleteProductTranslation_FullMethodName = "/products.TranslationService/DeleteProductTranslation"
+)
+
+// TranslationServiceClient is the client API for TranslationService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// TranslationService manages per-locale product content. The product itself
+// holds the content of the default locale; reads fall back along the
+// configured locale chain for anything a translation leaves empty.
+type TranslationServiceClient interface {
+	SetProductTranslation(ctx context.Context, in *SetProductTranslationRequest, opts ...grpc.CallOption) (*SetProductTranslationResponse, error)
+	ListProductTranslations(ctx context.Context, in *ListProductTranslationsRequest, opts ...grpc.CallOption) (*ListProductTranslationsResponse, error)
+	DeleteProductTranslation(ctx context.Context, in *DeleteProductTranslationRequest, opts ...grpc.CallOption) (*DeleteProductTranslationResponse, error)
+}
+
+type translationServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTranslationServiceClient(cc grpc.ClientConnInterface) TranslationServiceClient {
+	return &translationServiceClient{cc}
+}
+
+func (c *translationServiceClient) SetProductTranslation(ctx context.Context, in *SetProductTranslationRequest, opts ...grpc.CallOption) (*SetProductTranslationResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetProductTranslationResponse)
+	err := c.cc.Invoke(ctx, TranslationService_SetProductTranslation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *translationServiceClient) ListProductTranslations(ctx context.Context, in *ListProductTranslationsRequest, opts ...grpc.CallOption) (*ListProductTranslationsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListProductTranslationsResponse)
+	err := c.cc.Invoke(ctx, TranslationService_ListProductTranslations_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *translationServiceClient) DeleteProductTranslation(ctx context.Context, in *DeleteProductTranslationRequest, opts ...grpc.CallOption) (*DeleteProductTranslationResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteProductTranslationResponse)
+	err := c.cc.Invoke(ctx, TranslationService_DeleteProductTranslation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TranslationServiceServer is the server API for TranslationService service.
+// All implementations must embed UnimplementedTranslationServiceServer
+// for forward compatibility.
+//
+// TranslationService manages per-locale product content. The product itself
+// holds the content of the default locale; reads fall back along the
+// configured locale chain for anything a translation leaves empty.
+type TranslationServiceServer interface {
+	SetProductTranslation(context.Context, *SetProductTranslationRequest) (*SetProductTranslationResponse, error)
+	ListProductTranslations(context.Context, *ListProductTranslationsRequest) (*ListProductTranslationsResponse, error)
+	DeleteProductTranslation(context.Context, *DeleteProductTranslationRequest) (*DeleteProductTranslationResponse, error)
+	mustEmbedUnimplementedTranslationServiceServer()
+}
+
+// UnimplementedTranslationServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTranslationServiceServer struct{}
+
+func (UnimplementedTranslationServiceServer) SetProductTranslation(context.Context, *SetProductTranslationRequest) (*SetProductTranslationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetProductTranslation not implemented")
+}
+func (UnimplementedTranslationServiceServer) ListProductTranslations(context.Context, *ListProductTranslationsRequest) (*ListProductTranslationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListProductTranslations not implemented")
+}
+func (UnimplementedTranslationServiceServer) DeleteProductTranslation(context.Context, *DeleteProductTranslationRequest) (*DeleteProductTranslationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteProductTranslation not implemented")
+}
+func (UnimplementedTranslationServiceServer) mustEmbedUnimplementedTranslationServiceServer() {}
+func (UnimplementedTranslationServiceServer) testEmbeddedByValue()                            {}
+
+// UnsafeTranslationServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TranslationServiceServer will
+// result in compilation errors.
+type UnsafeTranslationServiceServer interface {
+	mustEmbedUnimplementedTranslationServiceServer()
+}
+
+func RegisterTranslationServiceServer(s grpc.ServiceRegistrar, srv TranslationServiceServer) {
+	// If the following call pancis, it indicates UnimplementedTranslationServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TranslationService_ServiceDesc, srv)
+}
+
+func _TranslationService_SetProductTranslation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetProductTranslationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TranslationServiceServer).SetProductTranslation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TranslationService_SetProductTranslation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TranslationServiceServer).SetProductTranslation(ctx, req.(*SetProductTranslationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TranslationService_ListProductTranslations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListProductTranslationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TranslationServiceServer).ListProductTranslations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TranslationService_ListProductTranslations_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TranslationServiceServer).ListProductTranslations(ctx, req.(*ListProductTranslationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TranslationService_DeleteProductTranslation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteProductTranslationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TranslationServiceServer).DeleteProductTranslation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TranslationService_DeleteProductTranslation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TranslationServiceServer).DeleteProductTranslation(ctx, req.(*DeleteProductTranslationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// TranslationService_ServiceDesc is the grpc.ServiceDesc for TranslationService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TranslationService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "products.TranslationService",
+	HandlerType: (*TranslationServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SetProductTranslation",
+			Handler:    _TranslationService_SetProductTranslation_Handler,
+		},
+		{
+			MethodName: "ListProductTranslations",
+			Handler:    _TranslationService_ListProductTranslations_Handler,
+		},
+		{
+			MethodName: "DeleteProductTranslation",
+			Handler:    _TranslationService_DeleteProductTranslation_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "translations.proto",
+}
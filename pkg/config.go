@@ -1,16 +1,28 @@
 package pkg
 
 import (
+	"fmt"
 	"io"
 	"log/slog"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	Database DB       `yaml:"database"`
-	Server   Server   `yaml:"server"`
-	Memcache Memcache `yaml:"memcache"`
+	Database     DB           `yaml:"database"`
+	Server       Server       `yaml:"server"`
+	Memcache     Memcache     `yaml:"memcache"`
+	Cache        Cache        `yaml:"cache"`
+	Events       Events       `yaml:"events"`
+	Pricing      Pricing      `yaml:"pricing"`
+	Promotions   Promotions   `yaml:"promotions"`
+	Inventory    Inventory    `yaml:"inventory"`
+	Media        Media        `yaml:"media"`
+	Localization Localization `yaml:"localization"`
+	Lifecycle    Lifecycle    `yaml:"lifecycle"`
+	Duplicates   Duplicates   `yaml:"duplicates"`
+	Catalog      Catalog      `yaml:"catalog"`
 }
 
 type DB struct {
@@ -24,6 +36,170 @@ type DB struct {
 type Memcache struct {
 	Host string `yaml:"host"`
 	Port int    `yaml:"port"`
+	// Servers takes precedence over Host and Port when set.
+	Servers           []MemcacheServer `yaml:"servers"`
+	EjectAfter        int              `yaml:"eject_after"`
+	RetryEjectedAfter time.Duration    `yaml:"retry_ejected_after"`
+}
+
+type MemcacheServer struct {
+	Address string        `yaml:"address"`
+	Timeout time.Duration `yaml:"timeout"`
+	Weight  int           `yaml:"weight"`
+}
+
+type Cache struct {
+	// Driver selects the cache backend: memcached (default), redis, memory or none.
+	Driver string `yaml:"driver"`
+	// Compression of cached payloads: none, snappy or zstd.
+	Compression string     `yaml:"compression"`
+	Local       LocalCache `yaml:"local"`
+	Memory      LocalCache `yaml:"memory"`
+	Redis       Redis      `yaml:"redis"`
+	Breaker     Breaker    `yaml:"breaker"`
+	Warmup      Warmup     `yaml:"warmup"`
+	// AdminRoles, forwarded by the API gateway, may use the cache admin RPCs.
+	AdminRoles []string `yaml:"admin_roles"`
+}
+
+type Warmup struct {
+	Enabled     bool          `yaml:"enabled"`
+	Products    int           `yaml:"products"`
+	ListQueries int           `yaml:"list_queries"`
+	Pages       int           `yaml:"pages"`
+	Timeout     time.Duration `yaml:"timeout"`
+	// Window limits warm-up to queries seen this recently.
+	Window time.Duration `yaml:"window"`
+	// FlushInterval is how often query statistics are written to the database.
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	// Retention is how long query statistics are kept after they were last
+	// seen; it should be at least Window.
+	Retention time.Duration `yaml:"retention"`
+}
+
+type Breaker struct {
+	FailureThreshold int           `yaml:"failure_threshold"`
+	ProbeInterval    time.Duration `yaml:"probe_interval"`
+}
+
+type Redis struct {
+	Address string `yaml:"address"`
+	DB      int    `yaml:"db"`
+}
+
+type LocalCache struct {
+	Size int           `yaml:"size"`
+	TTL  time.Duration `yaml:"ttl"`
+}
+
+type Events struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+}
+
+type Pricing struct {
+	// Currencies lists the accepted ISO 4217 codes; empty accepts any.
+	Currencies []string `yaml:"currencies"`
+	// RefreshInterval is how often exchange rates are reloaded from the database.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	// ScheduleInterval is how often scheduled price changes are checked.
+	ScheduleInterval time.Duration `yaml:"schedule_interval"`
+	Rounding         Rounding      `yaml:"rounding"`
+}
+
+type Rounding struct {
+	Default    RoundingRule            `yaml:"default"`
+	Currencies map[string]RoundingRule `yaml:"currencies"`
+}
+
+type RoundingRule struct {
+	Scale int32 `yaml:"scale"`
+	// Mode is one of half_up, half_even, up or down.
+	Mode string `yaml:"mode"`
+}
+
+type Promotions struct {
+	// RefreshInterval is how often promotions are reloaded from the database.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+type Inventory struct {
+	// ReservationTTL applies to reservations that do not ask for a TTL.
+	ReservationTTL    time.Duration `yaml:"reservation_ttl"`
+	MaxReservationTTL time.Duration `yaml:"max_reservation_ttl"`
+	// SweepInterval is how often expired reservations are released.
+	SweepInterval time.Duration `yaml:"sweep_interval"`
+	// LotExpiryInterval is how often lots are checked for passing their best-before date.
+	LotExpiryInterval time.Duration `yaml:"lot_expiry_interval"`
+}
+
+type Media struct {
+	// Driver selects the blob store: local (default) or s3.
+	Driver string `yaml:"driver"`
+	// LocalDir is the root directory of the local blob store.
+	LocalDir string `yaml:"local_dir"`
+	S3       S3     `yaml:"s3"`
+	// PublicURL is the base URL blobs are served from; empty leaves media URLs unset.
+	PublicURL      string `yaml:"public_url"`
+	MaxUploadBytes int64  `yaml:"max_upload_bytes"`
+	// ThumbnailSize bounds the longer side of image thumbnails, in pixels.
+	ThumbnailSize int `yaml:"thumbnail_size"`
+	// MaxImagePixels rejects images with more pixels, width times height,
+	// before they are decoded.
+	MaxImagePixels int64 `yaml:"max_image_pixels"`
+}
+
+// S3 configures an S3-compatible blob store. Credentials are read from the
+// S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY environment variables.
+type S3 struct {
+	Endpoint string `yaml:"endpoint"`
+	Bucket   string `yaml:"bucket"`
+	Region   string `yaml:"region"`
+}
+
+type Localization struct {
+	// DefaultLocale is the locale product content is written in.
+	DefaultLocale string `yaml:"default_locale"`
+	// Locales lists the BCP 47 tags translations can be written and read in.
+	Locales []string `yaml:"locales"`
+	// Fallbacks lists, per locale, the locales tried before the default one
+	// when a translation is missing.
+	Fallbacks map[string][]string `yaml:"fallbacks"`
+}
+
+// Lifecycle names the roles, forwarded by the API gateway, that may move
+// products through their lifecycle.
+type Lifecycle struct {
+	// EditorRoles may submit, discontinue and archive products and see unpublished ones.
+	EditorRoles []string `yaml:"editor_roles"`
+	// ApproverRoles may publish or reject products in review.
+	ApproverRoles []string `yaml:"approver_roles"`
+	// ScheduleInterval is how often scheduled publications and withdrawals are checked.
+	ScheduleInterval time.Duration `yaml:"schedule_interval"`
+	// LeaseTTL is how long a replica keeps running the scheduler after it
+	// last renewed its lease; it must exceed ScheduleInterval.
+	LeaseTTL time.Duration `yaml:"lease_ttl"`
+}
+
+// Catalog names the roles, forwarded by the API gateway, that may change
+// catalog-wide settings such as exchange rates, prices and promotions.
+type Catalog struct {
+	AdminRoles []string `yaml:"admin_roles"`
+}
+
+type Duplicates struct {
+	// Threshold is the score, above 0 and at most 1, from which a product is
+	// reported as a likely duplicate. Unset uses the default of 0.75.
+	Threshold float64 `yaml:"threshold"`
+	// Strict rejects likely duplicates on create.
+	Strict bool `yaml:"strict"`
+}
+
+// Validate checks that Threshold, when set, is within (0, 1].
+func (d Duplicates) Validate() error {
+	if !(d.Threshold >= 0 && d.Threshold <= 1) {
+		return fmt.Errorf("duplicates.threshold must be greater than 0 and at most 1, got %v", d.Threshold)
+	}
+	return nil
 }
 
 type Server struct {
@@ -0,0 +1,221 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/money"
+)
+
+// ErrNoExchangeRate is returned when no rate is known between two currencies.
+var ErrNoExchangeRate = errors.New("no exchange rate")
+
+// RoundingMode selects how converted amounts are rounded.
+type RoundingMode string
+
+const (
+	RoundHalfUp   RoundingMode = "half_up"
+	RoundHalfEven RoundingMode = "half_even"
+	RoundUp       RoundingMode = "up"
+	RoundDown     RoundingMode = "down"
+)
+
+// RoundingRule rounds amounts of a currency to Scale decimal places.
+type RoundingRule struct {
+	Scale int32
+	Mode  RoundingMode
+}
+
+// Apply rounds amount according to the rule.
+func (r RoundingRule) Apply(amount decimal.Decimal) decimal.Decimal {
+	switch r.Mode {
+	case RoundHalfEven:
+		return amount.RoundBank(r.Scale)
+	case RoundUp:
+		return amount.RoundCeil(r.Scale)
+	case RoundDown:
+		return amount.RoundFloor(r.Scale)
+	default:
+		return amount.Round(r.Scale)
+	}
+}
+
+// ExchangeRate is the number of Quote units one Base unit buys.
+type ExchangeRate struct {
+	Base      string
+	Quote     string
+	Rate      decimal.Decimal
+	UpdatedAt time.Time
+}
+
+type currencyPair struct {
+	base, quote string
+}
+
+// Converter converts amounts between currencies using the exchange_rates
+// table, which it keeps in memory and refreshes periodically.
+type Converter struct {
+	pool        *pgxpool.Pool
+	rules       map[string]RoundingRule
+	defaultRule RoundingRule
+	supported   map[string]bool
+
+	mu    sync.RWMutex
+	rates map[currencyPair]decimal.Decimal
+}
+
+// NewConverter returns a Converter. Currencies without a rule in rules are
+// rounded with defaultRule. If supported is empty any currency is accepted.
+func NewConverter(pool *pgxpool.Pool, supported []string, rules map[string]RoundingRule, defaultRule RoundingRule) *Converter {
+	c := &Converter{
+		pool:        pool,
+		rules:       make(map[string]RoundingRule, len(rules)),
+		defaultRule: defaultRule,
+		supported:   make(map[string]bool, len(supported)),
+		rates:       make(map[currencyPair]decimal.Decimal),
+	}
+	for currency, rule := range rules {
+		c.rules[strings.ToUpper(currency)] = rule
+	}
+	for _, currency := range supported {
+		c.supported[strings.ToUpper(currency)] = true
+	}
+	return c
+}
+
+// NormalizeCurrency upper-cases currency and checks that it is an ISO 4217
+// code and supported.
+func (c *Converter) NormalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if err := money.ValidateCurrency(currency); err != nil {
+		return "", err
+	}
+	if len(c.supported) > 0 && !c.supported[currency] {
+		return "", fmt.Errorf("unsupported currency %q", currency)
+	}
+	return currency, nil
+}
+
+// Round rounds amount with the rule configured for currency.
+func (c *Converter) Round(amount decimal.Decimal, currency string) decimal.Decimal {
+	rule, ok := c.rules[currency]
+	if !ok {
+		rule = c.defaultRule
+	}
+	return rule.Apply(amount)
+}
+
+// Convert converts amount from one currency to another and rounds the result.
+// The inverse of a stored rate is used when only the opposite pair is known.
+func (c *Converter) Convert(amount decimal.Decimal, from, to string) (decimal.Decimal, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	c.mu.RLock()
+	rate, ok := c.rates[currencyPair{from, to}]
+	if !ok {
+		if inverse, found := c.rates[currencyPair{to, from}]; found && !inverse.IsZero() {
+			rate, ok = decimal.NewFromInt(1).DivRound(inverse, 16), true
+		}
+	}
+	c.mu.RUnlock()
+
+	if !ok {
+		return decimal.Zero, fmt.Errorf("%w from %s to %s", ErrNoExchangeRate, from, to)
+	}
+	return c.Round(amount.Mul(rate), to), nil
+}
+
+// Refresh reloads every exchange rate from the database.
+func (c *Converter) Refresh(ctx context.Context) error {
+	rates, err := c.ListRates(ctx)
+	if err != nil {
+		return err
+	}
+
+	next := make(map[currencyPair]decimal.Decimal, len(rates))
+	for _, rate := range rates {
+		next[currencyPair{rate.Base, rate.Quote}] = rate.Rate
+	}
+
+	c.mu.Lock()
+	c.rates = next
+	c.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the rates every interval until ctx is cancelled.
+func (c *Converter) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("failed to refresh exchange rates", "error", err)
+			}
+		}
+	}
+}
+
+// SetRate stores the rate from base to quote and reloads the in-memory rates.
+func (c *Converter) SetRate(ctx context.Context, base, quote string, rate decimal.Decimal) (ExchangeRate, error) {
+	query := `
+	UPSERT INTO exchange_rates (base_currency, quote_currency, rate, updated_at)
+	VALUES ($1, $2, $3::DECIMAL, now())
+	RETURNING updated_at
+	`
+	result := ExchangeRate{Base: base, Quote: quote, Rate: rate}
+	if err := c.pool.QueryRow(ctx, query, base, quote, rate.String()).Scan(&result.UpdatedAt); err != nil {
+		return ExchangeRate{}, fmt.Errorf("failed to store exchange rate: %w", err)
+	}
+
+	if err := c.Refresh(ctx); err != nil {
+		slog.Warn("failed to refresh exchange rates", "error", err)
+	}
+	return result, nil
+}
+
+// ListRates returns every stored exchange rate.
+func (c *Converter) ListRates(ctx context.Context) ([]ExchangeRate, error) {
+	query := `
+	SELECT base_currency, quote_currency, rate::STRING, updated_at
+	FROM exchange_rates
+	ORDER BY base_currency, quote_currency
+	`
+	rows, err := c.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	var rates []ExchangeRate
+	for rows.Next() {
+		var (
+			rate ExchangeRate
+			text string
+		)
+		if err := rows.Scan(&rate.Base, &rate.Quote, &text, &rate.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if rate.Rate, err = decimal.NewFromString(text); err != nil {
+			return nil, fmt.Errorf("invalid stored exchange rate %q: %w", text, err)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
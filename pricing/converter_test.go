@@ -0,0 +1,104 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRoundingRuleApply(t *testing.T) {
+	tests := []struct {
+		rule   RoundingRule
+		amount string
+		want   string
+	}{
+		{RoundingRule{Scale: 2, Mode: RoundHalfUp}, "1.005", "1.01"},
+		{RoundingRule{Scale: 2, Mode: RoundHalfUp}, "1.004", "1"},
+		{RoundingRule{Scale: 2}, "1.005", "1.01"},
+		{RoundingRule{Scale: 2, Mode: RoundHalfEven}, "1.005", "1"},
+		{RoundingRule{Scale: 2, Mode: RoundHalfEven}, "1.015", "1.02"},
+		{RoundingRule{Scale: 2, Mode: RoundUp}, "1.001", "1.01"},
+		{RoundingRule{Scale: 2, Mode: RoundDown}, "1.009", "1"},
+		{RoundingRule{Scale: 0, Mode: RoundHalfUp}, "149.5", "150"},
+		{RoundingRule{Scale: 0, Mode: RoundDown}, "149.99", "149"},
+		{RoundingRule{Scale: 3, Mode: RoundHalfUp}, "1.23456", "1.235"},
+	}
+	for _, tt := range tests {
+		got := tt.rule.Apply(decimal.RequireFromString(tt.amount))
+		if !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("%+v.Apply(%s) = %s, want %s", tt.rule, tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeCurrency(t *testing.T) {
+	tests := []struct {
+		name      string
+		supported []string
+		currency  string
+		want      string
+		wantErr   bool
+	}{
+		{"any currency", nil, " eur ", "EUR", false},
+		{"unknown code", nil, "ABC", "", true},
+		{"supported", []string{"usd", "EUR"}, "usd", "USD", false},
+		{"unsupported", []string{"USD", "EUR"}, "JPY", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConverter(nil, tt.supported, nil, RoundingRule{Scale: 2})
+			got, err := c.NormalizeCurrency(tt.currency)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("NormalizeCurrency(%q) = %q, %v; want %q, error %v", tt.currency, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	c := NewConverter(nil, nil, map[string]RoundingRule{
+		"jpy": {Scale: 0, Mode: RoundHalfUp},
+		"CHF": {Scale: 2, Mode: RoundUp},
+	}, RoundingRule{Scale: 2, Mode: RoundHalfEven})
+	c.rates[currencyPair{"USD", "EUR"}] = decimal.RequireFromString("0.9")
+	c.rates[currencyPair{"USD", "JPY"}] = decimal.RequireFromString("151.237")
+	c.rates[currencyPair{"EUR", "CHF"}] = decimal.RequireFromString("0.96")
+	c.rates[currencyPair{"GBP", "USD"}] = decimal.RequireFromString("1.25")
+	c.rates[currencyPair{"XAU", "USD"}] = decimal.Zero
+
+	tests := []struct {
+		name     string
+		amount   string
+		from, to string
+		want     string
+		wantErr  bool
+	}{
+		{"same currency is not rounded", "1.005", "USD", "USD", "1.005", false},
+		{"direct rate", "10", "USD", "EUR", "9", false},
+		{"default rule rounds half to even", "0.25", "USD", "EUR", "0.22", false},
+		{"currency rule with no decimals", "19.99", "USD", "JPY", "3023", false},
+		{"currency rule rounding up", "10.01", "EUR", "CHF", "9.61", false},
+		{"inverse rate", "10", "USD", "GBP", "8", false},
+		{"inverse of a zero rate", "10", "USD", "XAU", "", true},
+		{"inverse rate rounded", "10", "EUR", "USD", "11.11", false},
+		{"no rate", "10", "EUR", "JPY", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Convert(decimal.RequireFromString(tt.amount), tt.from, tt.to)
+			if tt.wantErr {
+				if !errors.Is(err, ErrNoExchangeRate) {
+					t.Fatalf("Convert = %s, %v; want ErrNoExchangeRate", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			if !got.Equal(decimal.RequireFromString(tt.want)) {
+				t.Errorf("Convert(%s %s to %s) = %s, want %s", tt.amount, tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package producttypes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func ptr(f float64) *float64 { return &f }
+
+var furniture = &pb.ProductType{
+	Name: "furniture",
+	Attributes: []*pb.AttributeDefinition{
+		{Name: "material", Type: pb.AttributeType_ATTRIBUTE_STRING, Required: true, AllowedValues: []string{"oak", "pine"}},
+		{Name: "width_cm", Type: pb.AttributeType_ATTRIBUTE_NUMBER, Min: ptr(1), Max: ptr(500)},
+		{Name: "drawers", Type: pb.AttributeType_ATTRIBUTE_INTEGER, Min: ptr(0)},
+		{Name: "assembled", Type: pb.AttributeType_ATTRIBUTE_BOOLEAN},
+		{Name: "designer", Type: pb.AttributeType_ATTRIBUTE_STRING},
+	},
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes map[string]interface{}
+		valid      bool
+	}{
+		{"required only", map[string]interface{}{"material": "oak"}, true},
+		{"all attributes", map[string]interface{}{"material": "pine", "width_cm": 120.5, "drawers": 3.0, "assembled": true, "designer": "anyone"}, true},
+		{"bounds inclusive", map[string]interface{}{"material": "oak", "width_cm": 500.0, "drawers": 0.0}, true},
+		{"null optional", map[string]interface{}{"material": "oak", "designer": nil}, true},
+		{"missing required", map[string]interface{}{"width_cm": 10.0}, false},
+		{"null required", map[string]interface{}{"material": nil}, false},
+		{"value not allowed", map[string]interface{}{"material": "steel"}, false},
+		{"unknown attribute", map[string]interface{}{"material": "oak", "color": "red"}, false},
+		{"string for a number", map[string]interface{}{"material": "oak", "width_cm": "120"}, false},
+		{"below min", map[string]interface{}{"material": "oak", "width_cm": 0.5}, false},
+		{"above max", map[string]interface{}{"material": "oak", "width_cm": 501.0}, false},
+		{"fraction for an integer", map[string]interface{}{"material": "oak", "drawers": 1.5}, false},
+		{"number for a boolean", map[string]interface{}{"material": "oak", "assembled": 1.0}, false},
+		{"number for a string", map[string]interface{}{"material": "oak", "designer": 7.0}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(furniture, tt.attributes)
+			if tt.valid {
+				if err != nil {
+					t.Errorf("Check: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidAttributes) {
+				t.Errorf("Check error = %v, want ErrInvalidAttributes", err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		productType *pb.ProductType
+		valid       bool
+	}{
+		{"well formed", furniture, true},
+		{"no attributes", &pb.ProductType{Name: "gift_card"}, true},
+		{"uppercase name", &pb.ProductType{Name: "Furniture"}, false},
+		{"name starting with a digit", &pb.ProductType{Name: "3d_print"}, false},
+		{"empty name", &pb.ProductType{}, false},
+		{"invalid attribute name", &pb.ProductType{Name: "t", Attributes: []*pb.AttributeDefinition{{Name: "Width", Type: pb.AttributeType_ATTRIBUTE_NUMBER}}}, false},
+		{"attribute twice", &pb.ProductType{Name: "t", Attributes: []*pb.AttributeDefinition{
+			{Name: "width", Type: pb.AttributeType_ATTRIBUTE_NUMBER},
+			{Name: "width", Type: pb.AttributeType_ATTRIBUTE_STRING},
+		}}, false},
+		{"attribute without a type", &pb.ProductType{Name: "t", Attributes: []*pb.AttributeDefinition{{Name: "width"}}}, false},
+		{"allowed values for a number", &pb.ProductType{Name: "t", Attributes: []*pb.AttributeDefinition{{Name: "width", Type: pb.AttributeType_ATTRIBUTE_NUMBER, AllowedValues: []string{"1"}}}}, false},
+		{"bounds for a string", &pb.ProductType{Name: "t", Attributes: []*pb.AttributeDefinition{{Name: "color", Type: pb.AttributeType_ATTRIBUTE_STRING, Min: ptr(1)}}}, false},
+		{"min above max", &pb.ProductType{Name: "t", Attributes: []*pb.AttributeDefinition{{Name: "width", Type: pb.AttributeType_ATTRIBUTE_INTEGER, Min: ptr(5), Max: ptr(1)}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.productType)
+			if tt.valid {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidType) {
+				t.Errorf("Validate error = %v, want ErrInvalidType", err)
+			}
+		})
+	}
+}
+
+func TestVariationRoundTrip(t *testing.T) {
+	attributes, err := structpb.NewStruct(map[string]interface{}{"material": "oak", "width_cm": 120.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		productType string
+		variation   Variation
+	}{
+		{"clothing", "clothing", Variation{Message: &pb.ClothingVariation{Size: "M", Color: "red"}}},
+		{"electronics", "electronics", Variation{Message: &pb.ElectronicsVariation{Model: "X1", Voltage: 230, HasWarranty: true}}},
+		{"food with zero values", "food", Variation{Message: &pb.FoodVariation{}}},
+		{"registered type", "furniture", Variation{Attributes: attributes}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.variation.Encode()
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			decoded, err := Decode(tt.productType, data)
+			if err != nil {
+				t.Fatalf("Decode(%s): %v", data, err)
+			}
+			if decoded.Type != tt.productType {
+				t.Errorf("Type = %q, want %q", decoded.Type, tt.productType)
+			}
+			if tt.variation.Message != nil && !proto.Equal(decoded.Message, tt.variation.Message) {
+				t.Errorf("Message = %v, want %v", decoded.Message, tt.variation.Message)
+			}
+			if tt.variation.Attributes != nil && !proto.Equal(decoded.Attributes, tt.variation.Attributes) {
+				t.Errorf("Attributes = %v, want %v", decoded.Attributes, tt.variation.Attributes)
+			}
+			if decoded.Attributes == nil {
+				t.Error("Attributes unset")
+			}
+		})
+	}
+}
+
+func TestEncodeMessageIncludesZeroValues(t *testing.T) {
+	data, err := EncodeMessage(&pb.FoodVariation{Ingredients: "oats"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attributes structpb.Struct
+	if err := protojson.Unmarshal(data, &attributes); err != nil {
+		t.Fatal(err)
+	}
+	fields := attributes.AsMap()
+	for _, name := range []string{"ingredients", "calories", "is_vegetarian"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("encoding %s lacks %s", data, name)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		productType string
+		data        string
+		wantErr     bool
+	}{
+		{"no type and no variation", "", "", false},
+		{"no type and empty object", "", "{}", false},
+		{"no type and null", "", "null", false},
+		{"no type but a variation", "", `{"size": "M"}`, true},
+		{"legacy wrapper rejected", "clothing", `{"Clothing": {"size": "M"}}`, true},
+		{"unknown field rejected", "clothing", `{"size": "M", "fabric": "silk"}`, true},
+		{"malformed", "furniture", `{"material":`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(tt.productType, []byte(tt.data))
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnparsableVariation) {
+					t.Errorf("Decode error = %v, want ErrUnparsableVariation", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Decode: %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeAny(t *testing.T) {
+	tests := []struct {
+		name        string
+		productType string
+		category    string
+		data        string
+		want        proto.Message
+		wantErr     bool
+	}{
+		{"canonical", "clothing", "", `{"size": "M", "color": "red", "material": ""}`, &pb.ClothingVariation{Size: "M", Color: "red"}, false},
+		{"go oneof wrapper", "", "", `{"Clothing": {"size": "M", "color": "red"}}`, &pb.ClothingVariation{Size: "M", Color: "red"}, false},
+		{"lowercase wrapper", "", "", `{"electronics": {"model": "X1", "voltage": 110}}`, &pb.ElectronicsVariation{Model: "X1", Voltage: 110}, false},
+		{"bare message typed by product type", "food", "", `{"calories": 250, "isVegetarian": true}`, &pb.FoodVariation{Calories: 250, IsVegetarian: true}, false},
+		{"bare message typed by category", "", "Food", `{"ingredients": "oats"}`, &pb.FoodVariation{Ingredients: "oats"}, false},
+		{"type unknown", "", "garden", `{"ingredients": "oats"}`, nil, true},
+		{"not json", "clothing", "", `size=M`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variation, err := DecodeAny(tt.productType, tt.category, []byte(tt.data))
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnparsableVariation) {
+					t.Errorf("DecodeAny error = %v, want ErrUnparsableVariation", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeAny: %v", err)
+			}
+			if !proto.Equal(variation.Message, tt.want) {
+				t.Errorf("Message = %v, want %v", variation.Message, tt.want)
+			}
+			// Decoded legacy rows encode canonically.
+			data, err := variation.Encode()
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if _, err := Decode(variation.Type, data); err != nil {
+				t.Errorf("Decode of the re-encoded variation %s: %v", data, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package producttypes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/database"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	// ErrUnknownType is returned for product types that are not registered.
+	ErrUnknownType = errors.New("unknown product type")
+	// ErrInvalidType is returned when a product type definition is malformed.
+	ErrInvalidType = errors.New("invalid product type")
+	// ErrInvalidAttributes is returned when attributes do not match the
+	// schema of their product type.
+	ErrInvalidAttributes = errors.New("invalid attributes")
+)
+
+// identifier is the format of type and attribute names. Attribute names are
+// JSON keys of the variation column and of variant filters.
+var identifier = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+var definitionMarshaler = protojson.MarshalOptions{UseProtoNames: true}
+
+// Registry stores product types and their attribute schemas in the
+// product_types table.
+type Registry struct {
+	pool database.Pool
+}
+
+// NewRegistry returns a Registry.
+func NewRegistry(pool database.Pool) *Registry {
+	return &Registry{pool: pool}
+}
+
+const columns = `name, description, attributes, created_at, updated_at`
+
+func scan(row pgx.Row) (*pb.ProductType, error) {
+	var (
+		productType          pb.ProductType
+		attributes           []json.RawMessage
+		createdAt, updatedAt time.Time
+	)
+	if err := row.Scan(&productType.Name, &productType.Description, &attributes, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	for _, raw := range attributes {
+		var definition pb.AttributeDefinition
+		if err := protojson.Unmarshal(raw, &definition); err != nil {
+			return nil, fmt.Errorf("invalid stored attribute of type %s: %w", productType.Name, err)
+		}
+		productType.Attributes = append(productType.Attributes, &definition)
+	}
+	productType.CreatedAt = timestamppb.New(createdAt)
+	productType.UpdatedAt = timestamppb.New(updatedAt)
+	return &productType, nil
+}
+
+// Define validates productType and creates or replaces it. Built-in types
+// cannot be redefined, since their schema is that of their proto message, and
+// attributes cannot become required while products of the type lack them.
+func (r *Registry) Define(ctx context.Context, productType *pb.ProductType) (*pb.ProductType, error) {
+	if IsBuiltin(productType.GetName()) {
+		return nil, fmt.Errorf("%w: %s is built in and cannot be redefined", ErrInvalidType, productType.GetName())
+	}
+	if err := Validate(productType); err != nil {
+		return nil, err
+	}
+
+	attributes := make([]json.RawMessage, 0, len(productType.GetAttributes()))
+	for _, definition := range productType.GetAttributes() {
+		raw, err := definitionMarshaler.Marshal(definition)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode attribute %s: %w", definition.GetName(), err)
+		}
+		attributes = append(attributes, raw)
+	}
+
+	query := `
+	INSERT INTO product_types (name, description, attributes)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (name) DO UPDATE SET
+		description = excluded.description,
+		attributes = excluded.attributes,
+		updated_at = now()
+	RETURNING ` + columns
+	var defined *pb.ProductType
+	err := database.ExecuteTx(ctx, r.pool, func(tx pgx.Tx) error {
+		if err := checkRequired(ctx, tx, productType); err != nil {
+			return err
+		}
+		var err error
+		defined, err = scan(tx.QueryRow(ctx, query, productType.GetName(), productType.GetDescription(), attributes))
+		return err
+	})
+	if errors.Is(err, ErrInvalidType) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to define product type: %w", err)
+	}
+	return defined, nil
+}
+
+// checkRequired rejects a redefinition that makes attributes required which
+// existing products of the type lack. Products of the type written
+// concurrently conflict with the serializable transaction reading them.
+func checkRequired(ctx context.Context, tx pgx.Tx, productType *pb.ProductType) error {
+	current, err := scan(tx.QueryRow(ctx, `SELECT `+columns+` FROM product_types WHERE name = $1 FOR UPDATE`, productType.GetName()))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	required := make(map[string]bool, len(current.GetAttributes()))
+	for _, definition := range current.GetAttributes() {
+		required[definition.GetName()] = definition.GetRequired()
+	}
+
+	for _, definition := range productType.GetAttributes() {
+		name := definition.GetName()
+		if !definition.GetRequired() || required[name] {
+			continue
+		}
+		var lacking int64
+		err := tx.QueryRow(ctx, `
+		SELECT count(*) FROM products
+		WHERE product_type = $1 AND COALESCE(jsonb_typeof(variation->$2), 'null') = 'null'`, productType.GetName(), name).Scan(&lacking)
+		if err != nil {
+			return fmt.Errorf("failed to check attribute %s: %w", name, err)
+		}
+		if lacking > 0 {
+			return fmt.Errorf("%w: attribute %s cannot become required, %d products of type %s lack it", ErrInvalidType, name, lacking, productType.GetName())
+		}
+	}
+	return nil
+}
+
+// Get returns the product type called name.
+func (r *Registry) Get(ctx context.Context, name string) (*pb.ProductType, error) {
+	productType, err := scan(r.pool.QueryRow(ctx, `SELECT `+columns+` FROM product_types WHERE name = $1`, name))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownType, name)
+		}
+		return nil, fmt.Errorf("failed to read product type: %w", err)
+	}
+	return productType, nil
+}
+
+// List returns every product type ordered by name.
+func (r *Registry) List(ctx context.Context) ([]*pb.ProductType, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+columns+` FROM product_types ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list product types: %w", err)
+	}
+	productTypes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*pb.ProductType, error) {
+		return scan(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list product types: %w", err)
+	}
+	return productTypes, nil
+}
+
+// ValidateAttributes checks attributes against the schema of the product
+// type called name.
+func (r *Registry) ValidateAttributes(ctx context.Context, name string, attributes map[string]interface{}) error {
+	productType, err := r.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	return Check(productType, attributes)
+}
+
+// Validate checks that a product type definition is well formed.
+func Validate(productType *pb.ProductType) error {
+	if !identifier.MatchString(productType.GetName()) {
+		return fmt.Errorf("%w: name must be a lowercase identifier", ErrInvalidType)
+	}
+	seen := make(map[string]bool, len(productType.GetAttributes()))
+	for _, definition := range productType.GetAttributes() {
+		name := definition.GetName()
+		if !identifier.MatchString(name) {
+			return fmt.Errorf("%w: attribute name %q must be a lowercase identifier", ErrInvalidType, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("%w: attribute %s is defined twice", ErrInvalidType, name)
+		}
+		seen[name] = true
+
+		numeric := definition.GetType() == pb.AttributeType_ATTRIBUTE_NUMBER || definition.GetType() == pb.AttributeType_ATTRIBUTE_INTEGER
+		switch {
+		case definition.GetType() == pb.AttributeType_ATTRIBUTE_TYPE_UNSPECIFIED:
+			return fmt.Errorf("%w: attribute %s has no type", ErrInvalidType, name)
+		case len(definition.GetAllowedValues()) > 0 && definition.GetType() != pb.AttributeType_ATTRIBUTE_STRING:
+			return fmt.Errorf("%w: attribute %s can only list allowed values for strings", ErrInvalidType, name)
+		case (definition.Min != nil || definition.Max != nil) && !numeric:
+			return fmt.Errorf("%w: attribute %s can only have bounds for numbers", ErrInvalidType, name)
+		case definition.Min != nil && definition.Max != nil && definition.GetMin() > definition.GetMax():
+			return fmt.Errorf("%w: attribute %s has min above max", ErrInvalidType, name)
+		}
+	}
+	return nil
+}
+
+// Check validates attributes, as decoded from JSON, against productType.
+// Unknown attributes are rejected, and a null value counts as missing.
+func Check(productType *pb.ProductType, attributes map[string]interface{}) error {
+	definitions := make(map[string]*pb.AttributeDefinition, len(productType.GetAttributes()))
+	for _, definition := range productType.GetAttributes() {
+		definitions[definition.GetName()] = definition
+	}
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := definitions[name]; !ok {
+			return fmt.Errorf("%w: %s has no attribute %s", ErrInvalidAttributes, productType.GetName(), name)
+		}
+	}
+
+	for _, definition := range productType.GetAttributes() {
+		value := attributes[definition.GetName()]
+		if value == nil {
+			if definition.GetRequired() {
+				return fmt.Errorf("%w: %s is required", ErrInvalidAttributes, definition.GetName())
+			}
+			continue
+		}
+		if err := checkValue(definition, value); err != nil {
+			return fmt.Errorf("%w: %s %v", ErrInvalidAttributes, definition.GetName(), err)
+		}
+	}
+	return nil
+}
+
+func checkValue(definition *pb.AttributeDefinition, value interface{}) error {
+	switch definition.GetType() {
+	case pb.AttributeType_ATTRIBUTE_STRING:
+		s, ok := value.(string)
+		if !ok {
+			return errors.New("must be a string")
+		}
+		if allowed := definition.GetAllowedValues(); len(allowed) > 0 && !slices.Contains(allowed, s) {
+			return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+		}
+	case pb.AttributeType_ATTRIBUTE_BOOLEAN:
+		if _, ok := value.(bool); !ok {
+			return errors.New("must be a boolean")
+		}
+	case pb.AttributeType_ATTRIBUTE_NUMBER, pb.AttributeType_ATTRIBUTE_INTEGER:
+		n, ok := value.(float64)
+		if !ok {
+			return errors.New("must be a number")
+		}
+		if definition.GetType() == pb.AttributeType_ATTRIBUTE_INTEGER && n != math.Trunc(n) {
+			return errors.New("must be an integer")
+		}
+		if definition.Min != nil && n < definition.GetMin() {
+			return fmt.Errorf("must be at least %v", definition.GetMin())
+		}
+		if definition.Max != nil && n > definition.GetMax() {
+			return fmt.Errorf("must be at most %v", definition.GetMax())
+		}
+	}
+	return nil
+}
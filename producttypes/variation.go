@@ -0,0 +1,182 @@
+package producttypes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrUnparsableVariation is returned for variation JSON that is in neither
+// the canonical nor any legacy encoding.
+var ErrUnparsableVariation = errors.New("unparsable variation")
+
+// The canonical encoding of the variation column is a flat JSON object of
+// attributes, named by the product_type column. Built-in types are encoded
+// with protojson using proto field names and zero values included, so every
+// attribute is present and their rows can be filtered like any other type.
+var (
+	variationMarshaler   = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+	variationUnmarshaler = protojson.UnmarshalOptions{}
+)
+
+// Variation is a decoded variation column.
+type Variation struct {
+	// Type is the product type, empty when the product has none.
+	Type string
+	// Message is set for built-in types, which have a proto message.
+	Message proto.Message
+	// Attributes is set for every type.
+	Attributes *structpb.Struct
+}
+
+// IsBuiltin reports whether productType has a message in the variation oneof.
+func IsBuiltin(productType string) bool {
+	return newMessage(productType) != nil
+}
+
+func newMessage(productType string) proto.Message {
+	switch productType {
+	case "clothing":
+		return &pb.ClothingVariation{}
+	case "electronics":
+		return &pb.ElectronicsVariation{}
+	case "food":
+		return &pb.FoodVariation{}
+	default:
+		return nil
+	}
+}
+
+// EncodeMessage returns the canonical encoding of a built-in variation.
+func EncodeMessage(message proto.Message) ([]byte, error) {
+	return variationMarshaler.Marshal(message)
+}
+
+// EncodeAttributes returns the canonical encoding of attributes.
+func EncodeAttributes(attributes *structpb.Struct) ([]byte, error) {
+	if attributes == nil {
+		return []byte("{}"), nil
+	}
+	return protojson.Marshal(attributes)
+}
+
+// Decode decodes a variation column in the canonical encoding. Unknown fields
+// of built-in types are rejected, so legacy rows fail to decode.
+func Decode(productType string, data []byte) (Variation, error) {
+	if productType == "" {
+		if !isEmpty(data) {
+			return Variation{}, fmt.Errorf("%w: variation without a product type", ErrUnparsableVariation)
+		}
+		return Variation{}, nil
+	}
+
+	variation := Variation{Type: productType}
+	if message := newMessage(productType); message != nil {
+		if err := variationUnmarshaler.Unmarshal(data, message); err != nil {
+			return Variation{}, fmt.Errorf("%w: %v", ErrUnparsableVariation, err)
+		}
+		variation.Message = message
+		attributes, err := MessageAttributes(message)
+		if err != nil {
+			return Variation{}, err
+		}
+		variation.Attributes = attributes
+		return variation, nil
+	}
+
+	var attributes structpb.Struct
+	if err := protojson.Unmarshal(data, &attributes); err != nil {
+		return Variation{}, fmt.Errorf("%w: %v", ErrUnparsableVariation, err)
+	}
+	variation.Attributes = &attributes
+	return variation, nil
+}
+
+// DecodeLegacy decodes a variation column written before the canonical
+// encoding: the Go oneof wrapper json.Marshal produced, e.g.
+// {"Clothing": {...}}, the same with lowercase keys, or a bare message whose
+// type follows from productType or, failing that, from category.
+func DecodeLegacy(productType, category string, data []byte) (Variation, error) {
+	if isEmpty(data) {
+		return Variation{}, nil
+	}
+
+	var wrapper map[string]json.RawMessage
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		return Variation{}, fmt.Errorf("%w: %v", ErrUnparsableVariation, err)
+	}
+	if len(wrapper) == 1 {
+		for key, inner := range wrapper {
+			if kind := strings.ToLower(key); IsBuiltin(kind) {
+				return decodeLenient(kind, inner)
+			}
+		}
+	}
+
+	for _, kind := range []string{productType, strings.ToLower(category)} {
+		if IsBuiltin(kind) {
+			return decodeLenient(kind, data)
+		}
+	}
+	return Variation{}, fmt.Errorf("%w: cannot tell the product type of %s", ErrUnparsableVariation, data)
+}
+
+// decodeLenient decodes a bare built-in message in any JSON naming.
+func decodeLenient(productType string, data []byte) (Variation, error) {
+	message := newMessage(productType)
+	if err := variationUnmarshaler.Unmarshal(data, message); err != nil {
+		return Variation{}, fmt.Errorf("%w: %s: %v", ErrUnparsableVariation, productType, err)
+	}
+	attributes, err := MessageAttributes(message)
+	if err != nil {
+		return Variation{}, err
+	}
+	return Variation{Type: productType, Message: message, Attributes: attributes}, nil
+}
+
+// DecodeAny decodes a variation column in the canonical encoding, falling
+// back to the legacy ones for rows that have not been migrated yet.
+func DecodeAny(productType, category string, data []byte) (Variation, error) {
+	variation, err := Decode(productType, data)
+	if err == nil {
+		return variation, nil
+	}
+	legacy, legacyErr := DecodeLegacy(productType, category, data)
+	if legacyErr != nil {
+		return Variation{}, err
+	}
+	return legacy, nil
+}
+
+// MessageAttributes returns the fields of a built-in variation as attributes.
+func MessageAttributes(message proto.Message) (*structpb.Struct, error) {
+	data, err := EncodeMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	var attributes structpb.Struct
+	if err := protojson.Unmarshal(data, &attributes); err != nil {
+		return nil, err
+	}
+	return &attributes, nil
+}
+
+func isEmpty(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) || bytes.Equal(trimmed, []byte("{}"))
+}
+
+// Encode returns the canonical encoding of v.
+func (v Variation) Encode() ([]byte, error) {
+	if v.Message != nil {
+		return EncodeMessage(v.Message)
+	}
+	return EncodeAttributes(v.Attributes)
+}
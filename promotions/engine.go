@@ -0,0 +1,235 @@
+package promotions
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/money"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pricing"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/tags"
+)
+
+// rule is a promotion compiled for evaluation.
+type rule struct {
+	id         int64
+	percentage decimal.Decimal
+	amountOff  decimal.Decimal
+	currency   string
+	categories map[string]bool
+	tags       map[string]bool
+	products   map[int64]bool
+	stackable  bool
+	startsAt   time.Time
+	endsAt     time.Time // zero when open-ended
+}
+
+func compile(promotion *pb.Promotion) (rule, error) {
+	r := rule{
+		id:         promotion.GetId(),
+		categories: make(map[string]bool, len(promotion.GetCategories())),
+		tags:       make(map[string]bool, len(promotion.GetTags())),
+		products:   make(map[int64]bool, len(promotion.GetProductIds())),
+		stackable:  promotion.GetStackable(),
+	}
+	if promotion.GetDiscountType() == pb.DiscountType_PERCENTAGE {
+		percentage, err := decimal.NewFromString(promotion.GetPercentage())
+		if err != nil {
+			return rule{}, fmt.Errorf("promotion %d: invalid percentage %q", promotion.GetId(), promotion.GetPercentage())
+		}
+		r.percentage = percentage
+	} else {
+		r.amountOff = money.ToDecimal(promotion.GetAmountOff())
+		r.currency = promotion.GetAmountOff().GetCurrencyCode()
+	}
+	for _, category := range promotion.GetCategories() {
+		r.categories[category] = true
+	}
+	for _, tag := range promotion.GetTags() {
+		r.tags[tag] = true
+	}
+	for _, id := range promotion.GetProductIds() {
+		r.products[id] = true
+	}
+	if promotion.GetStartsAt() != nil {
+		r.startsAt = promotion.GetStartsAt().AsTime()
+	}
+	if promotion.GetEndsAt() != nil {
+		r.endsAt = promotion.GetEndsAt().AsTime()
+	}
+	return r, nil
+}
+
+func (r rule) running(now time.Time) bool {
+	return !now.Before(r.startsAt) && (r.endsAt.IsZero() || now.Before(r.endsAt))
+}
+
+func (r rule) matches(product *pb.Product) bool {
+	if r.products[product.GetId()] || r.categories[strings.ToLower(product.GetCategory())] {
+		return true
+	}
+	for _, tag := range product.GetTags() {
+		if r.tags[tags.Normalize(tag)] {
+			return true
+		}
+	}
+	return false
+}
+
+// discount returns how much the rule takes off price, at most price itself.
+func (r rule) discount(converter *pricing.Converter, price decimal.Decimal, currency string) (decimal.Decimal, error) {
+	var off decimal.Decimal
+	if r.currency == "" {
+		off = converter.Round(price.Mul(r.percentage).Div(hundred), currency)
+	} else {
+		converted, err := converter.Convert(r.amountOff, r.currency, currency)
+		if err != nil {
+			return decimal.Zero, err
+		}
+		off = converted
+	}
+	return decimal.Min(off, price), nil
+}
+
+// Engine evaluates promotions against products. Promotions that have not
+// ended are kept in memory and reloaded periodically.
+type Engine struct {
+	pool      *pgxpool.Pool
+	converter *pricing.Converter
+
+	mu    sync.RWMutex
+	rules []rule
+}
+
+// NewEngine returns an Engine. Fixed amounts are converted to the product's
+// currency and all discounts are rounded with converter.
+func NewEngine(pool *pgxpool.Pool, converter *pricing.Converter) *Engine {
+	return &Engine{pool: pool, converter: converter}
+}
+
+// Refresh reloads every promotion that has not ended.
+func (e *Engine) Refresh(ctx context.Context) error {
+	query := `SELECT ` + Columns + ` FROM promotions WHERE ends_at IS NULL OR ends_at > now() ORDER BY id`
+	rows, err := e.pool.Query(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to load promotions: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []rule
+	for rows.Next() {
+		promotion, err := Scan(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan promotion: %w", err)
+		}
+		r, err := compile(promotion)
+		if err != nil {
+			slog.Warn("skipping invalid promotion", "error", err)
+			continue
+		}
+		rules = append(rules, r)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load promotions: %w", err)
+	}
+
+	e.mu.Lock()
+	e.rules = rules
+	e.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the promotions every interval until ctx is cancelled.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Refresh(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("failed to refresh promotions", "error", err)
+			}
+		}
+	}
+}
+
+// Evaluate sets product.Sale from the promotions running at now, and the
+// Sale of every variant with a price of its own. The non-stackable promotion
+// with the largest discount applies first, then every stackable one in id
+// order, each on the already discounted price. Promotions whose amount cannot
+// be converted to the currency of the price are skipped.
+func (e *Engine) Evaluate(product *pb.Product, now time.Time) {
+	e.mu.RLock()
+	var matching []rule
+	for _, r := range e.rules {
+		if r.running(now) && r.matches(product) {
+			matching = append(matching, r)
+		}
+	}
+	e.mu.RUnlock()
+
+	if product.GetPriceMoney() != nil {
+		product.Sale = e.sale(matching, product.GetPriceMoney())
+	}
+	for _, variant := range product.GetVariants() {
+		if variant.GetPrice() != nil {
+			variant.Sale = e.sale(matching, variant.GetPrice())
+		}
+	}
+}
+
+// sale applies the matching rules to original.
+func (e *Engine) sale(matching []rule, original *pb.Money) *pb.SalePrice {
+	currency := original.GetCurrencyCode()
+	price := money.ToDecimal(original)
+
+	var (
+		best         *rule
+		bestDiscount decimal.Decimal
+		stackable    []rule
+	)
+	for i := range matching {
+		r := matching[i]
+		if r.stackable {
+			stackable = append(stackable, r)
+			continue
+		}
+		off, err := r.discount(e.converter, price, currency)
+		if err != nil {
+			slog.Debug("skipping promotion", "promotion_id", r.id, "error", err)
+			continue
+		}
+		if best == nil || off.GreaterThan(bestDiscount) {
+			best, bestDiscount = &matching[i], off
+		}
+	}
+
+	sale := &pb.SalePrice{OriginalPrice: money.FromDecimal(price, currency)}
+	if best != nil {
+		price = price.Sub(bestDiscount)
+		sale.PromotionIds = append(sale.PromotionIds, best.id)
+	}
+	for _, r := range stackable {
+		off, err := r.discount(e.converter, price, currency)
+		if err != nil {
+			slog.Debug("skipping promotion", "promotion_id", r.id, "error", err)
+			continue
+		}
+		price = price.Sub(off)
+		sale.PromotionIds = append(sale.PromotionIds, r.id)
+	}
+	sale.DiscountedPrice = money.FromDecimal(price, currency)
+	return sale
+}
@@ -0,0 +1,187 @@
+package promotions
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/money"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pricing"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func percentOff(id int64, percentage string, categories ...string) *pb.Promotion {
+	return &pb.Promotion{Id: id, DiscountType: pb.DiscountType_PERCENTAGE, Percentage: percentage, Categories: categories}
+}
+
+func amountOff(id int64, amount string, currency string, categories ...string) *pb.Promotion {
+	return &pb.Promotion{
+		Id:           id,
+		DiscountType: pb.DiscountType_FIXED_AMOUNT,
+		AmountOff:    money.FromDecimal(decimal.RequireFromString(amount), currency),
+		Categories:   categories,
+	}
+}
+
+func stackable(promotion *pb.Promotion) *pb.Promotion {
+	promotion.Stackable = true
+	return promotion
+}
+
+func newTestEngine(t *testing.T, promotions ...*pb.Promotion) *Engine {
+	t.Helper()
+	e := NewEngine(nil, pricing.NewConverter(nil, nil, nil, pricing.RoundingRule{Scale: 2, Mode: pricing.RoundHalfUp}))
+	for _, promotion := range promotions {
+		r, err := compile(promotion)
+		if err != nil {
+			t.Fatalf("compile(%v): %v", promotion, err)
+		}
+		e.rules = append(e.rules, r)
+	}
+	return e
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name       string
+		promotions []*pb.Promotion
+		price      string
+		want       string
+		wantIDs    []int64
+	}{
+		{
+			name:  "no promotions",
+			price: "100",
+			want:  "100",
+		},
+		{
+			name:       "percentage",
+			promotions: []*pb.Promotion{percentOff(1, "10", "shoes")},
+			price:      "100",
+			want:       "90",
+			wantIDs:    []int64{1},
+		},
+		{
+			name:       "percentage rounded",
+			promotions: []*pb.Promotion{percentOff(1, "33.333", "shoes")},
+			price:      "10",
+			want:       "6.67",
+			wantIDs:    []int64{1},
+		},
+		{
+			name:       "largest non-stackable discount wins",
+			promotions: []*pb.Promotion{percentOff(1, "10", "shoes"), amountOff(2, "15", "USD", "shoes"), percentOff(3, "5", "shoes")},
+			price:      "100",
+			want:       "85",
+			wantIDs:    []int64{2},
+		},
+		{
+			name:       "stackable promotions apply to the discounted price",
+			promotions: []*pb.Promotion{percentOff(1, "10", "shoes"), stackable(percentOff(2, "10", "shoes")), stackable(amountOff(3, "1", "USD", "shoes"))},
+			price:      "100",
+			want:       "80",
+			wantIDs:    []int64{1, 2, 3},
+		},
+		{
+			name:       "discount capped at the price",
+			promotions: []*pb.Promotion{amountOff(1, "150", "USD", "shoes"), stackable(amountOff(2, "5", "USD", "shoes"))},
+			price:      "100",
+			want:       "0",
+			wantIDs:    []int64{1, 2},
+		},
+		{
+			name:       "amount without an exchange rate skipped",
+			promotions: []*pb.Promotion{amountOff(1, "50", "EUR", "shoes"), percentOff(2, "10", "shoes")},
+			price:      "100",
+			want:       "90",
+			wantIDs:    []int64{2},
+		},
+		{
+			name:       "other category",
+			promotions: []*pb.Promotion{percentOff(1, "10", "hats")},
+			price:      "100",
+			want:       "100",
+		},
+		{
+			name:       "normalized tag",
+			promotions: []*pb.Promotion{{Id: 1, Percentage: "20", Tags: []string{"summer sale"}}},
+			price:      "100",
+			want:       "80",
+			wantIDs:    []int64{1},
+		},
+		{
+			name:       "listed product",
+			promotions: []*pb.Promotion{{Id: 1, Percentage: "20", ProductIds: []int64{7}}},
+			price:      "100",
+			want:       "80",
+			wantIDs:    []int64{1},
+		},
+		{
+			name: "not running",
+			promotions: []*pb.Promotion{
+				{Id: 1, Percentage: "20", Categories: []string{"shoes"}, StartsAt: timestamppb.New(now.Add(time.Hour))},
+				{Id: 2, Percentage: "30", Categories: []string{"shoes"}, EndsAt: timestamppb.New(now)},
+				{Id: 3, Percentage: "10", Categories: []string{"shoes"}, StartsAt: timestamppb.New(now), EndsAt: timestamppb.New(now.Add(time.Second))},
+			},
+			price:   "100",
+			want:    "90",
+			wantIDs: []int64{3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t, tt.promotions...)
+			product := &pb.Product{
+				Id:         7,
+				Category:   "Shoes",
+				Tags:       []string{"Summer  Sale"},
+				PriceMoney: money.FromDecimal(decimal.RequireFromString(tt.price), "USD"),
+			}
+			e.Evaluate(product, now)
+
+			sale := product.GetSale()
+			if sale == nil {
+				t.Fatal("Evaluate left Sale unset")
+			}
+			if got := money.ToDecimal(sale.GetOriginalPrice()); !got.Equal(decimal.RequireFromString(tt.price)) {
+				t.Errorf("original price = %s, want %s", got, tt.price)
+			}
+			if got := money.ToDecimal(sale.GetDiscountedPrice()); !got.Equal(decimal.RequireFromString(tt.want)) || sale.GetDiscountedPrice().GetCurrencyCode() != "USD" {
+				t.Errorf("discounted price = %s %s, want %s USD", got, sale.GetDiscountedPrice().GetCurrencyCode(), tt.want)
+			}
+			if !slices.Equal(sale.GetPromotionIds(), tt.wantIDs) {
+				t.Errorf("promotion ids = %v, want %v", sale.GetPromotionIds(), tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestEvaluateVariants(t *testing.T) {
+	e := newTestEngine(t, percentOff(1, "50", "shoes"))
+	product := &pb.Product{
+		Category:   "shoes",
+		PriceMoney: money.FromDecimal(decimal.RequireFromString("100"), "USD"),
+		Variants: []*pb.ProductVariant{
+			{Id: 1, Price: money.FromDecimal(decimal.RequireFromString("120.50"), "USD")},
+			{Id: 2},
+		},
+	}
+	e.Evaluate(product, now)
+
+	if got := money.ToDecimal(product.GetVariants()[0].GetSale().GetDiscountedPrice()); !got.Equal(decimal.RequireFromString("60.25")) {
+		t.Errorf("variant with its own price sells at %s, want 60.25", got)
+	}
+	if sale := product.GetVariants()[1].GetSale(); sale != nil {
+		t.Errorf("variant without a price of its own has sale %v", sale)
+	}
+}
+
+func TestCompileInvalidPercentage(t *testing.T) {
+	if _, err := compile(&pb.Promotion{Id: 1, Percentage: "ten"}); err == nil {
+		t.Error("compile accepted a percentage that is not a decimal")
+	}
+}
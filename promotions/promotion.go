@@ -0,0 +1,123 @@
+package promotions
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/money"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/pb"
+	"github.com/yaninyzwitty/grpc-cocroach-microservice/tags"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Columns lists the promotions columns in the order Scan expects them.
+const Columns = `id, name, discount_type, percentage::STRING, amount_off::STRING, currency, categories, tags, product_ids, stackable, starts_at, ends_at, created_at, updated_at`
+
+var hundred = decimal.NewFromInt(100)
+
+// Scan reads a promotion selected with Columns.
+func Scan(row pgx.Row) (*pb.Promotion, error) {
+	var (
+		promotion            pb.Promotion
+		discountType         string
+		percentage, amount   *string
+		currency             *string
+		startsAt, endsAt     *time.Time
+		createdAt, updatedAt time.Time
+	)
+	err := row.Scan(
+		&promotion.Id,
+		&promotion.Name,
+		&discountType,
+		&percentage,
+		&amount,
+		&currency,
+		&promotion.Categories,
+		&promotion.Tags,
+		&promotion.ProductIds,
+		&promotion.Stackable,
+		&startsAt,
+		&endsAt,
+		&createdAt,
+		&updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := pb.DiscountType_value[discountType]
+	if !ok {
+		return nil, fmt.Errorf("invalid discount type %q", discountType)
+	}
+	promotion.DiscountType = pb.DiscountType(value)
+	if percentage != nil {
+		promotion.Percentage = *percentage
+	}
+	if amount != nil && currency != nil {
+		off, err := decimal.NewFromString(*amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored amount %q: %w", *amount, err)
+		}
+		promotion.AmountOff = money.FromDecimal(off, *currency)
+	}
+	if startsAt != nil {
+		promotion.StartsAt = timestamppb.New(*startsAt)
+	}
+	if endsAt != nil {
+		promotion.EndsAt = timestamppb.New(*endsAt)
+	}
+	promotion.CreatedAt = timestamppb.New(createdAt)
+	promotion.UpdatedAt = timestamppb.New(updatedAt)
+	return &promotion, nil
+}
+
+// Validate checks that a promotion can be stored and evaluated, and
+// normalizes its categories to lower case and its tags like product tags.
+func Validate(promotion *pb.Promotion) error {
+	if strings.TrimSpace(promotion.GetName()) == "" {
+		return errors.New("name is required")
+	}
+	if len(promotion.GetCategories()) == 0 && len(promotion.GetTags()) == 0 && len(promotion.GetProductIds()) == 0 {
+		return errors.New("at least one category, tag or product id is required")
+	}
+	if promotion.GetStartsAt() != nil && promotion.GetEndsAt() != nil && !promotion.GetEndsAt().AsTime().After(promotion.GetStartsAt().AsTime()) {
+		return errors.New("ends_at must be after starts_at")
+	}
+
+	switch promotion.GetDiscountType() {
+	case pb.DiscountType_PERCENTAGE:
+		percentage, err := decimal.NewFromString(promotion.GetPercentage())
+		if err != nil {
+			return fmt.Errorf("invalid percentage %q", promotion.GetPercentage())
+		}
+		if !percentage.IsPositive() || percentage.GreaterThan(hundred) {
+			return errors.New("percentage must be within (0, 100]")
+		}
+		promotion.AmountOff = nil
+	case pb.DiscountType_FIXED_AMOUNT:
+		if promotion.GetAmountOff() == nil {
+			return errors.New("amount_off is required")
+		}
+		if err := money.Validate(promotion.GetAmountOff()); err != nil {
+			return fmt.Errorf("invalid amount_off: %w", err)
+		}
+		if !money.ToDecimal(promotion.GetAmountOff()).IsPositive() {
+			return errors.New("amount_off must be positive")
+		}
+		promotion.Percentage = ""
+	default:
+		return fmt.Errorf("unknown discount type %v", promotion.GetDiscountType())
+	}
+
+	for i, category := range promotion.Categories {
+		promotion.Categories[i] = strings.ToLower(strings.TrimSpace(category))
+	}
+	for i, tag := range promotion.Tags {
+		promotion.Tags[i] = tags.Normalize(tag)
+	}
+	return nil
+}
@@ -1,4 +1,4 @@
-CREATE TABLE products (
+CREATE TABLE IF NOT EXISTS products (
     id BIGINT PRIMARY KEY,
     name VARCHAR(255) NOT NULL,
     description TEXT,
@@ -12,4 +12,382 @@ CREATE TABLE products (
     variation JSONB NOT NULL
 );
 
+CREATE TABLE IF NOT EXISTS product_events (
+    id BIGINT PRIMARY KEY DEFAULT unique_rowid(),
+    kind VARCHAR(64) NOT NULL,
+    product_id BIGINT NOT NULL,
+    payload JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX product_events_created_at_idx (created_at)
+);
+
+CREATE TABLE IF NOT EXISTS query_stats (
+    kind VARCHAR(32) NOT NULL,
+    query_key TEXT NOT NULL,
+    page_size INT NOT NULL DEFAULT 0,
+    hits BIGINT NOT NULL DEFAULT 0,
+    last_seen TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (kind, query_key, page_size)
+);
+
+-- Prices are exact DECIMAL amounts in the currency below, exposed as Money.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'USD';
+
+-- Explicit prices per currency, used instead of converting the base price.
+CREATE TABLE IF NOT EXISTS product_currency_prices (
+    product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    currency VARCHAR(3) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    PRIMARY KEY (product_id, currency)
+);
+
+-- One base_currency unit buys rate quote_currency units.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    base_currency VARCHAR(3) NOT NULL,
+    quote_currency VARCHAR(3) NOT NULL,
+    rate DECIMAL(20, 10) NOT NULL CHECK (rate > 0),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (base_currency, quote_currency)
+);
+
+-- Price history. The row with the latest effective_from whose range covers
+-- now is the effective price; products.price is used when there is none.
+-- applied_at and expired_at record when the scheduler announced the start
+-- and end of a range.
+CREATE TABLE IF NOT EXISTS product_prices (
+    id BIGINT PRIMARY KEY DEFAULT unique_rowid(),
+    product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    currency VARCHAR(3) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    effective_from TIMESTAMP WITH TIME ZONE NOT NULL,
+    effective_to TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    applied_at TIMESTAMP WITH TIME ZONE,
+    expired_at TIMESTAMP WITH TIME ZONE,
+    CHECK (effective_to IS NULL OR effective_to > effective_from),
+    INDEX product_prices_product_idx (product_id, effective_from DESC),
+    INDEX product_prices_pending_idx (effective_from) WHERE applied_at IS NULL,
+    INDEX product_prices_ending_idx (effective_to) WHERE expired_at IS NULL AND effective_to IS NOT NULL
+);
+
+-- Discounts on products matching any of categories, tags or product_ids.
+-- percentage is set for PERCENTAGE promotions, amount_off and currency for
+-- FIXED_AMOUNT ones.
+CREATE TABLE IF NOT EXISTS promotions (
+    id BIGINT PRIMARY KEY DEFAULT unique_rowid(),
+    name VARCHAR(255) NOT NULL,
+    discount_type VARCHAR(32) NOT NULL CHECK (discount_type IN ('PERCENTAGE', 'FIXED_AMOUNT')),
+    percentage DECIMAL(5, 2) CHECK (percentage > 0 AND percentage <= 100),
+    amount_off DECIMAL(10, 2) CHECK (amount_off > 0),
+    currency VARCHAR(3),
+    categories TEXT[] NOT NULL DEFAULT '{}',
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    product_ids BIGINT[] NOT NULL DEFAULT '{}',
+    stackable BOOL NOT NULL DEFAULT false,
+    starts_at TIMESTAMP WITH TIME ZONE,
+    ends_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at IS NULL OR starts_at IS NULL OR ends_at > starts_at),
+    INDEX promotions_ends_at_idx (ends_at)
+);
+
+-- Stock per product and warehouse. When a product has any rows here its
+-- IN_STOCK / OUT_OF_STOCK status is derived from the total available quantity.
+CREATE TABLE IF NOT EXISTS inventory_levels (
+    product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    warehouse_id VARCHAR(64) NOT NULL,
+    on_hand BIGINT NOT NULL DEFAULT 0 CHECK (on_hand >= 0),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (product_id, warehouse_id)
+);
+
+-- Audit log of every stock adjustment.
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id BIGINT PRIMARY KEY DEFAULT unique_rowid(),
+    product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    warehouse_id VARCHAR(64) NOT NULL,
+    delta BIGINT NOT NULL,
+    on_hand_after BIGINT NOT NULL,
+    reason VARCHAR(64) NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX stock_movements_product_idx (product_id, created_at DESC)
+);
+
+-- Stock held by pending reservations; available stock is on_hand - reserved.
+ALTER TABLE inventory_levels ADD COLUMN IF NOT EXISTS reserved BIGINT NOT NULL DEFAULT 0 CHECK (reserved >= 0 AND reserved <= on_hand);
+
+CREATE TABLE IF NOT EXISTS reservations (
+    id BIGINT PRIMARY KEY DEFAULT unique_rowid(),
+    status VARCHAR(32) NOT NULL CHECK (status IN ('RESERVATION_PENDING', 'RESERVATION_COMMITTED', 'RESERVATION_RELEASED', 'RESERVATION_EXPIRED')),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX reservations_pending_idx (expires_at) WHERE status = 'RESERVATION_PENDING'
+);
+
+CREATE TABLE IF NOT EXISTS reservation_items (
+    reservation_id BIGINT NOT NULL REFERENCES reservations (id) ON DELETE CASCADE,
+    product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    warehouse_id VARCHAR(64) NOT NULL,
+    quantity BIGINT NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (reservation_id, product_id, warehouse_id)
+);
+
+-- Lots of perishable products. Their quantities are part of
+-- inventory_levels.on_hand; stock in lots past best_before is not available.
+-- expired_at records when the expiry job handled the lot.
+CREATE TABLE IF NOT EXISTS stock_lots (
+    id BIGINT PRIMARY KEY DEFAULT unique_rowid(),
+    product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    warehouse_id VARCHAR(64) NOT NULL,
+    lot_code VARCHAR(64) NOT NULL,
+    quantity BIGINT NOT NULL CHECK (quantity >= 0),
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    best_before TIMESTAMP WITH TIME ZONE NOT NULL,
+    expired_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE INDEX stock_lots_code_idx (product_id, warehouse_id, lot_code),
+    INDEX stock_lots_fefo_idx (product_id, warehouse_id, best_before),
+    INDEX stock_lots_best_before_idx (best_before) WHERE quantity > 0,
+    INDEX stock_lots_unexpired_idx (best_before) WHERE expired_at IS NULL
+);
+
+-- Sellable variants of a product. attributes holds the variation of the
+-- variant as flat JSON named by kind; price falls back to the product price
+-- when NULL.
+CREATE TABLE IF NOT EXISTS product_variants (
+    id BIGINT PRIMARY KEY DEFAULT unique_rowid(),
+    product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    sku VARCHAR(64) NOT NULL,
+    barcode VARCHAR(64) NOT NULL DEFAULT '',
+    kind VARCHAR(32) NOT NULL DEFAULT '',
+    attributes JSONB NOT NULL DEFAULT '{}',
+    price DECIMAL(10, 2),
+    currency VARCHAR(3),
+    stock BIGINT NOT NULL DEFAULT 0 CHECK (stock >= 0),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX product_variants_sku_idx (sku),
+    INDEX product_variants_product_idx (product_id, sku)
+);
+
+-- Registered product types. attributes is a JSON array of
+-- AttributeDefinition messages that the variation column of products of the
+-- type is validated against on write.
+CREATE TABLE IF NOT EXISTS product_types (
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    attributes JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The types of the variation oneof.
+INSERT INTO product_types (name, description, attributes) VALUES
+    ('clothing', 'Apparel', '[{"name": "size", "type": "ATTRIBUTE_STRING"}, {"name": "color", "type": "ATTRIBUTE_STRING"}, {"name": "material", "type": "ATTRIBUTE_STRING"}]'),
+    ('electronics', 'Electronic devices', '[{"name": "model", "type": "ATTRIBUTE_STRING"}, {"name": "voltage", "type": "ATTRIBUTE_INTEGER"}, {"name": "has_warranty", "type": "ATTRIBUTE_BOOLEAN"}]'),
+    ('food', 'Food and drink', '[{"name": "ingredients", "type": "ATTRIBUTE_STRING"}, {"name": "calories", "type": "ATTRIBUTE_INTEGER"}, {"name": "is_vegetarian", "type": "ATTRIBUTE_BOOLEAN"}]')
+ON CONFLICT (name) DO NOTHING;
+
+-- NULL for products written before the registry; their type follows from
+-- the variation oneof.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS product_type VARCHAR(64) REFERENCES product_types (name);
+
+-- Category tree. path lists the ids from the root down to the category
+-- itself, e.g. '/1/5/9/', so descendants are found by prefix.
+CREATE TABLE IF NOT EXISTS categories (
+    id BIGINT PRIMARY KEY DEFAULT unique_rowid(),
+    parent_id BIGINT REFERENCES categories (id),
+    slug VARCHAR(64) NOT NULL,
+    display_name VARCHAR(255) NOT NULL,
+    path STRING NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX categories_slug_idx (slug),
+    INDEX categories_parent_idx (parent_id),
+    INDEX categories_path_idx (path)
+);
+
+-- category keeps the slug of the linked category, or free text for products
+-- outside the tree.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category_id BIGINT REFERENCES categories (id);
+CREATE INDEX IF NOT EXISTS products_category_id_idx ON products (category_id);
+
+-- Link products whose category names a category by its slug.
+UPDATE products SET category_id = c.id, category = c.slug
+FROM categories AS c
+WHERE products.category_id IS NULL AND lower(products.category) = c.slug;
+
+-- Vocabulary of product tags, normalized by the tags package. Product counts
+-- are computed from products.tags.
+CREATE TABLE IF NOT EXISTS tags (
+    name VARCHAR(64) PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INVERTED INDEX IF NOT EXISTS products_tags_idx ON products (tags);
+
+-- Tags of products written before the vocabulary existed. MergeTags folds
+-- their spelling variants together.
+INSERT INTO tags (name)
+SELECT DISTINCT tag FROM products, unnest(products.tags) AS tag
+WHERE length(tag) BETWEEN 1 AND 64
+ON CONFLICT (name) DO NOTHING;
+
+-- Images and attachments of products. The content lives in the configured
+-- blob store under blob_key; images also get a JPEG thumbnail.
+CREATE TABLE IF NOT EXISTS product_media (
+    id BIGINT PRIMARY KEY,
+    product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    kind STRING NOT NULL,
+    content_type STRING NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    alt_text VARCHAR(1000) NOT NULL DEFAULT '',
+    size_bytes INT8 NOT NULL,
+    position INT NOT NULL,
+    blob_key STRING NOT NULL,
+    thumbnail_key STRING NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX product_media_product_idx (product_id, position)
+);
+
+-- Per-locale product content. The product row holds the default locale;
+-- empty fields fall back along the configured locale chain.
+CREATE TABLE IF NOT EXISTS product_translations (
+    product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    locale VARCHAR(35) NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    description STRING NOT NULL DEFAULT '',
+    variation_text JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (product_id, locale)
+);
+
+-- Editorial lifecycle of products. Products that existed before it are
+-- published, or discontinued when their status says so.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS lifecycle STRING NOT NULL DEFAULT 'PUBLISHED'
+    CHECK (lifecycle IN ('DRAFT', 'IN_REVIEW', 'PUBLISHED', 'DISCONTINUED', 'ARCHIVED'));
+CREATE INDEX IF NOT EXISTS products_lifecycle_idx ON products (lifecycle);
+
+UPDATE products SET lifecycle = 'DISCONTINUED'
+WHERE lifecycle = 'PUBLISHED' AND product_status = 'DISCONTINUED';
+
+-- Audit trail of lifecycle transitions. actor is the subject forwarded by
+-- the API gateway.
+CREATE TABLE IF NOT EXISTS product_transitions (
+    id BIGINT PRIMARY KEY DEFAULT unique_rowid(),
+    product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    from_state STRING NOT NULL,
+    to_state STRING NOT NULL,
+    actor STRING NOT NULL DEFAULT '',
+    note VARCHAR(1000) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX product_transitions_product_idx (product_id, created_at DESC)
+);
+
+-- Scheduled publication and withdrawal of products.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS unpublish_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS products_publish_at_idx ON products (publish_at) WHERE publish_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS products_unpublish_at_idx ON products (unpublish_at) WHERE unpublish_at IS NOT NULL;
+
+-- Leases let one replica at a time run a background job.
+CREATE TABLE IF NOT EXISTS leases (
+    name STRING PRIMARY KEY,
+    holder STRING NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Identifiers products can be looked up by. barcode is a GTIN in its 14
+-- digit form. NULLs do not collide, so sku and barcode stay optional.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sku VARCHAR(64);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS slug VARCHAR(64);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS barcode CHAR(14);
+CREATE UNIQUE INDEX IF NOT EXISTS products_sku_key ON products (sku);
+CREATE UNIQUE INDEX IF NOT EXISTS products_barcode_key ON products (barcode);
+
+-- Slugs of products created before slugs existed. Accents are not folded
+-- here as they are for new products. Each base goes to the product with the
+-- lowest id unless another product already has it.
+WITH bases AS (
+    SELECT id, COALESCE(NULLIF(trim(BOTH '-' FROM left(trim(BOTH '-' FROM regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g')), 56)), ''), 'product') AS base
+    FROM products
+    WHERE slug IS NULL
+)
+UPDATE products SET slug = first.base
+FROM (SELECT DISTINCT ON (base) id, base FROM bases ORDER BY base, id) AS first
+WHERE products.id = first.id
+    AND NOT EXISTS (SELECT 1 FROM products AS p WHERE p.slug = first.base);
+
+-- The rest are numbered from 2, skipping slugs in use, such as those of
+-- products named like "Shirt 2". Suffixes are digits, so the numbered slugs
+-- of two different bases never meet.
+WITH pending AS (
+    SELECT id, base, row_number() OVER (PARTITION BY base ORDER BY id) AS k
+    FROM (
+        SELECT id, COALESCE(NULLIF(trim(BOTH '-' FROM left(trim(BOTH '-' FROM regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g')), 56)), ''), 'product') AS base
+        FROM products
+        WHERE slug IS NULL
+    )
+),
+free AS (
+    SELECT b.base, b.base || '-' || s.n::STRING AS slug, row_number() OVER (PARTITION BY b.base ORDER BY s.n) AS k
+    FROM (SELECT base, count(*) AS pending FROM pending GROUP BY base) AS b,
+        LATERAL generate_series(2, b.pending + 1 + (SELECT count(*) FROM products WHERE slug LIKE b.base || '-%')) AS s (n)
+    WHERE NOT EXISTS (SELECT 1 FROM products WHERE slug = b.base || '-' || s.n::STRING)
+)
+UPDATE products SET slug = free.slug
+FROM pending JOIN free ON free.base = pending.base AND free.k = pending.k
+WHERE products.id = pending.id;
+
+-- Created once every product has a distinct slug.
+CREATE UNIQUE INDEX IF NOT EXISTS products_slug_key ON products (slug);
+
+-- Preselects duplicate candidates by trigram similarity of names.
+CREATE INDEX IF NOT EXISTS products_name_trgm_idx ON products USING GIN (lower(name) gin_trgm_ops);
+
+-- Query statistics are purged once past their retention. Search terms over
+-- 64 characters are no longer recorded.
+CREATE INDEX IF NOT EXISTS query_stats_last_seen_idx ON query_stats (last_seen);
+DELETE FROM query_stats WHERE kind = 'product-list' AND char_length(query_key) > 64;
+
+-- Stock of variants is kept in the inventory tables under their id;
+-- variant_id 0 is stock of the product itself. The old primary keys survive
+-- ALTER PRIMARY KEY as unique indexes and are dropped.
+ALTER TABLE inventory_levels ADD COLUMN IF NOT EXISTS variant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE inventory_levels ALTER PRIMARY KEY USING COLUMNS (product_id, variant_id, warehouse_id);
+DROP INDEX IF EXISTS inventory_levels@inventory_levels_product_id_warehouse_id_key CASCADE;
+CREATE INDEX IF NOT EXISTS inventory_levels_variant_idx ON inventory_levels (variant_id) WHERE variant_id != 0;
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS variant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE reservation_items ADD COLUMN IF NOT EXISTS variant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE reservation_items ALTER PRIMARY KEY USING COLUMNS (reservation_id, product_id, variant_id, warehouse_id);
+DROP INDEX IF EXISTS reservation_items@reservation_items_reservation_id_product_id_warehouse_id_key CASCADE;
+ALTER TABLE stock_lots ADD COLUMN IF NOT EXISTS variant_id BIGINT NOT NULL DEFAULT 0;
+CREATE UNIQUE INDEX IF NOT EXISTS stock_lots_variant_code_idx ON stock_lots (product_id, variant_id, warehouse_id, lot_code);
+CREATE INDEX IF NOT EXISTS stock_lots_variant_fefo_idx ON stock_lots (product_id, variant_id, warehouse_id, best_before);
+DROP INDEX IF EXISTS stock_lots@stock_lots_code_idx CASCADE;
+DROP INDEX IF EXISTS stock_lots@stock_lots_fefo_idx;
+
+-- product_variants.stock is no longer read. Stock recorded there moves to
+-- the 'default' warehouse, with a movement to account for it.
+INSERT INTO stock_movements (product_id, variant_id, warehouse_id, delta, on_hand_after, reason, note)
+SELECT product_id, id, 'default', stock, stock, 'STOCK_COUNT_CORRECTION', 'moved from product_variants.stock'
+FROM product_variants
+WHERE stock > 0;
+INSERT INTO inventory_levels (product_id, variant_id, warehouse_id, on_hand)
+SELECT product_id, id, 'default', stock
+FROM product_variants
+WHERE stock > 0
+ON CONFLICT (product_id, variant_id, warehouse_id) DO UPDATE SET on_hand = inventory_levels.on_hand + excluded.on_hand;
+UPDATE product_variants SET stock = 0 WHERE stock > 0;
 
+-- Price history of variants with a price of their own; variant_id 0 is the
+-- history of the product price.
+ALTER TABLE product_prices ADD COLUMN IF NOT EXISTS variant_id BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS product_prices_variant_idx ON product_prices (product_id, variant_id, effective_from DESC);
+INSERT INTO product_prices (product_id, variant_id, currency, amount, effective_from, applied_at)
+SELECT v.product_id, v.id, v.currency, v.price, v.created_at, v.created_at
+FROM product_variants AS v
+WHERE v.price IS NOT NULL AND v.currency IS NOT NULL
+    AND NOT EXISTS (SELECT 1 FROM product_prices AS p WHERE p.variant_id = v.id);
@@ -0,0 +1,52 @@
+// Package tags normalizes product tags so that spelling variants such as
+// "Gluten Free", " gluten  free" and "ｇｌｕｔｅｎ free" are the same tag.
+package tags
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLength is the longest tag, in bytes, after normalization.
+const MaxLength = 64
+
+// Normalize returns the canonical form of tag: NFKC normalized, lower case,
+// without control characters and with runs of whitespace collapsed to a
+// single space.
+func Normalize(tag string) string {
+	tag = norm.NFKC.String(tag)
+	var b strings.Builder
+	space := false
+	for _, r := range tag {
+		switch {
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+		default:
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// NormalizeAll normalizes tags, dropping empty tags and duplicates while
+// keeping the order in which tags first appear.
+func NormalizeAll(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = Normalize(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
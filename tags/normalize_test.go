@@ -0,0 +1,54 @@
+package tags
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want string
+	}{
+		{"lower case", "Gluten Free", "gluten free"},
+		{"surrounding whitespace", "  gluten free  ", "gluten free"},
+		{"whitespace runs", "gluten \t\n free", "gluten free"},
+		{"full width", "\uff47\uff4c\uff55\uff54\uff45\uff4e free", "gluten free"},
+		{"compatibility ligature", "\ufb01ne", "fine"},
+		{"control characters", "glu\x00ten\x7f", "gluten"},
+		{"zero width space", "gluten\u200bfree", "glutenfree"},
+		{"non-breaking space", "gluten\u00a0free", "gluten free"},
+		{"accents kept", "Café", "café"},
+		{"decomposed accent composed", "cafe\u0301", "café"},
+		{"only whitespace", " \t ", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.tag); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAll(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{"nil", nil, []string{}},
+		{"spelling variants", []string{"Gluten Free", " gluten  free", "ｇｌｕｔｅｎ free"}, []string{"gluten free"}},
+		{"first appearance order", []string{"Vegan", "organic", "VEGAN", "Local"}, []string{"vegan", "organic", "local"}},
+		{"empty tags dropped", []string{"", "  ", "sale"}, []string{"sale"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeAll(tt.tags); !slices.Equal(got, tt.want) {
+				t.Errorf("NormalizeAll(%q) = %q, want %q", tt.tags, got, tt.want)
+			}
+		})
+	}
+}